@@ -0,0 +1,16 @@
+package libdnsimmosquare
+
+import "net/url"
+
+// accountIDHeader carries AccountID, unless AccountIDInPath is set
+const accountIDHeader = "X-Account-ID"
+
+// accountPrefix returns the path prefix selecting AccountID, inserted
+// between the endpoint and the path of every request. It is empty unless
+// AccountIDInPath is set.
+func (p *Provider) accountPrefix() string {
+	if p.AccountID == "" || !p.AccountIDInPath {
+		return ""
+	}
+	return "/accounts/" + url.PathEscape(p.AccountID)
+}
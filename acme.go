@@ -0,0 +1,81 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// acmeChallengeLabel is the leftmost label of ACME DNS-01 challenge records
+const acmeChallengeLabel = "_acme-challenge"
+
+// CleanupACMEChallenges deletes the _acme-challenge TXT records of zone
+// created more than olderThan ago, typically left behind by issuance runs
+// that crashed before cleaning up. It returns the deleted records.
+//
+// The age of a record comes from the created_at field returned by the API;
+// records without it are never deleted.
+func (p *Provider) CleanupACMEChallenges(ctx context.Context, zone string, olderThan time.Duration) ([]libdns.Record, error) {
+	records, err := p.fetchRecords(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-olderThan)
+	var stale []libdns.Record
+	for _, record := range records {
+		rr := record.RR()
+		if !strings.EqualFold(rr.Type, "TXT") || !isACMEChallengeName(rr.Name) {
+			continue
+		}
+		createdAt := recordMetadata(record).CreatedAt
+		if createdAt.IsZero() || !createdAt.Before(cutoff) {
+			continue
+		}
+		stale = append(stale, record)
+	}
+	if len(stale) == 0 {
+		return []libdns.Record{}, nil
+	}
+	p.logDebug(ctx, "deleting stale ACME challenges", "zone", zone, "count", len(stale))
+	return p.DeleteRecords(ctx, zone, stale)
+}
+
+// EnsureTXT makes sure zone has a TXT record with the given name and value,
+// as needed by DNS-01 challenge tooling. It is idempotent: when such a
+// record already exists, whatever its TTL, it is returned without writing
+// anything, so retried presentations never create duplicates. Otherwise the
+// record is added with AppendRecords, with its TTL clamped the same way.
+// Other TXT values of the name, e.g. the challenge of a wildcard
+// certificate for the same domain, are kept.
+func (p *Provider) EnsureTXT(ctx context.Context, zone, name, value string, ttl time.Duration) (libdns.Record, error) {
+	name = relativeName(name, zone)
+	records, err := p.fetchFilteredRecords(ctx, zone, RecordFilter{Name: name, Type: "TXT"})
+	if err != nil {
+		return nil, err
+	}
+
+	txt := libdns.TXT{Name: name, Text: value, TTL: ttl}
+	key := keyOf(txt.RR())
+	for _, record := range records {
+		rr := record.RR()
+		if keyOf(rr) == key && rr.Data == value {
+			return record, nil
+		}
+	}
+
+	added, err := p.AppendRecords(ctx, zone, []libdns.Record{txt})
+	if err != nil {
+		return nil, err
+	}
+	return added[0], nil
+}
+
+// isACMEChallengeName reports whether the relative name is an ACME
+// challenge name, for the apex or a subdomain
+func isACMEChallengeName(name string) bool {
+	label, _, _ := strings.Cut(name, ".")
+	return strings.EqualFold(label, acmeChallengeLabel)
+}
@@ -0,0 +1,54 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"net/http"
+)
+
+// AuthProvider authenticates the requests sent to the API, e.g. with a
+// token, custom headers or a request signature. Set Provider.Auth to plug in
+// a scheme the provider doesn't support out of the box.
+type AuthProvider interface {
+	// Apply adds the credentials to req before it is sent. It is called for
+	// every attempt, possibly concurrently; req.Context() is the context of
+	// the attempt.
+	Apply(req *http.Request) error
+}
+
+// AuthRefresher is implemented by AuthProviders whose credentials can be
+// renewed. When a request is rejected with 401, Refresh is called with the
+// rejected request and the request is retried once, with the credentials
+// applied again.
+type AuthRefresher interface {
+	Refresh(ctx context.Context, rejected *http.Request) error
+}
+
+// bearerToken authenticates requests with a static bearer token
+type bearerToken string
+
+// Apply implements AuthProvider.
+func (t bearerToken) Apply(req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+string(t))
+	return nil
+}
+
+// newAuthProvider returns the AuthProvider matching the configured
+// credentials, nil when requests are not authenticated. OAuth2 token
+// requests are sent with client.
+func (p *Provider) newAuthProvider(client *http.Client) AuthProvider {
+	switch {
+	case p.Auth != nil:
+		return p.Auth
+	case p.OAuth2RefreshToken != "":
+		return &tokenCache{fetch: p.oauth2RefreshTokenFetch(client)}
+	case p.OAuth2ClientID != "":
+		return &tokenCache{fetch: p.oauth2ClientCredentialsFetch(client)}
+	case p.APITokenFile != "":
+		return &tokenFile{path: p.APITokenFile}
+	case p.TokenRefresher != nil:
+		return &tokenCache{fetch: p.refreshAPIToken}
+	case p.APIToken != "":
+		return bearerToken(p.APIToken)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// tsigFudge is the time difference allowed between the signer and the
+// server of a TSIG-signed transfer
+const tsigFudge = 300
+
+// TSIGKey is a TSIG key (RFC 8945) authenticating zone transfers.
+type TSIGKey struct {
+	// Name is the name of the key, as configured on the server, e.g.
+	// "transfer-key" in BIND
+	Name string `json:"name"`
+
+	// Algorithm is the HMAC algorithm of the key, e.g. "hmac-sha256", the
+	// default, or "hmac-sha512"
+	Algorithm string `json:"algorithm,omitempty"`
+
+	// Secret is the base64-encoded secret of the key
+	Secret string `json:"secret"`
+}
+
+// sign adds the TSIG record of the key to msg, and returns the secrets to
+// sign it with
+func (k *TSIGKey) sign(msg *dns.Msg) map[string]string {
+	name := dns.CanonicalName(k.Name)
+	algorithm := k.Algorithm
+	if algorithm == "" {
+		algorithm = dns.HmacSHA256
+	}
+	msg.SetTsig(name, dns.CanonicalName(algorithm), tsigFudge, time.Now().Unix())
+	return map[string]string{name: k.Secret}
+}
+
+// AXFROptions configures ImportAXFR
+type AXFROptions struct {
+	ImportOptions
+
+	// TSIG, if set, signs the transfer request and checks the signature of
+	// the responses.
+	TSIG *TSIGKey
+}
+
+// ImportAXFR transfers zone from server with TransferZone and writes its
+// records to zone, like ImportZoneFile does for master files, e.g. to
+// migrate a zone off a legacy BIND server. It returns the records written,
+// or that would be with DryRun.
+func (p *Provider) ImportAXFR(ctx context.Context, zone, server string, opts AXFROptions) ([]libdns.Record, error) {
+	records, err := TransferZone(ctx, zone, server, opts.TSIG)
+	if err != nil {
+		return nil, err
+	}
+	return p.ImportRecords(ctx, zone, records, opts.ImportOptions)
+}
+
+// TransferZone transfers zone with AXFR (RFC 5936) from server, a host
+// name or address with an optional port, 53 by default, which must allow
+// transfers to this host. The transfer is signed with tsig if not nil.
+// Records are returned like ParseZoneFile does, with the SOA record once.
+func TransferZone(ctx context.Context, zone, server string, tsig *TSIGKey) ([]libdns.Record, error) {
+	origin := dns.Fqdn(normalizeZone(zone))
+	address := nameserverAddresses([]string{server})[0]
+
+	conn, err := (&net.Dialer{Timeout: dnsQueryTimeout}).DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %s: %w", address, err)
+	}
+	// closing the connection interrupts the transfer when ctx is done
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	transfer := &dns.Transfer{Conn: &dns.Conn{Conn: conn}}
+	msg := new(dns.Msg)
+	msg.SetAxfr(origin)
+	if tsig != nil {
+		transfer.TsigSecret = tsig.sign(msg)
+	}
+
+	envelopes, err := transfer.In(msg, address)
+	if err != nil {
+		return nil, fmt.Errorf("error requesting the transfer of %s from %s: %w", origin, address, err)
+	}
+	var records []libdns.Record
+	var soa bool
+	for envelope := range envelopes {
+		if envelope.Error != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, fmt.Errorf("error transferring %s from %s: %w", origin, address, envelope.Error)
+		}
+		for _, rr := range envelope.RR {
+			// the transfer starts and ends with the SOA record
+			if rr.Header().Rrtype == dns.TypeSOA {
+				if soa {
+					continue
+				}
+				soa = true
+			}
+			libdnsRR, err := fromDNSRR(rr, origin)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, parseRR(libdnsRR))
+		}
+	}
+	return records, nil
+}
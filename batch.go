@@ -0,0 +1,94 @@
+package libdnsimmosquare
+
+import (
+	"errors"
+
+	"github.com/libdns/libdns"
+	"golang.org/x/sync/errgroup"
+)
+
+// defaultBatchSize is the maximum number of records sent in a single write
+// request unless BatchSize says otherwise
+const defaultBatchSize = 500
+
+// batchSize returns the maximum number of records per write request, zero
+// for no limit
+func (p *Provider) batchSize() int {
+	switch {
+	case p.BatchSize < 0:
+		return 0
+	case p.BatchSize == 0:
+		return defaultBatchSize
+	default:
+		return p.BatchSize
+	}
+}
+
+// batches splits records into consecutive chunks of at most batchSize
+// records, preserving their order
+func (p *Provider) batches(records []libdns.Record) [][]libdns.Record {
+	size := p.batchSize()
+	if size == 0 || len(records) <= size {
+		return [][]libdns.Record{records}
+	}
+	chunks := make([][]libdns.Record, 0, (len(records)+size-1)/size)
+	for len(records) > size {
+		chunks = append(chunks, records[:size:size])
+		records = records[size:]
+	}
+	return append(chunks, records)
+}
+
+// parallelism returns the maximum number of batches sent concurrently
+func (p *Provider) parallelism() int {
+	if p.Parallelism > 1 {
+		return p.Parallelism
+	}
+	return 1
+}
+
+// writeBatches calls write for every batch of records, up to Parallelism
+// batches at a time. Every batch is attempted even if another one fails. It
+// returns the records written, in input order, and the errors of the failed
+// batches, also in input order, so the result doesn't depend on scheduling.
+func (p *Provider) writeBatches(records []libdns.Record, write func(batch []libdns.Record) ([]libdns.Record, error)) ([]libdns.Record, error) {
+	batches := p.batches(records)
+	results := make([][]libdns.Record, len(batches))
+	errs := make([]error, len(batches))
+
+	var g errgroup.Group
+	g.SetLimit(p.parallelism())
+	for i, batch := range batches {
+		i, batch := i, batch
+		g.Go(func() error {
+			results[i], errs[i] = write(batch)
+			return nil
+		})
+	}
+	g.Wait()
+
+	var written []libdns.Record
+	for _, result := range results {
+		written = append(written, result...)
+	}
+	return written, joinBatchErrors(errs)
+}
+
+// joinBatchErrors joins the non-nil errors of errs, returning a single
+// error unwrapped
+func joinBatchErrors(errs []error) error {
+	var failed []error
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	switch len(failed) {
+	case 0:
+		return nil
+	case 1:
+		return failed[0]
+	default:
+		return errors.Join(failed...)
+	}
+}
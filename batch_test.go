@@ -0,0 +1,90 @@
+package libdnsimmosquare_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+
+	libdnsimmosquare "github.com/immosquare/libdns-immosquare"
+	"github.com/immosquare/libdns-immosquare/immosquaretest"
+)
+
+// TestAppendRecordsBatches checks that every batch is sent, and that the
+// records written are returned in input order whatever the scheduling
+func TestAppendRecordsBatches(t *testing.T) {
+	for _, parallelism := range []int{1, 3} {
+		t.Run(fmt.Sprintf("parallelism %d", parallelism), func(t *testing.T) {
+			srv := immosquaretest.NewServer("token")
+			defer srv.Close()
+			srv.AddZone("example.com")
+
+			// The batch holding r2 is refused
+			var mu sync.Mutex
+			var batches []string
+			front := newFront(t, srv, func(w http.ResponseWriter, r *http.Request) bool {
+				if r.Method != http.MethodPost {
+					return false
+				}
+				body, _ := io.ReadAll(r.Body)
+				r.Body = io.NopCloser(bytes.NewReader(body))
+				var request struct {
+					Records []struct {
+						Name string `json:"name"`
+					} `json:"records"`
+				}
+				json.Unmarshal(body, &request)
+				var names []string
+				for _, record := range request.Records {
+					names = append(names, record.Name)
+				}
+				mu.Lock()
+				batches = append(batches, strings.Join(names, ","))
+				mu.Unlock()
+				if strings.Contains(string(body), `"r2"`) {
+					w.WriteHeader(http.StatusUnprocessableEntity)
+					return true
+				}
+				return false
+			})
+
+			var records []libdns.Record
+			for i := 0; i < 5; i++ {
+				records = append(records, libdns.TXT{Name: fmt.Sprintf("r%d", i), Text: "value", TTL: time.Hour})
+			}
+			provider := libdnsimmosquare.NewProvider(front.URL,
+				libdnsimmosquare.WithAPIToken("token"),
+				libdnsimmosquare.WithBatchSize(2),
+				libdnsimmosquare.WithParallelism(parallelism),
+			)
+			added, err := provider.AppendRecords(context.Background(), "example.com", records)
+			if err == nil {
+				t.Error("err = nil, want the error of the refused batch")
+			}
+
+			sort.Strings(batches)
+			if got := strings.Join(batches, " "); got != "r0,r1 r2,r3 r4" {
+				t.Errorf("batches = %s, want r0,r1 r2,r3 r4", got)
+			}
+			var names []string
+			for _, record := range added {
+				names = append(names, record.RR().Name)
+			}
+			if got := strings.Join(names, ","); got != "r0,r1,r4" {
+				t.Errorf("added = %s, want r0,r1,r4", got)
+			}
+			if got := len(srv.Records("example.com")); got != 3 {
+				t.Errorf("%d records in the zone, want 3", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// EnsureCAA publishes the CAA policy of zone, restricting certificate
+// issuance to issuers, the domain names of the allowed CAs such as
+// "letsencrypt.org": each gets an issue and an issuewild record, so
+// wildcard certificates are restricted the same way. iodef, if not empty,
+// is where CAs report invalid requests, a URL or an email address (the
+// "mailto:" scheme is added). The CAA RRset of the apex is replaced with
+// ReplaceRRSet, so CAs missing from issuers are no longer allowed, and
+// nothing is written when the policy is already published. It returns the
+// CAA records of the apex.
+func (p *Provider) EnsureCAA(ctx context.Context, zone string, issuers []string, iodef string) ([]libdns.Record, error) {
+	if len(issuers) == 0 {
+		return nil, fmt.Errorf("at least one CAA issuer is required")
+	}
+	var values []string
+	for _, tag := range []string{"issue", "issuewild"} {
+		for _, issuer := range issuers {
+			if reason := checkName(issuer, false); reason != "" {
+				return nil, fmt.Errorf("invalid CAA issuer %q: %s", issuer, reason)
+			}
+			values = append(values, caaValue(tag, strings.TrimSuffix(issuer, ".")))
+		}
+	}
+	if iodef != "" {
+		if !strings.Contains(iodef, ":") {
+			iodef = "mailto:" + iodef
+		}
+		values = append(values, caaValue("iodef", iodef))
+	}
+	return p.ReplaceRRSet(ctx, zone, apexName, "CAA", values)
+}
+
+// caaValue returns the data of an apex CAA record with the given tag and
+// value, in the form sent to the API
+func caaValue(tag, value string) string {
+	return libdns.CAA{Name: apexName, Tag: tag, Value: value}.RR().Data
+}
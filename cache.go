@@ -0,0 +1,96 @@
+package libdnsimmosquare
+
+import (
+	"sync"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// recordCache caches GetRecords results per zone for CacheTTL. Entries are
+// dropped when the zone is written to, and expired ones are only used once
+// revalidated against the SOA serial of the zone, see SerialSource. Each
+// write bumps the generation of the zone, so that a fetch started before
+// the write doesn't cache the stale records it gets.
+type recordCache struct {
+	mu          sync.Mutex
+	entries     map[string]cachedRecords
+	generations map[string]uint64
+}
+
+// cachedRecords is the record set of a zone, its expiry time and, if
+// known, the SOA serial of the zone before the records were fetched
+type cachedRecords struct {
+	records   []libdns.Record
+	expires   time.Time
+	serial    uint32
+	hasSerial bool
+}
+
+// get returns a copy of the cached records of zone, if not expired
+func (c *recordCache) get(zone string) ([]libdns.Record, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[normalizeZone(zone)]
+	if !ok || !time.Now().Before(entry.expires) {
+		return nil, false
+	}
+	return append([]libdns.Record{}, entry.records...), true
+}
+
+// generation returns the current generation of zone, to pass to set once
+// its records are fetched
+func (c *recordCache) generation(zone string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generations[normalizeZone(zone)]
+}
+
+// set caches a copy of records for zone for ttl, unless the zone was
+// written to since generation was returned by generation. serial is the
+// SOA serial of the zone read before fetching records, if hasSerial.
+func (c *recordCache) set(zone string, generation uint64, records []libdns.Record, ttl time.Duration, serial uint32, hasSerial bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generations[normalizeZone(zone)] != generation {
+		return
+	}
+	if c.entries == nil {
+		c.entries = make(map[string]cachedRecords)
+	}
+	c.entries[normalizeZone(zone)] = cachedRecords{
+		records:   append([]libdns.Record{}, records...),
+		expires:   time.Now().Add(ttl),
+		serial:    serial,
+		hasSerial: hasSerial,
+	}
+}
+
+// revalidate returns a copy of the cached records of zone, expired or
+// not, if they were fetched at serial and the zone wasn't written to since
+// generation was returned by generation; they are then kept for another
+// ttl.
+func (c *recordCache) revalidate(zone string, generation uint64, serial uint32, ttl time.Duration) ([]libdns.Record, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := normalizeZone(zone)
+	entry, ok := c.entries[key]
+	if !ok || !entry.hasSerial || entry.serial != serial || c.generations[key] != generation {
+		return nil, false
+	}
+	entry.expires = time.Now().Add(ttl)
+	c.entries[key] = entry
+	return append([]libdns.Record{}, entry.records...), true
+}
+
+// invalidate drops the cached records of zone
+func (c *recordCache) invalidate(zone string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := normalizeZone(zone)
+	delete(c.entries, key)
+	if c.generations == nil {
+		c.generations = make(map[string]uint64)
+	}
+	c.generations[key]++
+}
@@ -0,0 +1,70 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// Data of the CDS and CDNSKEY records asking the parent to delete the DS
+// records of the zone (RFC 8078 §4)
+const (
+	cdsDeleteData     = "0 0 0 00"
+	cdnskeyDeleteData = "0 3 0 AA=="
+)
+
+// PublishCDS publishes the CDS and CDNSKEY records of zone (RFC 7344),
+// derived from its current DNSKEY set as returned by GetDNSSEC: the DS
+// records of its key signing keys and the keys themselves. Registrars and
+// parents honoring RFC 8078 then update the DS records of the delegation
+// on their own, e.g. after DNSSEC is enabled or a key rolled over. The CDS
+// and CDNSKEY RRsets of the apex are replaced with ReplaceRRSet. It
+// returns the published records.
+func (p *Provider) PublishCDS(ctx context.Context, zone string) ([]libdns.Record, error) {
+	state, err := p.GetDNSSEC(ctx, zone)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching the DNSSEC keys: %w", err)
+	}
+	var cds, cdnskey []string
+	for _, ds := range state.DS {
+		cds = append(cds, ds.Data)
+	}
+	for _, key := range state.DNSKEY {
+		if isKeySigningKey(key.Data) {
+			cdnskey = append(cdnskey, key.Data)
+		}
+	}
+	if len(cds) == 0 || len(cdnskey) == 0 {
+		return nil, fmt.Errorf("zone %s has no key signing key (DNSSEC status %q)", zone, state.Status)
+	}
+	return p.replaceRRSets(ctx, zone, []rrsetValues{
+		{apexName, "CDS", cds},
+		{apexName, "CDNSKEY", cdnskey},
+	})
+}
+
+// PublishCDSDelete publishes the CDS and CDNSKEY records of zone asking its
+// parent to delete the DS records of the delegation (RFC 8078 §4), before
+// disabling DNSSEC with DisableDNSSEC once they are gone. The CDS and
+// CDNSKEY RRsets of the apex are replaced with ReplaceRRSet. It returns the
+// published records.
+func (p *Provider) PublishCDSDelete(ctx context.Context, zone string) ([]libdns.Record, error) {
+	return p.replaceRRSets(ctx, zone, []rrsetValues{
+		{apexName, "CDS", []string{cdsDeleteData}},
+		{apexName, "CDNSKEY", []string{cdnskeyDeleteData}},
+	})
+}
+
+// isKeySigningKey reports whether the DNSKEY data "flags protocol algorithm
+// public-key" has the Secure Entry Point flag of key signing keys
+func isKeySigningKey(data string) bool {
+	fields := strings.Fields(data)
+	if len(fields) == 0 {
+		return false
+	}
+	flags, err := strconv.ParseUint(fields[0], 10, 16)
+	return err == nil && flags&1 == 1
+}
@@ -0,0 +1,42 @@
+// Package certmagicdns solves certmagic DNS-01 challenges with the
+// libdns-immosquare provider.
+//
+//	certmagic.DefaultACME.DNS01Solver = certmagicdns.NewDNSManager(token, endpoint)
+package certmagicdns
+
+import (
+	"time"
+
+	"github.com/caddyserver/certmagic"
+
+	libdnsimmosquare "github.com/immosquare/libdns-immosquare"
+)
+
+// Defaults of the solvers returned by NewDNSManager
+const (
+	defaultTTL                = 2 * time.Minute
+	defaultPropagationTimeout = 2 * time.Minute
+)
+
+// defaultResolvers are the resolvers NewDNSManager configures: public
+// ones, so a local caching or split-horizon resolver doesn't delay or hide
+// the challenge records
+var defaultResolvers = []string{"1.1.1.1:53", "8.8.8.8:53"}
+
+// NewDNSManager returns a certmagic DNS-01 solver writing the challenge
+// records with a Provider for endpoint authenticated with token,
+// configured with opts. The records get a TTL of 2m, and certmagic waits
+// up to 2m for them to be served, checking with public resolvers. The
+// fields of the embedded DNSManager can be changed before the solver is
+// used.
+func NewDNSManager(token, endpoint string, opts ...libdnsimmosquare.Option) *certmagic.DNS01Solver {
+	provider := libdnsimmosquare.NewProvider(endpoint, append([]libdnsimmosquare.Option{libdnsimmosquare.WithAPIToken(token)}, opts...)...)
+	return &certmagic.DNS01Solver{
+		DNSManager: certmagic.DNSManager{
+			DNSProvider:        provider,
+			TTL:                defaultTTL,
+			PropagationTimeout: defaultPropagationTimeout,
+			Resolvers:          append([]string(nil), defaultResolvers...),
+		},
+	}
+}
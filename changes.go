@@ -0,0 +1,223 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// Change is an entry of the audit trail of a zone, see ListChanges
+type Change struct {
+	// ID is the server-assigned ID of the change
+	ID string
+
+	// Time is when the change was made
+	Time time.Time
+
+	// Actor is who or what made the change, e.g. a user or an API token
+	// name, as reported by the API
+	Actor string
+
+	// Action is the kind of change, e.g. "create", "update" or "delete"
+	Action string
+
+	// Record is the record as changed: the new state for creations and
+	// updates, the deleted record for deletions. It is nil when the API
+	// doesn't report it.
+	Record libdns.Record
+
+	// Previous is the record before an update, nil otherwise
+	Previous libdns.Record
+}
+
+// apiChange is a change as returned by the API
+type apiChange struct {
+	ID       apiID      `json:"id"`
+	Time     apiTime    `json:"created_at"`
+	Actor    string     `json:"actor"`
+	Action   string     `json:"action"`
+	Record   *apiRecord `json:"record"`
+	Previous *apiRecord `json:"previous"`
+}
+
+// apiChangesResponse is a page of changes
+type apiChangesResponse struct {
+	Changes    []apiChange `json:"changes"`
+	NextCursor string      `json:"next_cursor"`
+}
+
+// ListChanges returns the changes made to the records of zone since the
+// given time (all the recorded ones when zero), oldest first, from
+// GET /zones/{zone}/changes. Who or what made each change is reported in
+// its Actor, e.g. for compliance reporting. Pages are followed like for
+// GetRecords, through a Link header or a next_cursor field.
+func (p *Provider) ListChanges(ctx context.Context, zone string, since time.Time) ([]Change, error) {
+	path := zonePath(zone) + "/changes"
+	if !since.IsZero() {
+		path = withQuery(path, map[string]string{"since": since.UTC().Format(time.RFC3339)})
+	}
+	return p.listChanges(ctx, zone, path)
+}
+
+// listChanges fetches the changes of zone at path, following pages
+func (p *Provider) listChanges(ctx context.Context, zone, path string) ([]Change, error) {
+	var changes []Change
+	for path != "" {
+		page, next, err := p.getChangesPage(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		for _, apiChange := range page {
+			change, err := p.convertAPIChange(zone, apiChange)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, change)
+		}
+		path = next
+	}
+	return changes, nil
+}
+
+// getChangesPage fetches a page of changes and returns it along with the
+// path of the next page, empty on the last one
+func (p *Provider) getChangesPage(ctx context.Context, path string) ([]apiChange, string, error) {
+	resp, err := p.makeRequest(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("GET request error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", newAPIError(resp)
+	}
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("body reading error: %w", err)
+	}
+
+	// Same shapes as GetRecords: an object with a changes field, or a direct array
+	var page apiChangesResponse
+	if err := json.Unmarshal(bodyBytes, &page); err != nil {
+		if err := json.Unmarshal(bodyBytes, &page.Changes); err != nil {
+			return nil, "", fmt.Errorf("JSON decoding error: %w", err)
+		}
+	}
+	if len(page.Changes) == 0 {
+		return nil, "", nil
+	}
+
+	var next string
+	if link := nextLink(resp.Header.Values("Link")); link != "" {
+		if next, err = p.endpointRelativePath(resp.Request.URL, link); err != nil {
+			return nil, "", err
+		}
+	} else if page.NextCursor != "" {
+		next = withQuery(path, map[string]string{"cursor": page.NextCursor})
+	}
+	// Guard against servers that keep pointing at the same page
+	if next == path {
+		next = ""
+	}
+	return page.Changes, next, nil
+}
+
+// convertAPIChange converts a change of zone returned by the API
+func (p *Provider) convertAPIChange(zone string, apiChange apiChange) (Change, error) {
+	change := Change{
+		ID:     string(apiChange.ID),
+		Time:   time.Time(apiChange.Time),
+		Actor:  apiChange.Actor,
+		Action: apiChange.Action,
+	}
+	var err error
+	if change.Record, err = p.convertChangeRecord(zone, apiChange.Record); err != nil {
+		return Change{}, fmt.Errorf("change %s: %w", change.ID, err)
+	}
+	if change.Previous, err = p.convertChangeRecord(zone, apiChange.Previous); err != nil {
+		return Change{}, fmt.Errorf("change %s: %w", change.ID, err)
+	}
+	return change, nil
+}
+
+// convertChangeRecord converts a record of a change, with its metadata,
+// nil if the change has none
+func (p *Provider) convertChangeRecord(zone string, apiRecord *apiRecord) (libdns.Record, error) {
+	if apiRecord == nil {
+		return nil, nil
+	}
+	record, err := p.convertAPIRecordToLibDNS(zone, *apiRecord)
+	if err != nil {
+		return nil, err
+	}
+	return withMetadata(record, *apiRecord), nil
+}
+
+// GetRecordHistory returns the changes made to the records named name (a
+// relative or absolute name) of type rtype, or of any type when empty,
+// oldest first. It is built on the audit trail of ListChanges; the name and
+// type are sent as query parameters so the API can filter the changes too.
+func (p *Provider) GetRecordHistory(ctx context.Context, zone, name, rtype string) ([]Change, error) {
+	name = relativeName(name, zone)
+	params := map[string]string{"name": name}
+	if rtype != "" {
+		params["type"] = strings.ToUpper(rtype)
+	}
+	changes, err := p.listChanges(ctx, zone, withQuery(zonePath(zone)+"/changes", params))
+	if err != nil {
+		return nil, err
+	}
+
+	history := changes[:0]
+	for _, change := range changes {
+		record := change.Record
+		if record == nil {
+			record = change.Previous
+		}
+		if record == nil {
+			continue
+		}
+		rr := record.RR()
+		if strings.EqualFold(relativeName(rr.Name, zone), name) &&
+			(rtype == "" || strings.EqualFold(rr.Type, rtype)) {
+			history = append(history, change)
+		}
+	}
+	return history, nil
+}
+
+// RevertRecord undoes change, typically found with GetRecordHistory: a
+// created record is deleted, a deleted record is added back and an updated
+// record gets its previous value back. TTLs are restored as recorded,
+// without clamping. If the revert fails halfway, the records are restored
+// on a best-effort basis.
+func (p *Provider) RevertRecord(ctx context.Context, zone string, change Change) error {
+	var toDelete, toAdd []libdns.Record
+	switch strings.ToLower(change.Action) {
+	case "create", "created":
+		toDelete = []libdns.Record{change.Record}
+	case "delete", "deleted":
+		toAdd = []libdns.Record{change.Record}
+	case "update", "updated":
+		toDelete = []libdns.Record{change.Record}
+		toAdd = []libdns.Record{change.Previous}
+	default:
+		return fmt.Errorf("can't revert change %s: unknown action %q", change.ID, change.Action)
+	}
+	for _, record := range append(toDelete, toAdd...) {
+		if record == nil {
+			return fmt.Errorf("can't revert change %s: its records are not known", change.ID)
+		}
+	}
+	if err := p.applyRRsetChanges(ctx, zone, toDelete, toAdd); err != nil {
+		return fmt.Errorf("error reverting change %s: %w", change.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// CloneOptions configures CloneZone
+type CloneOptions struct {
+	// Replace writes the records with SetRecords, replacing the RRsets of
+	// the destination zone present in the source, instead of appending
+	// them with AppendRecords.
+	Replace bool
+
+	// IncludeApexNS copies the NS records of the source zone apex, which
+	// are skipped by default as the API manages them. SOA records are
+	// always skipped.
+	IncludeApexNS bool
+
+	// Exclude selects the records not copied; each filter matches a name,
+	// a type or both, see RecordFilter.
+	Exclude []RecordFilter
+
+	// Rename, if set, returns the name in the destination zone of the
+	// records of the source zone named name, both relative ("@" for the
+	// apex); records for which it returns an empty name are not copied.
+	Rename func(name string) string
+
+	// RewriteData replaces the source zone name with the destination one
+	// in the record data, e.g. in CNAME and MX targets or SPF includes, so
+	// the records of the copy point to the copy.
+	RewriteData bool
+}
+
+// CloneZone copies the records of srcZone to dstZone, which must exist,
+// e.g. to spin up a customer domain from a reference one. Record names are
+// relative, so "www" in srcZone is copied as "www" in dstZone unless
+// renamed by opts. Ownership markers are not copied in the ownership mode,
+// the RRsets written are claimed for this provider instead. It returns the
+// records written.
+func (p *Provider) CloneZone(ctx context.Context, srcZone, dstZone string, opts CloneOptions) ([]libdns.Record, error) {
+	records, err := p.fetchRecords(ctx, srcZone)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching the records of %s: %w", srcZone, err)
+	}
+
+	src, dst := normalizeZone(srcZone), normalizeZone(dstZone)
+	copied := make([]libdns.Record, 0, len(records))
+	for _, record := range p.ownershipOf(ctx, nil).withoutMarkers(records) {
+		rr := record.RR()
+		rr.Name = normalizeName(rr.Name)
+		rr.Type = strings.ToUpper(rr.Type)
+		if rr.Type == "SOA" || (rr.Type == "NS" && rr.Name == apexName && !opts.IncludeApexNS) || excluded(opts.Exclude, rr) {
+			continue
+		}
+		if opts.Rename != nil {
+			if rr.Name = opts.Rename(rr.Name); rr.Name == "" {
+				continue
+			}
+		}
+		if opts.RewriteData {
+			rr.Data = replaceDomain(rr.Data, src, dst)
+		}
+		copied = append(copied, parseRR(rr))
+	}
+	if len(copied) == 0 {
+		return []libdns.Record{}, nil
+	}
+	if opts.Replace {
+		return p.SetRecords(ctx, dstZone, copied)
+	}
+	return p.AppendRecords(ctx, dstZone, copied)
+}
+
+// excluded reports whether one of filters selects rr
+func excluded(filters []RecordFilter, rr libdns.RR) bool {
+	for _, filter := range filters {
+		if filter.match(rr) {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceDomain replaces the occurrences of the domain name from in s with
+// to, ignoring case: from must not be part of a longer label or be
+// followed by another label, so "example.com" is replaced in
+// "www.example.com." and "include:example.com" but not in
+// "myexample.com" or "example.com.au"
+func replaceDomain(s, from, to string) string {
+	if from == "" {
+		return s
+	}
+	var b strings.Builder
+	start := 0
+	for i := 0; i+len(from) <= len(s); i++ {
+		end := i + len(from)
+		if !strings.EqualFold(s[i:end], from) {
+			continue
+		}
+		before := i == 0 || !isLabelByte(s[i-1])
+		after := end == len(s) || !isLabelByte(s[end]) && (s[end] != '.' || end+1 == len(s) || !isLabelByte(s[end+1]))
+		if before && after {
+			b.WriteString(s[start:i] + to)
+			start = end
+			i = end - 1
+		}
+	}
+	b.WriteString(s[start:])
+	return b.String()
+}
+
+// isLabelByte reports whether c may be part of a host name label
+func isLabelByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_'
+}
@@ -0,0 +1,429 @@
+// Command immosquare-dns manages DNS records through the immosquare API.
+//
+// Usage:
+//
+//	immosquare-dns [global flags] zones list
+//	immosquare-dns [global flags] zones get <zone>
+//	immosquare-dns [global flags] zones create [-ttl 1h] [-template name] <zone> [variable=value...]
+//	immosquare-dns [global flags] zones delete <zone>
+//	immosquare-dns [global flags] records get [-json] <zone> [name [type]]
+//	immosquare-dns [global flags] records add [-ttl 5m] <zone> <name> <type> <value>...
+//	immosquare-dns [global flags] records set [-ttl 5m] <zone> <name> <type> <value>...
+//	immosquare-dns [global flags] records delete <zone> <name> [type [value...]]
+//	immosquare-dns [global flags] templates apply <zone> <template> [variable=value...]
+//	immosquare-dns [global flags] external-dns serve [-listen localhost:8888] [-health-listen :8080] [zone...]
+//
+// Credentials are read, in order of precedence, from the -endpoint and
+// -token flags, the IMMOSQUARE_ENDPOINT and IMMOSQUARE_API_TOKEN environment
+// variables, and the JSON config file given with -config, which uses the
+// same fields as the provider's JSON configuration:
+//
+//	{"endpoint": "https://your-dns-api.com/api/dns", "api_token": "..."}
+//
+// Record templates applied with "templates apply" and "zones create
+// -template" are defined in the templates field of the config file.
+//
+// "external-dns serve" serves the external-dns webhook provider API for
+// the given zones, all those of the account by default, until interrupted.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	libdnsimmosquare "github.com/immosquare/libdns-immosquare"
+	"github.com/immosquare/libdns-immosquare/externaldns"
+	"github.com/libdns/libdns"
+)
+
+// errUsage is returned for invalid command lines
+var errUsage = errors.New("invalid usage")
+
+const usage = `Usage:
+  immosquare-dns [global flags] zones list
+  immosquare-dns [global flags] zones get <zone>
+  immosquare-dns [global flags] zones create [-ttl 1h] [-template name] <zone> [variable=value...]
+  immosquare-dns [global flags] zones delete <zone>
+  immosquare-dns [global flags] records get [-json] <zone> [name [type]]
+  immosquare-dns [global flags] records add [-ttl 5m] <zone> <name> <type> <value>...
+  immosquare-dns [global flags] records set [-ttl 5m] <zone> <name> <type> <value>...
+  immosquare-dns [global flags] records delete <zone> <name> [type [value...]]
+  immosquare-dns [global flags] templates apply <zone> <template> [variable=value...]
+  immosquare-dns [global flags] external-dns serve [-listen localhost:8888] [-health-listen :8080] [zone...]
+
+Global flags:
+`
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	os.Exit(run(ctx, os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the command line args and returns the exit code
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	global := flag.NewFlagSet("immosquare-dns", flag.ContinueOnError)
+	global.SetOutput(stderr)
+	configPath := global.String("config", "", "JSON config file with endpoint and api_token")
+	endpoint := global.String("endpoint", "", "API endpoint (default $IMMOSQUARE_ENDPOINT)")
+	token := global.String("token", "", "API token (default $IMMOSQUARE_API_TOKEN)")
+	debug := global.Bool("debug", false, "dump HTTP exchanges to stderr")
+	global.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		global.PrintDefaults()
+	}
+	if err := global.Parse(args); err != nil {
+		return 2
+	}
+
+	provider, err := loadProvider(*configPath, *endpoint, *token)
+	if err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+		return 1
+	}
+	if *debug {
+		provider.Debug = true
+	}
+
+	cmd := global.Args()
+	if len(cmd) < 2 {
+		global.Usage()
+		return 2
+	}
+	switch cmd[0] + " " + cmd[1] {
+	case "zones list":
+		err = zonesList(ctx, provider, stdout)
+	case "zones get":
+		err = zonesGet(ctx, provider, cmd[2:], stdout)
+	case "zones create":
+		err = zonesCreate(ctx, provider, cmd[2:], stdout, stderr)
+	case "zones delete":
+		err = zonesDelete(ctx, provider, cmd[2:])
+	case "records get":
+		err = recordsGet(ctx, provider, cmd[2:], stdout, stderr)
+	case "records add", "records set":
+		err = recordsWrite(ctx, provider, cmd[1], cmd[2:], stdout, stderr)
+	case "records delete":
+		err = recordsDelete(ctx, provider, cmd[2:], stdout, stderr)
+	case "templates apply":
+		err = templatesApply(ctx, provider, cmd[2:], stdout)
+	case "external-dns serve":
+		err = externalDNSServe(ctx, provider, cmd[2:], stderr)
+	default:
+		err = errUsage
+	}
+
+	if errors.Is(err, errUsage) {
+		global.Usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+		return 1
+	}
+	return 0
+}
+
+// loadProvider builds the provider from the config file, the environment
+// and the flags, in increasing order of precedence
+func loadProvider(configPath, endpoint, token string) (*libdnsimmosquare.Provider, error) {
+	provider := &libdnsimmosquare.Provider{}
+	if configPath != "" {
+		data, err := os.ReadFile(configPath)
+		if err != nil {
+			return nil, fmt.Errorf("reading config: %w", err)
+		}
+		if err := json.Unmarshal(data, provider); err != nil {
+			return nil, fmt.Errorf("decoding config %s: %w", configPath, err)
+		}
+	}
+	if env := os.Getenv("IMMOSQUARE_ENDPOINT"); env != "" {
+		provider.Endpoint = env
+	}
+	if env := os.Getenv("IMMOSQUARE_API_TOKEN"); env != "" {
+		provider.APIToken, provider.APITokenFile = env, ""
+	}
+	if endpoint != "" {
+		provider.Endpoint = endpoint
+	}
+	if token != "" {
+		provider.APIToken, provider.APITokenFile = token, ""
+	}
+	if provider.Endpoint == "" {
+		return nil, errors.New("no endpoint configured, use -endpoint, IMMOSQUARE_ENDPOINT or -config")
+	}
+	return provider, nil
+}
+
+func zonesList(ctx context.Context, provider *libdnsimmosquare.Provider, stdout io.Writer) error {
+	zones, err := provider.ListZones(ctx)
+	if err != nil {
+		return err
+	}
+	for _, zone := range zones {
+		fmt.Fprintln(stdout, zone.Name)
+	}
+	return nil
+}
+
+func zonesGet(ctx context.Context, provider *libdnsimmosquare.Provider, args []string, stdout io.Writer) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	zone, err := provider.GetZone(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "name\t%s\n", zone.Name)
+	fmt.Fprintf(w, "serial\t%d\n", zone.Serial)
+	fmt.Fprintf(w, "default TTL\t%s\n", zone.DefaultTTL)
+	fmt.Fprintf(w, "nameservers\t%s\n", strings.Join(zone.Nameservers, " "))
+	fmt.Fprintf(w, "DNSSEC\t%s\n", zone.DNSSEC)
+	return w.Flush()
+}
+
+func zonesCreate(ctx context.Context, provider *libdnsimmosquare.Provider, args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("zones create", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	ttl := flags.Duration("ttl", 0, "default TTL of the zone records")
+	template := flags.String("template", "", "template of the config file applied to the zone")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if flags.NArg() < 1 || (*template == "" && flags.NArg() > 1) {
+		return errUsage
+	}
+	vars, err := parseVariables(flags.Args()[1:])
+	if err != nil {
+		return err
+	}
+	zone, err := provider.CreateZone(ctx, flags.Arg(0), libdnsimmosquare.ZoneOptions{
+		DefaultTTL:   *ttl,
+		Template:     *template,
+		TemplateVars: vars,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, zone.Name)
+	return nil
+}
+
+func zonesDelete(ctx context.Context, provider *libdnsimmosquare.Provider, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	return provider.DeleteZone(ctx, args[0])
+}
+
+func recordsGet(ctx context.Context, provider *libdnsimmosquare.Provider, args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("records get", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	asJSON := flags.Bool("json", false, "print records as JSON")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	args = flags.Args()
+	if len(args) < 1 || len(args) > 3 {
+		return errUsage
+	}
+
+	var name, rtype string
+	if len(args) > 1 {
+		name = args[1]
+	}
+	if len(args) > 2 {
+		rtype = args[2]
+	}
+	records, err := provider.LookupRecords(ctx, args[0], name, rtype)
+	if err != nil {
+		return err
+	}
+	rrs := make([]libdns.RR, 0, len(records))
+	for _, record := range records {
+		rrs = append(rrs, record.RR())
+	}
+
+	if *asJSON {
+		type jsonRecord struct {
+			Name string `json:"name"`
+			Type string `json:"type"`
+			TTL  int    `json:"ttl"`
+			Data string `json:"data"`
+		}
+		out := make([]jsonRecord, 0, len(rrs))
+		for _, rr := range rrs {
+			out = append(out, jsonRecord{Name: rr.Name, Type: rr.Type, TTL: int(rr.TTL.Seconds()), Data: rr.Data})
+		}
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(out)
+	}
+	printRecords(stdout, rrs)
+	return nil
+}
+
+func recordsWrite(ctx context.Context, provider *libdnsimmosquare.Provider, action string, args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("records "+action, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	ttl := flags.Duration("ttl", 300*time.Second, "record TTL")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	args = flags.Args()
+	if len(args) < 4 {
+		return errUsage
+	}
+
+	zone, name, rtype := args[0], args[1], strings.ToUpper(args[2])
+	records := make([]libdns.Record, 0, len(args)-3)
+	for _, value := range args[3:] {
+		records = append(records, parseRecord(libdns.RR{Name: name, Type: rtype, Data: value, TTL: *ttl}))
+	}
+
+	var written []libdns.Record
+	var err error
+	if action == "add" {
+		written, err = provider.AppendRecords(ctx, zone, records)
+	} else {
+		written, err = provider.SetRecords(ctx, zone, records)
+	}
+	if err != nil {
+		return err
+	}
+	printRecords(stdout, toRRs(written))
+	return nil
+}
+
+func recordsDelete(ctx context.Context, provider *libdnsimmosquare.Provider, args []string, stdout, stderr io.Writer) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	zone, name := args[0], args[1]
+	var rtype string
+	if len(args) > 2 {
+		rtype = strings.ToUpper(args[2])
+	}
+
+	// Without values, delete the whole RRset (or every record at name)
+	records := []libdns.Record{libdns.RR{Name: name, Type: rtype}}
+	if len(args) > 3 {
+		records = records[:0]
+		for _, value := range args[3:] {
+			records = append(records, libdns.RR{Name: name, Type: rtype, Data: value})
+		}
+	}
+
+	deleted, err := provider.DeleteRecords(ctx, zone, records)
+	if err != nil {
+		return err
+	}
+	printRecords(stdout, toRRs(deleted))
+	return nil
+}
+
+func templatesApply(ctx context.Context, provider *libdnsimmosquare.Provider, args []string, stdout io.Writer) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	vars, err := parseVariables(args[2:])
+	if err != nil {
+		return err
+	}
+
+	written, err := provider.ApplyTemplate(ctx, args[0], args[1], vars)
+	if err != nil {
+		return err
+	}
+	printRecords(stdout, toRRs(written))
+	return nil
+}
+
+func externalDNSServe(ctx context.Context, provider *libdnsimmosquare.Provider, args []string, stderr io.Writer) error {
+	flags := flag.NewFlagSet("external-dns serve", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	listen := flags.String("listen", "localhost:8888", "address of the webhook API")
+	healthListen := flags.String("health-listen", "", "address serving only /healthz, e.g. :8080 for Kubernetes probes")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+
+	webhook := &externaldns.Webhook{Provider: provider, Zones: flags.Args()}
+	servers := []*http.Server{{Addr: *listen, Handler: webhook}}
+	if *healthListen != "" {
+		health := http.NewServeMux()
+		health.Handle("/healthz", webhook)
+		servers = append(servers, &http.Server{Addr: *healthListen, Handler: health})
+	}
+
+	errs := make(chan error, len(servers))
+	for _, server := range servers {
+		go func(server *http.Server) {
+			errs <- server.ListenAndServe()
+		}(server)
+	}
+	fmt.Fprintln(stderr, "serving the external-dns webhook API on", *listen)
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	var err error
+	for _, server := range servers {
+		err = errors.Join(err, server.Shutdown(shutdownCtx))
+	}
+	return err
+}
+
+// parseVariables parses the variable=value arguments of a template
+func parseVariables(args []string) (map[string]string, error) {
+	vars := make(map[string]string, len(args))
+	for _, arg := range args {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return nil, errUsage
+		}
+		vars[name] = value
+	}
+	return vars, nil
+}
+
+// parseRecord returns the type-specific record for rr, or rr itself when its
+// type isn't supported by libdns
+func parseRecord(rr libdns.RR) libdns.Record {
+	if parsed, err := rr.Parse(); err == nil {
+		return parsed
+	}
+	return rr
+}
+
+func toRRs(records []libdns.Record) []libdns.RR {
+	rrs := make([]libdns.RR, 0, len(records))
+	for _, record := range records {
+		rrs = append(rrs, record.RR())
+	}
+	return rrs
+}
+
+// printRecords prints records as an aligned table
+func printRecords(w io.Writer, rrs []libdns.RR) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tTYPE\tTTL\tDATA")
+	for _, rr := range rrs {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", rr.Name, rr.Type, int(rr.TTL.Seconds()), rr.Data)
+	}
+	tw.Flush()
+}
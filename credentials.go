@@ -0,0 +1,66 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// tokenCache is an AuthProvider sending a bearer token, typically an
+// OAuth2 access token. A new token is fetched when it expires, or after the
+// API rejected it with 401. It is safe for concurrent use.
+type tokenCache struct {
+	mu sync.Mutex
+	// fetch returns a new token; current is the previous one, nil on the
+	// first call
+	fetch func(ctx context.Context, current *oauth2.Token) (*oauth2.Token, error)
+	token *oauth2.Token
+}
+
+// Apply implements AuthProvider, fetching a new token if the cached one is
+// missing, expired or was rejected.
+func (c *tokenCache) Apply(req *http.Request) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.token.Valid() {
+		token, err := c.fetch(req.Context(), c.token)
+		if err != nil {
+			return err
+		}
+		c.token = token
+	}
+	c.token.SetAuthHeader(req)
+	return nil
+}
+
+// Refresh implements AuthRefresher by dropping the token rejected was sent
+// with. It does nothing if another request already replaced that token, so
+// concurrent requests rejected with the same token trigger a single fetch.
+func (c *tokenCache) Refresh(_ context.Context, rejected *http.Request) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != nil && rejected.Header.Get("Authorization") == c.token.Type()+" "+c.token.AccessToken {
+		// Keep the refresh token, if any, for the next fetch
+		c.token = &oauth2.Token{RefreshToken: c.token.RefreshToken}
+	}
+	return nil
+}
+
+// refreshAPIToken starts with APIToken, if set, and then gets a new token
+// from TokenRefresher each time the current one is rejected
+func (p *Provider) refreshAPIToken(ctx context.Context, current *oauth2.Token) (*oauth2.Token, error) {
+	if current == nil && p.APIToken != "" {
+		return &oauth2.Token{AccessToken: p.APIToken}, nil
+	}
+	token, err := p.TokenRefresher(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("token refresh error: %w", err)
+	}
+	if token == "" {
+		return nil, fmt.Errorf("token refresh error: empty token")
+	}
+	return &oauth2.Token{AccessToken: token}, nil
+}
@@ -0,0 +1,138 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// debugEnv enables the debug transport when set to a true value
+const debugEnv = "LIBDNS_IMMOSQUARE_DEBUG"
+
+// sensitiveHeaders are redacted from debug dumps
+var sensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+// authHeadersKey is the context key of the names of the headers set by the
+// AuthProvider of a request, which are redacted too, see applyAuth
+type authHeadersKey struct{}
+
+// sensitiveBodyFields matches the JSON fields of request and response bodies
+// redacted from debug dumps, such as webhook secrets
+var sensitiveBodyFields = regexp.MustCompile(`("(?:secret|client_secret|refresh_token|access_token)"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+
+// debugEnabled reports whether HTTP exchanges must be dumped
+func (p *Provider) debugEnabled() bool {
+	if p.Debug || p.debugWriter != nil {
+		return true
+	}
+	enabled, _ := strconv.ParseBool(os.Getenv(debugEnv))
+	return enabled
+}
+
+// debugTransport dumps every request and response, bodies included, with
+// credentials redacted.
+type debugTransport struct {
+	next http.RoundTripper
+	mu   sync.Mutex
+	w    io.Writer
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.dumpRequest(req)
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		t.write(fmt.Sprintf("<<< %s %s failed after %s: %v\n\n", req.Method, req.URL.Redacted(), time.Since(start), err))
+		return nil, err
+	}
+	t.dumpResponse(resp, time.Since(start))
+	return resp, nil
+}
+
+// dumpRequest dumps a redacted copy of req, leaving req untouched
+func (t *debugTransport) dumpRequest(req *http.Request) {
+	clone := req.Clone(req.Context())
+	clone.Body = nil
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			clone.Body = body
+		}
+	}
+	redactHeaders(clone.Header)
+	if names, ok := req.Context().Value(authHeadersKey{}).([]string); ok {
+		for _, name := range names {
+			clone.Header.Set(name, redacted)
+		}
+	}
+
+	dump, err := httputil.DumpRequestOut(clone, clone.Body != nil)
+	if err != nil {
+		t.write(fmt.Sprintf(">>> %s %s (dump error: %v)\n\n", req.Method, req.URL.Redacted(), err))
+		return
+	}
+	t.write(fmt.Sprintf(">>> %s\n\n", redactBody(dump)))
+}
+
+// dumpResponse dumps resp; its body is buffered and remains readable
+func (t *debugTransport) dumpResponse(resp *http.Response, duration time.Duration) {
+	header := resp.Header
+	resp.Header = header.Clone()
+	redactHeaders(resp.Header)
+	dump, err := httputil.DumpResponse(resp, true)
+	resp.Header = header
+	if err != nil {
+		t.write(fmt.Sprintf("<<< %s (dump error: %v)\n\n", resp.Status, err))
+		return
+	}
+	t.write(fmt.Sprintf("<<< (%s)\n%s\n\n", duration, redactBody(dump)))
+}
+
+// write serializes dumps of concurrent requests
+func (t *debugTransport) write(s string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	io.WriteString(t.w, s)
+}
+
+// redactBody replaces the values of sensitive JSON fields in dump
+func redactBody(dump []byte) []byte {
+	return sensitiveBodyFields.ReplaceAll(dump, []byte(`${1}"`+redacted+`"`))
+}
+
+// redactHeaders replaces the values of sensitive headers
+func redactHeaders(h http.Header) {
+	for _, name := range sensitiveHeaders {
+		if h.Get(name) != "" {
+			h.Set(name, redacted)
+		}
+	}
+}
+
+// applyAuth adds the credentials of auth to req, and returns it with the
+// names of the headers auth set or changed in its context, so that debug
+// dumps redact them whatever they are.
+func applyAuth(auth AuthProvider, req *http.Request) (*http.Request, error) {
+	before := req.Header.Clone()
+	if err := auth.Apply(req); err != nil {
+		return nil, err
+	}
+	var names []string
+	for name, values := range req.Header {
+		if !slices.Equal(before[name], values) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return req, nil
+	}
+	return req.WithContext(context.WithValue(req.Context(), authHeadersKey{}, names)), nil
+}
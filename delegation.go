@@ -0,0 +1,60 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// Nameserver is a nameserver a subzone is delegated to by DelegateSubzone.
+type Nameserver struct {
+	// Host is the host name of the nameserver, e.g. "ns1.example.net"
+	Host string
+
+	// Addresses are the addresses of the nameserver, published as glue A
+	// and AAAA records. They are required when Host is within the
+	// delegated subzone, as resolvers can't find them otherwise, and
+	// refused when Host is outside of the zone.
+	Addresses []netip.Addr
+}
+
+// DelegateSubzone delegates the subzone sub of zone, e.g. "dev" for
+// dev.example.com, to nameservers: the NS records of sub and the glue A
+// and AAAA records of the nameservers within zone are written in one
+// SetRecords call, replacing the current ones. Nameservers within sub
+// (in-bailiwick) must have addresses, and nameservers outside of zone must
+// not. It returns the records written.
+func (p *Provider) DelegateSubzone(ctx context.Context, zone, sub string, nameservers []Nameserver) ([]libdns.Record, error) {
+	if len(nameservers) == 0 {
+		return nil, fmt.Errorf("at least one nameserver is required")
+	}
+	sub = relativeName(sub, zone)
+	origin := dns.Fqdn(normalizeZone(zone))
+	delegated := libdns.AbsoluteName(sub, origin)
+	if sub == apexName || !dns.IsSubDomain(origin, delegated) {
+		return nil, fmt.Errorf("invalid subzone %q of zone %s", sub, zone)
+	}
+
+	var records []libdns.Record
+	for _, ns := range nameservers {
+		host := dns.Fqdn(ns.Host)
+		if _, ok := dns.IsDomainName(host); !ok || ns.Host == "" {
+			return nil, fmt.Errorf("invalid nameserver host name %q", ns.Host)
+		}
+		records = append(records, libdns.NS{Name: sub, Target: host})
+
+		switch {
+		case dns.IsSubDomain(delegated, host) && len(ns.Addresses) == 0:
+			return nil, fmt.Errorf("nameserver %s is within %s and requires glue addresses", host, delegated)
+		case !dns.IsSubDomain(origin, host) && len(ns.Addresses) > 0:
+			return nil, fmt.Errorf("nameserver %s is outside of zone %s, its glue addresses can't be published", host, origin)
+		}
+		for _, addr := range ns.Addresses {
+			records = append(records, libdns.Address{Name: libdns.RelativeName(host, origin), IP: addr.Unmap()})
+		}
+	}
+	return p.SetRecords(ctx, zone, records)
+}
@@ -0,0 +1,376 @@
+// Package devdns serves DNS zones from a local listener, for development
+// and integration tests: the records of a zone are loaded from a libdns
+// provider, such as libdns-immosquare, or given as a fixture, and answered
+// authoritatively over UDP and TCP, so applications resolve names exactly
+// as they would in production.
+//
+//	srv, err := devdns.Start("127.0.0.1:0")
+//	if err != nil {
+//		// ...
+//	}
+//	defer srv.Close()
+//	err = srv.Load(ctx, provider, "example.com")
+//	addrs, err := srv.Resolver().LookupHost(ctx, "www.example.com")
+package devdns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// maxCNAMEChain bounds the CNAME records followed in an answer
+const maxCNAMEChain = 8
+
+// Server is a DNS server answering for the zones it's given. It's safe for
+// concurrent use, and zones can be loaded or replaced while it's serving.
+type Server struct {
+	udp  *dns.Server
+	tcp  *dns.Server
+	addr string
+
+	mu    sync.RWMutex
+	zones map[string]*zone
+}
+
+// zone is the content of a served zone: its records by lowercase absolute
+// name, then type
+type zone struct {
+	origin string
+	names  map[string]map[uint16][]dns.RR
+	soa    dns.RR
+}
+
+// Start starts a server listening on addr over UDP and TCP, e.g.
+// "127.0.0.1:0" for a free port, see Addr. It serves no zone until SetZone
+// or Load are called.
+func Start(addr string) (*Server, error) {
+	packetConn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	// The TCP listener uses the port picked for UDP
+	listener, err := net.Listen("tcp", packetConn.LocalAddr().String())
+	if err != nil {
+		packetConn.Close()
+		return nil, err
+	}
+
+	s := &Server{addr: packetConn.LocalAddr().String(), zones: make(map[string]*zone)}
+	s.udp = &dns.Server{PacketConn: packetConn, Handler: s}
+	s.tcp = &dns.Server{Listener: listener, Handler: s}
+	for _, server := range []*dns.Server{s.udp, s.tcp} {
+		started := make(chan struct{})
+		server.NotifyStartedFunc = func() { close(started) }
+		go server.ActivateAndServe()
+		<-started
+	}
+	return s, nil
+}
+
+// Addr returns the "host:port" address the server listens on, over both
+// UDP and TCP.
+func (s *Server) Addr() string {
+	return s.addr
+}
+
+// Close stops the server.
+func (s *Server) Close() error {
+	return errors.Join(s.udp.Shutdown(), s.tcp.Shutdown())
+}
+
+// Resolver returns a resolver sending every query to the server, whatever
+// the system configuration.
+func (s *Server) Resolver() *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, s.addr)
+		},
+	}
+}
+
+// Load fetches the records of name from provider, e.g. a libdns-immosquare
+// provider, and serves them in place of the current ones, see SetZone. It
+// can be called again to pick up changes.
+func (s *Server) Load(ctx context.Context, provider libdns.RecordGetter, name string) error {
+	records, err := provider.GetRecords(ctx, name)
+	if err != nil {
+		return fmt.Errorf("error fetching the records of %s: %w", name, err)
+	}
+	return s.SetZone(name, records)
+}
+
+// SetZone serves records, with names relative to name, as the zone name,
+// replacing its current records, e.g. fixtures parsed with ParseZoneFile.
+// A SOA record is made up when records have none.
+func (s *Server) SetZone(name string, records []libdns.Record) error {
+	origin := dns.CanonicalName(name)
+	z := &zone{origin: origin, names: make(map[string]map[uint16][]dns.RR)}
+	for _, record := range records {
+		rr, err := toDNSRR(record.RR(), origin)
+		if err != nil {
+			return err
+		}
+		owner := strings.ToLower(rr.Header().Name)
+		if !dns.IsSubDomain(origin, owner) {
+			return fmt.Errorf("record %s is outside of zone %s", owner, origin)
+		}
+		if z.names[owner] == nil {
+			z.names[owner] = make(map[uint16][]dns.RR)
+		}
+		rtype := rr.Header().Rrtype
+		z.names[owner][rtype] = append(z.names[owner][rtype], rr)
+	}
+
+	if soas := z.names[origin][dns.TypeSOA]; len(soas) > 0 {
+		z.soa = soas[0]
+	} else {
+		mname := "ns." + origin
+		if ns := z.names[origin][dns.TypeNS]; len(ns) > 0 {
+			mname = ns[0].(*dns.NS).Ns
+		}
+		z.soa = &dns.SOA{
+			Hdr:     dns.RR_Header{Name: origin, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 3600},
+			Ns:      mname,
+			Mbox:    "hostmaster." + origin,
+			Serial:  1,
+			Refresh: 3600,
+			Retry:   600,
+			Expire:  86400,
+			Minttl:  300,
+		}
+		if z.names[origin] == nil {
+			z.names[origin] = make(map[uint16][]dns.RR)
+		}
+		z.names[origin][dns.TypeSOA] = []dns.RR{z.soa}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.zones[origin] = z
+	return nil
+}
+
+// RemoveZone stops serving the zone name.
+func (s *Server) RemoveZone(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.zones, dns.CanonicalName(name))
+}
+
+// ServeDNS answers a query for the served zones, refusing the others.
+func (s *Server) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	resp := new(dns.Msg)
+	resp.SetReply(req)
+	if len(req.Question) != 1 || req.Opcode != dns.OpcodeQuery {
+		resp.Rcode = dns.RcodeNotImplemented
+		w.WriteMsg(resp)
+		return
+	}
+	question := req.Question[0]
+
+	s.mu.RLock()
+	z := s.findZone(strings.ToLower(question.Name))
+	if z == nil {
+		resp.Rcode = dns.RcodeRefused
+	} else {
+		z.answer(resp, question)
+	}
+	s.mu.RUnlock()
+
+	size := dns.MinMsgSize
+	if opt := req.IsEdns0(); opt != nil {
+		size = int(opt.UDPSize())
+		resp.SetEdns0(opt.UDPSize(), false)
+	}
+	if _, ok := w.RemoteAddr().(*net.TCPAddr); ok {
+		size = dns.MaxMsgSize
+	}
+	resp.Truncate(size)
+	w.WriteMsg(resp)
+}
+
+// findZone returns the most specific zone name belongs to; s.mu must be
+// held
+func (s *Server) findZone(name string) *zone {
+	for {
+		if z, ok := s.zones[name]; ok {
+			return z
+		}
+		if name == "." {
+			return nil
+		}
+		labels := strings.SplitN(name, ".", 2)
+		if len(labels) < 2 || labels[1] == "" {
+			name = "."
+		} else {
+			name = labels[1]
+		}
+	}
+}
+
+// answer fills resp for question, which belongs to the zone: records of
+// the name, following CNAME records within the zone and wildcards, or a
+// referral for delegated names, or NXDOMAIN and NODATA answers with the SOA
+// record
+func (z *zone) answer(resp *dns.Msg, question dns.Question) {
+	resp.Authoritative = true
+	name := strings.ToLower(question.Name)
+	for i := 0; i <= maxCNAMEChain; i++ {
+		if delegation := z.delegation(name); delegation != nil {
+			resp.Authoritative = len(resp.Answer) > 0
+			resp.Ns = append(resp.Ns, delegation...)
+			resp.Extra = append(resp.Extra, z.glue(delegation)...)
+			return
+		}
+
+		rrsets, exists := z.lookup(name)
+		if !exists {
+			if len(resp.Answer) == 0 {
+				resp.Rcode = dns.RcodeNameError
+			}
+			resp.Ns = append(resp.Ns, z.soa)
+			return
+		}
+		if rrs := rrsets[question.Qtype]; len(rrs) > 0 {
+			resp.Answer = append(resp.Answer, owned(rrs, name)...)
+			return
+		}
+		if question.Qtype == dns.TypeANY {
+			for _, rrs := range rrsets {
+				resp.Answer = append(resp.Answer, owned(rrs, name)...)
+			}
+			return
+		}
+		cnames := rrsets[dns.TypeCNAME]
+		if len(cnames) == 0 {
+			resp.Ns = append(resp.Ns, z.soa)
+			return
+		}
+		resp.Answer = append(resp.Answer, owned(cnames, name)...)
+		name = strings.ToLower(cnames[0].(*dns.CNAME).Target)
+		if !dns.IsSubDomain(z.origin, name) {
+			// Resolvers follow targets out of the zone on their own
+			return
+		}
+	}
+}
+
+// lookup returns the RRsets of name, those of the wildcard covering it if
+// it doesn't exist, and whether it exists, possibly as an empty
+// non-terminal
+func (z *zone) lookup(name string) (map[uint16][]dns.RR, bool) {
+	if rrsets, ok := z.names[name]; ok {
+		return rrsets, true
+	}
+	for owner := range z.names {
+		if strings.HasSuffix(owner, "."+name) {
+			return nil, true
+		}
+	}
+	// The wildcard of the closest existing ancestor applies (RFC 4592)
+	for ancestor := name; ancestor != z.origin; {
+		ancestor = ancestor[strings.Index(ancestor, ".")+1:]
+		if rrsets, ok := z.names["*."+ancestor]; ok {
+			return rrsets, true
+		}
+		if _, ok := z.names[ancestor]; ok {
+			break
+		}
+	}
+	return nil, false
+}
+
+// delegation returns the NS records of the delegated subzone name is in,
+// nil if none
+func (z *zone) delegation(name string) []dns.RR {
+	for cut := name; cut != z.origin && dns.IsSubDomain(z.origin, cut); cut = cut[strings.Index(cut, ".")+1:] {
+		if ns := z.names[cut][dns.TypeNS]; len(ns) > 0 {
+			return ns
+		}
+	}
+	return nil
+}
+
+// glue returns the A and AAAA records of the delegation nameservers within
+// the zone
+func (z *zone) glue(delegation []dns.RR) []dns.RR {
+	var glue []dns.RR
+	for _, rr := range delegation {
+		host := strings.ToLower(rr.(*dns.NS).Ns)
+		glue = append(glue, z.names[host][dns.TypeA]...)
+		glue = append(glue, z.names[host][dns.TypeAAAA]...)
+	}
+	return glue
+}
+
+// owned returns copies of rrs owned by name, for wildcard answers
+func owned(rrs []dns.RR, name string) []dns.RR {
+	copies := make([]dns.RR, len(rrs))
+	for i, rr := range rrs {
+		copies[i] = dns.Copy(rr)
+		if strings.HasPrefix(rr.Header().Name, "*.") {
+			copies[i].Header().Name = name
+		}
+	}
+	return copies
+}
+
+// toDNSRR converts rr, with its name relative to origin, to a miekg/dns
+// record. Host names without a trailing dot are relative to origin, unless
+// they have several labels.
+func toDNSRR(rr libdns.RR, origin string) (dns.RR, error) {
+	rtype := strings.ToUpper(rr.Type)
+	name := dns.CanonicalName(libdns.AbsoluteName(rr.Name, origin))
+	if rtype == "TXT" {
+		txt := &dns.TXT{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: uint32(rr.TTL.Seconds())}}
+		for text := rr.Data; ; {
+			n := min(len(text), 255)
+			txt.Txt = append(txt.Txt, text[:n])
+			if text = text[n:]; text == "" {
+				break
+			}
+		}
+		return txt, nil
+	}
+
+	data := rr.Data
+	if parsed, err := rr.Parse(); err == nil {
+		switch r := parsed.(type) {
+		case libdns.CNAME:
+			data = fqdnTarget(r.Target)
+		case libdns.NS:
+			data = fqdnTarget(r.Target)
+		case libdns.MX:
+			data = fmt.Sprintf("%d %s", r.Preference, fqdnTarget(r.Target))
+		case libdns.SRV:
+			data = fmt.Sprintf("%d %d %d %s", r.Priority, r.Weight, r.Port, fqdnTarget(r.Target))
+		}
+	}
+	parser := dns.NewZoneParser(strings.NewReader(fmt.Sprintf("%s %d IN %s %s", name, int(rr.TTL.Seconds()), rtype, data)), origin, "")
+	parsed, ok := parser.Next()
+	if !ok {
+		if err := parser.Err(); err != nil {
+			return nil, fmt.Errorf("invalid %s record %q: %w", rtype, rr.Name, err)
+		}
+		return nil, fmt.Errorf("invalid %s record %q: %q", rtype, rr.Name, rr.Data)
+	}
+	parsed.Header().Name = strings.ToLower(parsed.Header().Name)
+	return parsed, nil
+}
+
+// fqdnTarget adds the trailing dot to multi-label host names
+func fqdnTarget(target string) string {
+	if target == "" || target == "@" || strings.HasSuffix(target, ".") || !strings.Contains(target, ".") {
+		return target
+	}
+	return target + "."
+}
@@ -0,0 +1,84 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// dkimLabel follows the selector in the name of DKIM key records
+// (RFC 6376 §3.6.2.1)
+const dkimLabel = "_domainkey"
+
+// DKIMRecord returns the TXT record publishing the DKIM public key of
+// selector, named "<selector>._domainkey" with the value
+// "v=DKIM1; k=<type>; p=<key>". publicKey is either PEM-encoded or the
+// base64 of its DER form, as found in the p= tag, of an RSA key or of an
+// Ed25519 key (RFC 8463), which may also be given as its 32 raw bytes.
+// The value is split into strings of at most 255 bytes when sent.
+func DKIMRecord(selector, publicKey string) (libdns.TXT, error) {
+	if reason := checkName(selector, false); reason != "" {
+		return libdns.TXT{}, fmt.Errorf("invalid DKIM selector %q: %s", selector, reason)
+	}
+	keyType, key, err := parseDKIMKey(publicKey)
+	if err != nil {
+		return libdns.TXT{}, fmt.Errorf("invalid DKIM public key: %w", err)
+	}
+	return libdns.TXT{
+		Name: strings.TrimSuffix(selector, ".") + "." + dkimLabel,
+		Text: fmt.Sprintf("v=DKIM1; k=%s; p=%s", keyType, base64.StdEncoding.EncodeToString(key)),
+	}, nil
+}
+
+// PublishDKIM publishes the DKIM public key of selector in zone, see
+// DKIMRecord. The TXT RRset of the key record is replaced with
+// ReplaceRRSet, so a rotated key takes the place of the previous one. It
+// returns the published record.
+func (p *Provider) PublishDKIM(ctx context.Context, zone, selector, publicKey string) (libdns.Record, error) {
+	txt, err := DKIMRecord(selector, publicKey)
+	if err != nil {
+		return nil, err
+	}
+	records, err := p.ReplaceRRSet(ctx, zone, txt.Name, "TXT", []string{txt.Text})
+	if err != nil {
+		return nil, err
+	}
+	return records[0], nil
+}
+
+// parseDKIMKey returns the key type and p= tag bytes of publicKey
+func parseDKIMKey(publicKey string) (string, []byte, error) {
+	var der []byte
+	if block, _ := pem.Decode([]byte(publicKey)); block != nil {
+		der = block.Bytes
+	} else {
+		var err error
+		der, err = base64.StdEncoding.DecodeString(strings.Join(strings.Fields(publicKey), ""))
+		if err != nil {
+			return "", nil, fmt.Errorf("neither PEM nor base64: %w", err)
+		}
+	}
+	if len(der) == ed25519.PublicKeySize {
+		return "ed25519", der, nil
+	}
+
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return "", nil, err
+	}
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return "rsa", der, nil
+	case ed25519.PublicKey:
+		return "ed25519", []byte(key), nil
+	default:
+		return "", nil, fmt.Errorf("unsupported key type %T", key)
+	}
+}
@@ -0,0 +1,202 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// dmarcLabel is the name of DMARC policy records, relative to the domain
+// they apply to (RFC 7489 §6.1)
+const dmarcLabel = "_dmarc"
+
+// dmarcVersion is the version tag starting DMARC records
+const dmarcVersion = "v=DMARC1"
+
+// DMARCPolicy is a DMARC policy record (RFC 7489 §6.3), published with
+// PublishDMARC or parsed with ParseDMARC. Empty fields are left out of the
+// record, so the receivers' defaults apply.
+type DMARCPolicy struct {
+	// Policy is the p tag: "none", "quarantine" or "reject" (required)
+	Policy string
+	// SubdomainPolicy is the sp tag, the policy of subdomains when it
+	// differs from Policy
+	SubdomainPolicy string
+	// Percent is the pct tag, the percentage of failing messages the policy
+	// is applied to, from 1 to 100 (default 100)
+	Percent int
+	// AggregateReports are the URIs of the rua tag, aggregate report
+	// recipients; email addresses get the "mailto:" scheme
+	AggregateReports []string
+	// FailureReports are the URIs of the ruf tag, failure report recipients;
+	// email addresses get the "mailto:" scheme
+	FailureReports []string
+	// DKIMAlignment is the adkim tag: "r" (relaxed, default) or "s" (strict)
+	DKIMAlignment string
+	// SPFAlignment is the aspf tag: "r" (relaxed, default) or "s" (strict)
+	SPFAlignment string
+	// FailureOptions is the fo tag, when failure reports are sent, e.g. "1"
+	FailureOptions string
+}
+
+// Validate returns an error if the policy can't be published.
+func (d DMARCPolicy) Validate() error {
+	if !isDMARCPolicy(d.Policy) {
+		return fmt.Errorf("invalid DMARC policy %q: must be none, quarantine or reject", d.Policy)
+	}
+	if d.SubdomainPolicy != "" && !isDMARCPolicy(d.SubdomainPolicy) {
+		return fmt.Errorf("invalid DMARC subdomain policy %q: must be none, quarantine or reject", d.SubdomainPolicy)
+	}
+	if d.Percent < 0 || d.Percent > 100 {
+		return fmt.Errorf("invalid DMARC percentage %d: must be between 1 and 100", d.Percent)
+	}
+	for _, mode := range []string{d.DKIMAlignment, d.SPFAlignment} {
+		if mode != "" && mode != "r" && mode != "s" {
+			return fmt.Errorf("invalid DMARC alignment mode %q: must be r or s", mode)
+		}
+	}
+	for _, uri := range append(append([]string{}, d.AggregateReports...), d.FailureReports...) {
+		if u, err := url.Parse(dmarcURI(uri)); err != nil || u.Scheme == "" || strings.ContainsAny(uri, ",; ") {
+			return fmt.Errorf("invalid DMARC report URI %q", uri)
+		}
+	}
+	return nil
+}
+
+// String renders the policy as the value of its TXT record, e.g.
+// "v=DMARC1; p=reject; rua=mailto:dmarc@example.com".
+func (d DMARCPolicy) String() string {
+	tags := []string{dmarcVersion, "p=" + d.Policy}
+	if d.SubdomainPolicy != "" {
+		tags = append(tags, "sp="+d.SubdomainPolicy)
+	}
+	if d.Percent > 0 {
+		tags = append(tags, "pct="+strconv.Itoa(d.Percent))
+	}
+	if len(d.AggregateReports) > 0 {
+		tags = append(tags, "rua="+joinDMARCURIs(d.AggregateReports))
+	}
+	if len(d.FailureReports) > 0 {
+		tags = append(tags, "ruf="+joinDMARCURIs(d.FailureReports))
+	}
+	if d.DKIMAlignment != "" {
+		tags = append(tags, "adkim="+d.DKIMAlignment)
+	}
+	if d.SPFAlignment != "" {
+		tags = append(tags, "aspf="+d.SPFAlignment)
+	}
+	if d.FailureOptions != "" {
+		tags = append(tags, "fo="+d.FailureOptions)
+	}
+	return strings.Join(tags, "; ")
+}
+
+// ParseDMARC parses the value of a DMARC TXT record, checking it the same
+// way as Validate. Unknown tags are ignored, as required by RFC 7489.
+func ParseDMARC(text string) (DMARCPolicy, error) {
+	var d DMARCPolicy
+	fields := strings.Split(text, ";")
+	if !strings.EqualFold(strings.ReplaceAll(strings.TrimSpace(fields[0]), " ", ""), dmarcVersion) {
+		return d, fmt.Errorf("not a DMARC record: %q doesn't start with %s", text, dmarcVersion)
+	}
+	for _, field := range fields[1:] {
+		tag, value, ok := strings.Cut(field, "=")
+		tag, value = strings.ToLower(strings.TrimSpace(tag)), strings.TrimSpace(value)
+		if !ok {
+			if tag == "" {
+				continue
+			}
+			return d, fmt.Errorf("invalid DMARC tag %q", strings.TrimSpace(field))
+		}
+		switch tag {
+		case "p":
+			d.Policy = strings.ToLower(value)
+		case "sp":
+			d.SubdomainPolicy = strings.ToLower(value)
+		case "pct":
+			percent, err := strconv.Atoi(value)
+			if err != nil {
+				return d, fmt.Errorf("invalid DMARC percentage %q", value)
+			}
+			d.Percent = percent
+		case "rua":
+			d.AggregateReports = splitDMARCURIs(value)
+		case "ruf":
+			d.FailureReports = splitDMARCURIs(value)
+		case "adkim":
+			d.DKIMAlignment = strings.ToLower(value)
+		case "aspf":
+			d.SPFAlignment = strings.ToLower(value)
+		case "fo":
+			d.FailureOptions = value
+		}
+	}
+	return d, d.Validate()
+}
+
+// PublishDMARC publishes policy in the _dmarc TXT record of zone, replacing
+// the current policy, if any, with ReplaceRRSet. It returns the published
+// record.
+func (p *Provider) PublishDMARC(ctx context.Context, zone string, policy DMARCPolicy) (libdns.Record, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	records, err := p.ReplaceRRSet(ctx, zone, dmarcLabel, "TXT", []string{policy.String()})
+	if err != nil {
+		return nil, err
+	}
+	return records[0], nil
+}
+
+// GetDMARC returns the DMARC policy published in zone, parsed with
+// ParseDMARC. It fails with ErrRecordNotFound when there's none.
+func (p *Provider) GetDMARC(ctx context.Context, zone string) (DMARCPolicy, error) {
+	records, err := p.LookupRecords(ctx, zone, dmarcLabel, "TXT")
+	if err != nil {
+		return DMARCPolicy{}, err
+	}
+	for _, record := range records {
+		if text := record.RR().Data; strings.HasPrefix(strings.ToUpper(text), strings.ToUpper(dmarcVersion)) {
+			return ParseDMARC(text)
+		}
+	}
+	return DMARCPolicy{}, fmt.Errorf("no DMARC record in zone %s: %w", zone, ErrRecordNotFound)
+}
+
+// isDMARCPolicy reports whether policy is a valid p or sp tag value
+func isDMARCPolicy(policy string) bool {
+	return policy == "none" || policy == "quarantine" || policy == "reject"
+}
+
+// dmarcURI returns the report URI uri, with the mailto: scheme added to
+// plain email addresses
+func dmarcURI(uri string) string {
+	if !strings.Contains(uri, ":") && strings.Contains(uri, "@") {
+		return "mailto:" + uri
+	}
+	return uri
+}
+
+// joinDMARCURIs renders the value of a rua or ruf tag
+func joinDMARCURIs(uris []string) string {
+	rendered := make([]string, len(uris))
+	for i, uri := range uris {
+		rendered[i] = dmarcURI(uri)
+	}
+	return strings.Join(rendered, ",")
+}
+
+// splitDMARCURIs splits the value of a rua or ruf tag into its URIs
+func splitDMARCURIs(value string) []string {
+	var uris []string
+	for _, uri := range strings.Split(value, ",") {
+		if uri = strings.TrimSpace(uri); uri != "" {
+			uris = append(uris, uri)
+		}
+	}
+	return uris
+}
@@ -0,0 +1,191 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// DNSSEC is the DNSSEC state of a zone, see GetDNSSEC. The DS records are
+// the ones to publish at the registrar of the zone to delegate it as
+// signed.
+type DNSSEC struct {
+	// Status is the DNSSEC status reported by the API, e.g. "signed",
+	// "pending" or "disabled", or "enabled" and "disabled" when reported
+	// as a boolean
+	Status string
+
+	// DNSKEY are the DNSKEY records of the zone apex, with the data
+	// "flags protocol algorithm public-key"
+	DNSKEY []libdns.RR
+
+	// DS are the DS records of the key signing keys, with the data
+	// "key-tag algorithm digest-type digest". When the API returns none,
+	// they are computed from the DNSKEY records with SHA-256.
+	DS []libdns.RR
+}
+
+// apiDNSSEC is the DNSSEC state of a zone as returned by the API
+type apiDNSSEC struct {
+	Status  dnssecStatus      `json:"status"`
+	DNSKEYs []json.RawMessage `json:"dnskeys"`
+	Keys    []json.RawMessage `json:"keys"`
+	DS      []json.RawMessage `json:"ds"`
+}
+
+// apiDNSKEY is a DNSKEY record given as an object by the API
+type apiDNSKEY struct {
+	Flags     uint16 `json:"flags"`
+	Protocol  uint8  `json:"protocol"`
+	Algorithm uint8  `json:"algorithm"`
+	PublicKey string `json:"public_key"`
+}
+
+// apiDS is a DS record given as an object by the API
+type apiDS struct {
+	KeyTag     uint16 `json:"key_tag"`
+	Algorithm  uint8  `json:"algorithm"`
+	DigestType uint8  `json:"digest_type"`
+	Digest     string `json:"digest"`
+}
+
+// GetDNSSEC returns the DNSSEC state of zone, with
+// GET /zones/{zone}/dnssec: its status and the DNSKEY and DS records to
+// publish at its registrar.
+func (p *Provider) GetDNSSEC(ctx context.Context, zone string) (DNSSEC, error) {
+	resp, err := p.makeRequest(ctx, "GET", zonePath(zone)+"/dnssec", nil)
+	if err != nil {
+		return DNSSEC{}, fmt.Errorf("GET request error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return DNSSEC{}, newAPIError(resp)
+	}
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return DNSSEC{}, fmt.Errorf("body reading error: %w", err)
+	}
+	return decodeDNSSEC(zone, bodyBytes)
+}
+
+// EnableDNSSEC signs zone, with POST /zones/{zone}/dnssec, and returns its
+// DNSSEC state, see GetDNSSEC. Signing may take a while: the status may be
+// "pending" and the keys missing until it's done. The DS records must then
+// be published at the registrar of the zone.
+func (p *Provider) EnableDNSSEC(ctx context.Context, zone string) (DNSSEC, error) {
+	if err := p.setDNSSEC(ctx, zone, "POST"); err != nil {
+		return DNSSEC{}, err
+	}
+	return p.GetDNSSEC(ctx, zone)
+}
+
+// DisableDNSSEC stops signing zone, with DELETE /zones/{zone}/dnssec. The
+// DS records must be removed from the registrar of the zone first, and
+// their TTL expired, or resolvers will fail to validate the zone.
+func (p *Provider) DisableDNSSEC(ctx context.Context, zone string) error {
+	return p.setDNSSEC(ctx, zone, "DELETE")
+}
+
+// setDNSSEC enables or disables DNSSEC on zone with method, awaiting the
+// operation of a 202 Accepted response
+func (p *Provider) setDNSSEC(ctx context.Context, zone, method string) error {
+	resp, err := p.makeRequest(ctx, method, zonePath(zone)+"/dnssec", nil)
+	if err != nil {
+		return fmt.Errorf("%s request error: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+		return nil
+	case http.StatusAccepted:
+		bodyBytes, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("response reading error: %w", err)
+		}
+		if _, err := p.awaitOperation(ctx, resp, bodyBytes); err != nil {
+			return fmt.Errorf("error during DNSSEC update: %w", err)
+		}
+		return nil
+	}
+	return newAPIError(resp)
+}
+
+// decodeDNSSEC decodes the DNSSEC state of zone returned by the API, as an
+// object with a dnssec field or directly. Keys and DS records are given in
+// presentation format or as objects.
+func decodeDNSSEC(zone string, body []byte) (DNSSEC, error) {
+	var state apiDNSSEC
+	var apiResponse struct {
+		DNSSEC *apiDNSSEC `json:"dnssec"`
+	}
+	if err := json.Unmarshal(body, &apiResponse); err == nil && apiResponse.DNSSEC != nil {
+		state = *apiResponse.DNSSEC
+	} else if err := json.Unmarshal(body, &state); err != nil {
+		return DNSSEC{}, fmt.Errorf("JSON decoding error: %w", err)
+	}
+
+	result := DNSSEC{Status: string(state.Status)}
+	for _, raw := range append(state.DNSKEYs, state.Keys...) {
+		var key apiDNSKEY
+		data, err := decodeDNSSECRecord(raw, &key)
+		if err != nil {
+			return DNSSEC{}, fmt.Errorf("invalid DNSKEY record: %w", err)
+		}
+		if data == "" {
+			if key.Protocol == 0 {
+				key.Protocol = 3
+			}
+			data = fmt.Sprintf("%d %d %d %s", key.Flags, key.Protocol, key.Algorithm, key.PublicKey)
+		}
+		result.DNSKEY = append(result.DNSKEY, libdns.RR{Name: apexName, Type: "DNSKEY", Data: data})
+	}
+	for _, raw := range state.DS {
+		var ds apiDS
+		data, err := decodeDNSSECRecord(raw, &ds)
+		if err != nil {
+			return DNSSEC{}, fmt.Errorf("invalid DS record: %w", err)
+		}
+		if data == "" {
+			data = fmt.Sprintf("%d %d %d %s", ds.KeyTag, ds.Algorithm, ds.DigestType, strings.ToUpper(ds.Digest))
+		}
+		result.DS = append(result.DS, libdns.RR{Name: apexName, Type: "DS", Data: data})
+	}
+
+	if len(result.DS) == 0 {
+		origin := dns.Fqdn(normalizeZone(zone))
+		for _, rr := range result.DNSKEY {
+			parsed, err := dns.NewRR(origin + " IN DNSKEY " + rr.Data)
+			if err != nil {
+				return DNSSEC{}, fmt.Errorf("invalid DNSKEY record %q: %w", rr.Data, err)
+			}
+			key := parsed.(*dns.DNSKEY)
+			if key.Flags&dns.SEP == 0 {
+				continue
+			}
+			if ds := key.ToDS(dns.SHA256); ds != nil {
+				data := strings.TrimPrefix(ds.String(), ds.Hdr.String())
+				result.DS = append(result.DS, libdns.RR{Name: apexName, Type: "DS", Data: data})
+			}
+		}
+	}
+	return result, nil
+}
+
+// decodeDNSSECRecord decodes a record given either in presentation format,
+// returned as is, or as an object decoded into object
+func decodeDNSSECRecord(raw json.RawMessage, object interface{}) (string, error) {
+	var data string
+	if err := json.Unmarshal(raw, &data); err == nil {
+		return strings.Join(strings.Fields(data), " "), nil
+	}
+	return "", json.Unmarshal(raw, object)
+}
@@ -0,0 +1,165 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+	"golang.org/x/sync/errgroup"
+)
+
+// driftQueries is the maximum number of DNS queries sent concurrently by
+// DetectDrift
+const driftQueries = 8
+
+// RecordDrift is a difference between an RRset as recorded by the API and
+// as served by an authoritative nameserver, see DetectDrift.
+type RecordDrift struct {
+	// Nameserver is the "host:port" address of the nameserver
+	Nameserver string
+
+	// Name and Type identify the RRset, Name being relative to the zone
+	Name string
+	Type string
+
+	// Missing are the values of the RRset in the API that the nameserver
+	// doesn't serve, e.g. not propagated yet or lost by the backend
+	Missing []string
+
+	// Stale are the values served by the nameserver that the RRset in the
+	// API doesn't hold anymore
+	Stale []string
+}
+
+// DetectDrift queries the authoritative nameservers of zone, see
+// Nameservers, for each RRset of the zone in the API and returns the
+// differences between their answers and the API records, sorted by name,
+// type and nameserver; none if every nameserver serves exactly the records
+// of the API. Values are compared like WaitForPropagation does, and TTLs
+// are ignored. SOA records, which nameservers rewrite, are skipped, and
+// records served at names or types the API doesn't know of can't be found.
+//
+// Failed queries don't stop the detection: the drift found is returned
+// along with an error joining the failures.
+func (p *Provider) DetectDrift(ctx context.Context, zone string) ([]RecordDrift, error) {
+	records, err := p.fetchRecords(ctx, zone)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching current records: %w", err)
+	}
+	origin := dns.Fqdn(normalizeZone(zone))
+	nameservers, err := p.zoneNameservers(ctx, origin)
+	if err != nil {
+		return nil, err
+	}
+
+	rrsets := make(map[rrsetKey][]string)
+	var keys []rrsetKey
+	for _, record := range records {
+		rr := record.RR()
+		key := keyOf(rr)
+		if _, ok := dns.StringToType[key.rtype]; !ok || key.rtype == "SOA" {
+			continue
+		}
+		if _, ok := rrsets[key]; !ok {
+			keys = append(keys, key)
+		}
+		rrsets[key] = append(rrsets[key], rr.Data)
+	}
+
+	var (
+		mu     sync.Mutex
+		drifts []RecordDrift
+		errs   []error
+	)
+	var g errgroup.Group
+	g.SetLimit(driftQueries)
+	for _, key := range keys {
+		for _, ns := range nameservers {
+			key, ns := key, ns
+			g.Go(func() error {
+				name := libdns.AbsoluteName(key.name, origin)
+				served, err := queryRRset(ctx, ns, name, dns.StringToType[key.rtype], false, origin)
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					errs = append(errs, fmt.Errorf("error querying %s for %s %s: %w", ns, name, key.rtype, err))
+					return nil
+				}
+				if drift, ok := compareRRset(key, rrsets[key], served); ok {
+					drift.Nameserver = ns
+					drifts = append(drifts, drift)
+				}
+				return nil
+			})
+		}
+	}
+	g.Wait()
+	p.logDebug(ctx, "drift detection", "zone", zone, "rrsets", len(keys), "nameservers", len(nameservers), "drifts", len(drifts))
+
+	sort.Slice(drifts, func(i, j int) bool {
+		a, b := drifts[i], drifts[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.Nameserver < b.Nameserver
+	})
+	return drifts, errors.Join(errs...)
+}
+
+// compareRRset compares the values of the RRset with the given key in the
+// API with the records served, and reports whether they differ
+func compareRRset(key rrsetKey, values []string, served []libdns.RR) (RecordDrift, bool) {
+	wanted := make([]string, 0, len(values))
+	for _, value := range values {
+		// Render the data like libdns does, e.g. for IPv6 addresses
+		wanted = append(wanted, parseRR(libdns.RR{Name: key.name, Type: key.rtype, Data: value}).RR().Data)
+	}
+	got := make([]string, 0, len(served))
+	for _, rr := range served {
+		got = append(got, rr.Data)
+	}
+
+	drift := RecordDrift{Name: key.name, Type: key.rtype}
+	for _, data := range wanted {
+		if !containsData(key.rtype, got, data) {
+			drift.Missing = append(drift.Missing, data)
+		}
+	}
+	for _, data := range got {
+		if !containsData(key.rtype, wanted, data) {
+			drift.Stale = append(drift.Stale, data)
+		}
+	}
+	return drift, len(drift.Missing) > 0 || len(drift.Stale) > 0
+}
+
+// containsData reports whether values hold data, compared with sameData
+func containsData(rtype string, values []string, data string) bool {
+	for _, value := range values {
+		if sameData(rtype, value, data) {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns a one-line description of the drift.
+func (d RecordDrift) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s on %s:", d.Name, d.Type, d.Nameserver)
+	if len(d.Missing) > 0 {
+		fmt.Fprintf(&b, " missing %q", d.Missing)
+	}
+	if len(d.Stale) > 0 {
+		fmt.Fprintf(&b, " stale %q", d.Stale)
+	}
+	return b.String()
+}
@@ -0,0 +1,112 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// DynamicUpdateConfig is the nameserver AppendRecords and DeleteRecords
+// fall back to when the API is unreachable, see DynamicUpdate.
+type DynamicUpdateConfig struct {
+	// Nameserver is the primary nameserver of the zones accepting RFC 2136
+	// updates, as "host" or "host:port", port 53 being the default
+	Nameserver string `json:"nameserver"`
+
+	// TSIG, if set, signs the updates; the nameserver should refuse
+	// unsigned ones.
+	TSIG *TSIGKey `json:"tsig,omitempty"`
+}
+
+// apiUnreachable reports whether err is the failure of a request that got
+// no response, or a 5xx one, once retries and endpoints are exhausted,
+// rather than a refusal of the API or the cancellation of ctx
+func apiUnreachable(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	var transportErr *transportError
+	if errors.As(err, &transportErr) {
+		return true
+	}
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode >= http.StatusInternalServerError
+}
+
+// updateFallback writes records to zone with a DNS UPDATE when err, the
+// error of the API write that wrote nothing, says the API is unreachable
+// and DynamicUpdate is set, clamping added TTLs to limits like the API
+// path; it returns written and err otherwise. It reports whether the
+// update was used, so that follow-up writes skip the API too.
+func (p *Provider) updateFallback(ctx context.Context, zone string, records, written []libdns.Record, err error, remove bool, limits ttlLimits) ([]libdns.Record, bool, error) {
+	if p.DynamicUpdate == nil || len(written) > 0 || !apiUnreachable(ctx, err) {
+		return written, false, err
+	}
+	p.logInfo(ctx, "immosquare API unreachable, falling back to DNS UPDATE",
+		"zone", zone, "nameserver", p.DynamicUpdate.Nameserver, "error", err)
+	updated, updateErr := p.dynamicUpdate(ctx, zone, records, remove, limits)
+	if updateErr != nil {
+		return nil, false, errors.Join(err, fmt.Errorf("DNS UPDATE fallback error: %w", updateErr))
+	}
+	return updated, true, nil
+}
+
+// dynamicUpdate adds records to zone, or removes them if remove, with a
+// single RFC 2136 UPDATE sent to the DynamicUpdate nameserver. Added
+// records have their TTL clamped to limits. Removed records without data
+// remove the whole RRset of their type, or every RRset of their name
+// without type. It returns the records added or removed.
+func (p *Provider) dynamicUpdate(ctx context.Context, zone string, records []libdns.Record, remove bool, limits ttlLimits) ([]libdns.Record, error) {
+	origin := dns.Fqdn(normalizeZone(zone))
+	msg := new(dns.Msg)
+	msg.SetUpdate(origin)
+	updated := make([]libdns.Record, 0, len(records))
+	for _, record := range records {
+		rr := record.RR()
+		name := libdns.AbsoluteName(normalizeName(rr.Name), origin)
+		switch {
+		case remove && rr.Type == "":
+			msg.RemoveName([]dns.RR{&dns.ANY{Hdr: dns.RR_Header{Name: name}}})
+		case remove && rr.Data == "":
+			rtype, ok := dns.StringToType[strings.ToUpper(rr.Type)]
+			if !ok {
+				return nil, fmt.Errorf("unknown record type %q", rr.Type)
+			}
+			msg.RemoveRRset([]dns.RR{&dns.ANY{Hdr: dns.RR_Header{Name: name, Rrtype: rtype}}})
+		case remove:
+			dnsRR, err := toDNSRR(rr, origin)
+			if err != nil {
+				return nil, err
+			}
+			msg.Remove([]dns.RR{dnsRR})
+		default:
+			rr.TTL = limits.clamp(rr.TTL)
+			dnsRR, err := toDNSRR(rr, origin)
+			if err != nil {
+				return nil, err
+			}
+			msg.Insert([]dns.RR{dnsRR})
+			record = parseRR(rr)
+		}
+		updated = append(updated, record)
+	}
+
+	client := &dns.Client{Net: "tcp", Timeout: dnsQueryTimeout}
+	if p.DynamicUpdate.TSIG != nil {
+		client.TsigSecret = p.DynamicUpdate.TSIG.sign(msg)
+	}
+	address := nameserverAddresses([]string{p.DynamicUpdate.Nameserver})[0]
+	resp, _, err := client.ExchangeContext(ctx, msg, address)
+	if err != nil {
+		return nil, fmt.Errorf("error sending the update to %s: %w", address, err)
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return nil, fmt.Errorf("update refused by %s: %s", address, dns.RcodeToString[resp.Rcode])
+	}
+	return updated, nil
+}
@@ -0,0 +1,248 @@
+package libdnsimmosquare_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+
+	libdnsimmosquare "github.com/immosquare/libdns-immosquare"
+	"github.com/immosquare/libdns-immosquare/immosquaretest"
+)
+
+// nameserver is the primary nameserver of a zone, answering AXFR queries
+// and applying RFC 2136 updates, over TCP
+type nameserver struct {
+	addr   string
+	origin string
+	soa    dns.RR
+
+	mu  sync.Mutex
+	rrs []dns.RR
+}
+
+// newNameserver starts the nameserver of zone, holding records in
+// presentation format with names relative to zone
+func newNameserver(t *testing.T, zone string, records ...string) *nameserver {
+	t.Helper()
+	ns := &nameserver{origin: dns.Fqdn(zone)}
+	ns.soa = ns.parse(t, "@ 3600 IN SOA ns1 hostmaster 1 7200 3600 1209600 3600")
+	for _, record := range records {
+		ns.rrs = append(ns.rrs, ns.parse(t, record))
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns.addr = listener.Addr().String()
+	server := &dns.Server{
+		Listener: listener,
+		Handler:  ns,
+		MsgAcceptFunc: func(dns.Header) dns.MsgAcceptAction {
+			return dns.MsgAccept
+		},
+	}
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+	return ns
+}
+
+func (ns *nameserver) parse(t *testing.T, record string) dns.RR {
+	t.Helper()
+	rr, ok := dns.NewZoneParser(strings.NewReader(record), ns.origin, "").Next()
+	if !ok {
+		t.Fatalf("invalid record %q", record)
+	}
+	return rr
+}
+
+func (ns *nameserver) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	if req.Opcode == dns.OpcodeUpdate {
+		for _, rr := range req.Ns {
+			ns.update(rr)
+		}
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		w.WriteMsg(resp)
+		return
+	}
+	if len(req.Question) != 1 || req.Question[0].Qtype != dns.TypeAXFR {
+		resp := new(dns.Msg)
+		resp.SetRcode(req, dns.RcodeNotImplemented)
+		w.WriteMsg(resp)
+		return
+	}
+	envelopes := make(chan *dns.Envelope, 1)
+	envelopes <- &dns.Envelope{RR: append(append([]dns.RR{ns.soa}, ns.rrs...), ns.soa)}
+	close(envelopes)
+	new(dns.Transfer).Out(w, req, envelopes)
+}
+
+// update applies the update RR of an UPDATE message (RFC 2136 §2.5)
+func (ns *nameserver) update(rr dns.RR) {
+	hdr := rr.Header()
+	kept := ns.rrs[:0]
+	for _, existing := range ns.rrs {
+		same := strings.EqualFold(existing.Header().Name, hdr.Name)
+		switch hdr.Class {
+		case dns.ClassANY:
+			same = same && (hdr.Rrtype == dns.TypeANY || existing.Header().Rrtype == hdr.Rrtype)
+		case dns.ClassNONE:
+			deleted := dns.Copy(rr)
+			deleted.Header().Class = dns.ClassINET
+			deleted.Header().Ttl = existing.Header().Ttl
+			same = same && dns.IsDuplicate(existing, deleted)
+		default:
+			same = false
+		}
+		if !same {
+			kept = append(kept, existing)
+		}
+	}
+	ns.rrs = kept
+	if hdr.Class == dns.ClassINET {
+		ns.rrs = append(ns.rrs, rr)
+	}
+}
+
+// assertZone checks that the zone holds the records want, given as "name
+// type data" with data in presentation format, in any order
+func (ns *nameserver) assertZone(t *testing.T, want ...string) {
+	t.Helper()
+	ns.mu.Lock()
+	var got []string
+	for _, rr := range ns.rrs {
+		hdr := rr.Header()
+		data := strings.TrimPrefix(rr.String(), hdr.String())
+		got = append(got, libdns.RelativeName(hdr.Name, ns.origin)+" "+dns.TypeToString[hdr.Rrtype]+" "+data)
+	}
+	ns.mu.Unlock()
+	sort.Strings(got)
+	want = append([]string(nil), want...)
+	sort.Strings(want)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("records of %s:\n%s\nwant:\n%s", ns.origin, strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestDynamicUpdateFallback(t *testing.T) {
+	// A closed port: the API is unreachable
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := "http://" + listener.Addr().String()
+	listener.Close()
+
+	srv := immosquaretest.NewServer("token")
+	defer srv.Close()
+	srv.AddZone("example.com")
+	status := func(code int) string {
+		return newFront(t, srv, func(w http.ResponseWriter, r *http.Request) bool {
+			w.WriteHeader(code)
+			return true
+		}).URL
+	}
+
+	for _, test := range []struct {
+		name     string
+		endpoint string
+		fallback bool
+	}{
+		{"unreachable", closed, true},
+		{"5xx", status(http.StatusBadGateway), true},
+		// The API refused the write, which must not be forced through
+		{"4xx", status(http.StatusUnprocessableEntity), false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ns := newNameserver(t, "example.com", "old 3600 IN A 192.0.2.1")
+			provider := libdnsimmosquare.NewProvider(test.endpoint,
+				libdnsimmosquare.WithAPIToken("token"),
+				libdnsimmosquare.WithMaxRetries(-1),
+				libdnsimmosquare.WithDynamicUpdateFallback(ns.addr, nil),
+			)
+			ctx := context.Background()
+
+			added, addErr := provider.AppendRecords(ctx, "example.com", []libdns.Record{
+				libdns.TXT{Name: "_acme-challenge", Text: "token"},
+			})
+			_, deleteErr := provider.DeleteRecords(ctx, "example.com", []libdns.Record{libdns.RR{Name: "old"}})
+			if !test.fallback {
+				if addErr == nil || deleteErr == nil {
+					t.Errorf("errors = %v, %v, want the API errors", addErr, deleteErr)
+				}
+				ns.assertZone(t, "old A 192.0.2.1")
+				return
+			}
+			if addErr != nil || deleteErr != nil {
+				t.Fatalf("errors = %v, %v, want none", addErr, deleteErr)
+			}
+			// The TTL is clamped like for the API
+			if len(added) != 1 || added[0].RR().TTL != 2*time.Minute {
+				t.Errorf("added = %v, want the record with a TTL of 2m", added)
+			}
+			ns.assertZone(t, `_acme-challenge TXT "token"`)
+		})
+	}
+}
+
+func TestDynamicUpdateFallbackOwnership(t *testing.T) {
+	ns := newNameserver(t, "example.com",
+		"www 3600 IN A 192.0.2.1",
+		`_owner.www 3600 IN TXT "heritage=libdns-immosquare,owner=me,type=A"`,
+		"other 3600 IN A 192.0.2.2",
+		`_owner.other 3600 IN TXT "heritage=libdns-immosquare,owner=other,type=A"`,
+	)
+	// A closed port: the API is unreachable
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := "http://" + listener.Addr().String()
+	listener.Close()
+	provider := libdnsimmosquare.NewProvider(closed,
+		libdnsimmosquare.WithAPIToken("token"),
+		libdnsimmosquare.WithMaxRetries(-1),
+		libdnsimmosquare.WithOwnership("me", ""),
+		libdnsimmosquare.WithDynamicUpdateFallback(ns.addr, nil),
+	)
+	ctx := context.Background()
+
+	// The ownership markers are transferred from the nameserver, and
+	// written along with the RRsets of this owner
+	if _, err := provider.DeleteRecords(ctx, "example.com", []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.1")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.AppendRecords(ctx, "example.com", []libdns.Record{
+		libdns.Address{Name: "api", IP: netip.MustParseAddr("192.0.2.3"), TTL: time.Hour},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// The RRsets of other owners are still left alone
+	if _, err := provider.AppendRecords(ctx, "example.com", []libdns.Record{
+		libdns.Address{Name: "other", IP: netip.MustParseAddr("192.0.2.4"), TTL: time.Hour},
+	}); !errors.Is(err, libdnsimmosquare.ErrNotOwned) {
+		t.Errorf("err = %v, want ErrNotOwned", err)
+	}
+
+	ns.assertZone(t,
+		"other A 192.0.2.2",
+		`_owner.other TXT "heritage=libdns-immosquare,owner=other,type=A"`,
+		"api A 192.0.2.3",
+		`_owner.api TXT "heritage=libdns-immosquare,owner=me,type=A"`,
+	)
+}
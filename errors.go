@@ -0,0 +1,301 @@
+package libdnsimmosquare
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Sentinel errors matched by the errors returned for API failures, so that
+// callers can tell failure classes apart with errors.Is:
+//
+//	if errors.Is(err, libdnsimmosquare.ErrUnauthorized) {
+//		// check the API token
+//	}
+var (
+	// ErrZoneNotFound is matched by 404 responses with the zone_not_found
+	// error code or no code at all
+	ErrZoneNotFound = errors.New("zone not found")
+	// ErrRecordNotFound is matched by 404 responses with the
+	// record_not_found error code
+	ErrRecordNotFound = errors.New("record not found")
+	// ErrUnauthorized is matched by 401 and 403 responses: the credentials
+	// are invalid or don't grant access to the resource
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrRateLimited is matched by 429 responses, once retries are exhausted
+	ErrRateLimited = errors.New("rate limited")
+	// ErrConflict is matched by 409 responses, e.g. for a record that
+	// already exists
+	ErrConflict = errors.New("conflict")
+	// ErrInvalidRecord is matched by the errors of records rejected by the
+	// checks made before a write is sent, see InvalidRecordError
+	ErrInvalidRecord = errors.New("invalid record")
+	// ErrSPFLookupLimit is matched by the error of MergeSPF when the merged
+	// SPF record would need more than 10 DNS lookups (RFC 7208 §4.6.4)
+	ErrSPFLookupLimit = errors.New("too many SPF lookups")
+	// ErrNotOwned is matched by the errors of writes refused in the
+	// ownership mode because they would change records not owned by the
+	// provider, see OwnerID
+	ErrNotOwned = errors.New("records not owned")
+)
+
+// statusError returns the sentinel error matching an API failure with the
+// given status and error code, nil if none does
+func statusError(status int, code string) error {
+	switch status {
+	case http.StatusNotFound:
+		switch code {
+		case "", "zone_not_found":
+			return ErrZoneNotFound
+		case "record_not_found":
+			return ErrRecordNotFound
+		}
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrUnauthorized
+	case http.StatusTooManyRequests:
+		return ErrRateLimited
+	case http.StatusConflict:
+		return ErrConflict
+	}
+	return nil
+}
+
+// maxErrorBodySize bounds how much of an error response body is read.
+const maxErrorBodySize = 64 << 10
+
+// APIError is returned when the immosquare API answers with an unexpected
+// HTTP status. Use errors.As to inspect it:
+//
+//	var apiErr *libdnsimmosquare.APIError
+//	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+//		// ...
+//	}
+type APIError struct {
+	// StatusCode is the HTTP status code of the response
+	StatusCode int
+	// Status is the HTTP status line, e.g. "404 Not Found"
+	Status string
+	// Code is the machine-readable error code from the JSON error body, if any
+	Code string
+	// Message is the human-readable error message from the JSON error body, if any
+	Message string
+	// RequestID identifies the request in the server logs: the X-Request-Id
+	// header or request_id field of the response if any, otherwise the
+	// X-Request-Id the request was sent with
+	RequestID string
+}
+
+// Error implements the error interface.
+func (e *APIError) Error() string {
+	var b strings.Builder
+	b.WriteString("API error: ")
+	if e.Status != "" {
+		b.WriteString(e.Status)
+	} else {
+		fmt.Fprintf(&b, "%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	if e.Code != "" {
+		b.WriteString(" [" + e.Code + "]")
+	}
+	if e.Message != "" {
+		b.WriteString(": " + e.Message)
+	}
+	if e.RequestID != "" {
+		b.WriteString(" (request ID " + e.RequestID + ")")
+	}
+	return b.String()
+}
+
+// Is reports whether e matches target, one of the sentinel errors such as
+// ErrZoneNotFound.
+func (e *APIError) Is(target error) bool {
+	sentinel := statusError(e.StatusCode, e.Code)
+	return sentinel != nil && sentinel == target
+}
+
+// IsRetryable reports whether the failure is transient: a 429 or 5xx
+// response.
+func (e *APIError) IsRetryable() bool {
+	return retryableStatus(e.StatusCode)
+}
+
+// Temporary is the same as IsRetryable.
+func (e *APIError) Temporary() bool {
+	return e.IsRetryable()
+}
+
+// transportError is returned when a request couldn't get a response, e.g.
+// because of a network error
+type transportError struct {
+	err       error
+	requestID string
+}
+
+// Error implements the error interface.
+func (e *transportError) Error() string {
+	return fmt.Sprintf("%v (request ID %s)", e.err, e.requestID)
+}
+
+// Unwrap returns the error of the HTTP client.
+func (e *transportError) Unwrap() error {
+	return e.err
+}
+
+// IsRetryable reports whether the failure is transient, which is the case
+// of most network errors but not of certificate verification failures.
+func (e *transportError) IsRetryable() bool {
+	return retryableTransportError(e.err)
+}
+
+// Temporary is the same as IsRetryable.
+func (e *transportError) Temporary() bool {
+	return e.IsRetryable()
+}
+
+// maxErrorTextSize bounds the excerpt of a plain-text error body used as
+// the error message
+const maxErrorTextSize = 256
+
+// apiErrorBody covers the error payload shapes returned by the API:
+//
+//	{"error": {"code": "...", "message": "..."}}
+//	{"error": "...", "code": "..."}
+//	{"code": "...", "message": "..."}
+//	{"errors": ["...", ...]} or {"errors": {"field": ["...", ...]}}
+//	{"type": "...", "title": "...", "detail": "..."} (RFC 9457 problem details)
+type apiErrorBody struct {
+	Error     json.RawMessage `json:"error"`
+	Errors    json.RawMessage `json:"errors"`
+	Code      string          `json:"code"`
+	Message   string          `json:"message"`
+	Title     string          `json:"title"`
+	Detail    string          `json:"detail"`
+	RequestID string          `json:"request_id"`
+}
+
+// newAPIError builds an APIError from a non-successful response. It reads
+// (a bounded amount of) the response body but does not close it.
+func newAPIError(resp *http.Response) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		RequestID:  responseRequestID(resp),
+	}
+
+	bodyBytes, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	if err != nil || len(bodyBytes) == 0 {
+		return apiErr
+	}
+
+	var body apiErrorBody
+	if err := json.Unmarshal(bodyBytes, &body); err != nil {
+		apiErr.Message = errorText(resp.Header.Get("Content-Type"), bodyBytes)
+		return apiErr
+	}
+	apiErr.Code = body.Code
+	apiErr.Message = body.Message
+	if body.RequestID != "" && resp.Header.Get(requestIDHeader) == "" {
+		apiErr.RequestID = body.RequestID
+	}
+
+	apiErr.Code, apiErr.Message = decodeErrorField(body.Error, apiErr.Code, apiErr.Message)
+	if apiErr.Message == "" {
+		apiErr.Message = firstNonEmpty(body.Detail, decodeErrorsField(body.Errors), body.Title)
+	}
+	return apiErr
+}
+
+// decodeErrorsField decodes an "errors" field, either a list of messages or
+// of {"message"} objects, or validation messages by field, into a single
+// message
+func decodeErrorsField(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var list []json.RawMessage
+	var byField map[string][]string
+	var messages []string
+	if err := json.Unmarshal(raw, &list); err == nil {
+		for _, item := range list {
+			var text string
+			var object struct {
+				Message string `json:"message"`
+				Detail  string `json:"detail"`
+			}
+			if err := json.Unmarshal(item, &text); err == nil {
+				messages = append(messages, text)
+			} else if err := json.Unmarshal(item, &object); err == nil {
+				messages = append(messages, firstNonEmpty(object.Message, object.Detail))
+			}
+		}
+	} else if err := json.Unmarshal(raw, &byField); err == nil {
+		fields := make([]string, 0, len(byField))
+		for field := range byField {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			for _, message := range byField[field] {
+				messages = append(messages, field+" "+message)
+			}
+		}
+	}
+	nonEmpty := messages[:0]
+	for _, message := range messages {
+		if message != "" {
+			nonEmpty = append(nonEmpty, message)
+		}
+	}
+	return strings.Join(nonEmpty, "; ")
+}
+
+// errorText returns an excerpt of a plain-text error body, collapsed to a
+// single line, or an empty string for other bodies (e.g. the HTML error
+// page of a proxy)
+func errorText(contentType string, body []byte) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType != "" && mediaType != "text/plain" {
+		return ""
+	}
+	if !utf8.Valid(body) || strings.HasPrefix(strings.TrimSpace(string(body)), "<") {
+		return ""
+	}
+	text := strings.Join(strings.Fields(string(body)), " ")
+	if len(text) > maxErrorTextSize {
+		text = strings.ToValidUTF8(text[:maxErrorTextSize], "") + "..."
+	}
+	return text
+}
+
+// decodeErrorField decodes an "error" field, either a message string or a
+// {"code", "message"} object, overriding the given code and message. A
+// string only sets the message when none is given.
+func decodeErrorField(raw json.RawMessage, code, message string) (string, string) {
+	if len(raw) == 0 {
+		return code, message
+	}
+	var nested struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		if message == "" {
+			message = text
+		}
+	} else if err := json.Unmarshal(raw, &nested); err == nil {
+		if nested.Code != "" {
+			code = nested.Code
+		}
+		if nested.Message != "" {
+			message = nested.Message
+		}
+	}
+	return code, message
+}
@@ -0,0 +1,75 @@
+package libdnsimmosquare
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+)
+
+// maxCachedPages bounds the number of pages kept by pageCache, so that a
+// long-lived provider reading many zones doesn't hold all of them in memory
+const maxCachedPages = 100
+
+// pageCache remembers the last GetRecords page returned for each path along
+// with its validators, so the next request can be made conditional. Only
+// the maxCachedPages most recently used pages are kept.
+type pageCache struct {
+	mu    sync.Mutex
+	pages map[string]*list.Element
+	// lru holds the cachedPages, most recently used first
+	lru list.List
+}
+
+// cachedPage is a decoded page and the validators of the response it came
+// from
+type cachedPage struct {
+	path         string
+	etag         string
+	lastModified string
+	page         *recordsPage
+}
+
+// conditionalHeader returns the cached page for path, if any, and the
+// If-None-Match/If-Modified-Since headers to send with its next request
+func (c *pageCache) conditionalHeader(path string) (*recordsPage, http.Header) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.pages[path]
+	if !ok {
+		return nil, nil
+	}
+	c.lru.MoveToFront(element)
+	cached := element.Value.(*cachedPage)
+	header := make(http.Header)
+	if cached.etag != "" {
+		header.Set("If-None-Match", cached.etag)
+	} else {
+		header.Set("If-Modified-Since", cached.lastModified)
+	}
+	return cached.page, header
+}
+
+// store caches page for path when resp carries an ETag or Last-Modified
+// header, and forgets it otherwise, evicting the least recently used page
+// when the cache is full
+func (c *pageCache) store(path string, resp *http.Response, page *recordsPage) {
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.pages[path]; ok {
+		c.lru.Remove(element)
+		delete(c.pages, path)
+	}
+	if etag == "" && lastModified == "" {
+		return
+	}
+	if c.pages == nil {
+		c.pages = make(map[string]*list.Element)
+	}
+	c.pages[path] = c.lru.PushFront(&cachedPage{path: path, etag: etag, lastModified: lastModified, page: page})
+	for c.lru.Len() > maxCachedPages {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.pages, oldest.Value.(*cachedPage).path)
+	}
+}
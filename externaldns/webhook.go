@@ -0,0 +1,346 @@
+// Package externaldns implements the webhook provider API of Kubernetes
+// external-dns on top of the libdns-immosquare provider, so clusters can
+// manage immosquare DNS records through external-dns with
+// --provider=webhook.
+//
+//	webhook := &externaldns.Webhook{
+//		Provider: provider,
+//		Zones:    []string{"example.com"},
+//	}
+//	http.ListenAndServe("localhost:8888", webhook)
+package externaldns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+
+	libdnsimmosquare "github.com/immosquare/libdns-immosquare"
+)
+
+// MediaType is the content type of the requests and responses of the
+// webhook provider API
+const MediaType = "application/external.dns.webhook+json;version=1"
+
+// recordTypes are the record types managed by external-dns; records of
+// other types are not reported
+var recordTypes = map[string]bool{
+	"A": true, "AAAA": true, "CNAME": true, "TXT": true, "SRV": true,
+	"NS": true, "PTR": true, "MX": true, "NAPTR": true,
+}
+
+// hostTargetTypes are the record types whose targets end with a host
+// name, reported without trailing dot like external-dns does
+var hostTargetTypes = map[string]bool{
+	"CNAME": true, "NS": true, "PTR": true, "MX": true, "SRV": true,
+}
+
+// Endpoint is an RRset as exchanged with external-dns.
+type Endpoint struct {
+	DNSName          string                     `json:"dnsName"`
+	Targets          []string                   `json:"targets"`
+	RecordType       string                     `json:"recordType"`
+	SetIdentifier    string                     `json:"setIdentifier,omitempty"`
+	RecordTTL        int64                      `json:"recordTTL,omitempty"`
+	Labels           map[string]string          `json:"labels,omitempty"`
+	ProviderSpecific []ProviderSpecificProperty `json:"providerSpecific,omitempty"`
+}
+
+// ProviderSpecificProperty is a provider-specific setting of an Endpoint.
+// None is used by this provider.
+type ProviderSpecificProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Changes are the changes external-dns asks to apply. UpdateOld and
+// UpdateNew hold the current and desired versions of the updated RRsets.
+type Changes struct {
+	Create    []*Endpoint `json:"Create,omitempty"`
+	UpdateOld []*Endpoint `json:"UpdateOld,omitempty"`
+	UpdateNew []*Endpoint `json:"UpdateNew,omitempty"`
+	Delete    []*Endpoint `json:"Delete,omitempty"`
+}
+
+// DomainFilter is the set of domains managed by the webhook, returned by
+// the negotiation.
+type DomainFilter struct {
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// Webhook is an http.Handler serving the external-dns webhook provider
+// API:
+//
+//   - GET / negotiates, returning the managed zones as domain filter
+//   - GET /records returns the RRsets of the managed zones
+//   - POST /records applies changes, deleting RRsets with DeleteRecords
+//     and writing the created and updated ones with SetRecords, zone by
+//     zone
+//   - POST /adjustendpoints normalizes desired endpoints like the
+//     records returned by GET /records
+//   - GET /healthz answers 200 OK, for liveness and readiness probes
+//
+// external-dns expects the webhook on localhost:8888 by default.
+type Webhook struct {
+	// Provider manages the records
+	Provider *libdnsimmosquare.Provider
+
+	// Zones are the zones managed by external-dns; all those of the
+	// account, listed with ListZones, if empty.
+	Zones []string
+
+	// Timeout bounds the handling of a request, 1m if zero.
+	Timeout time.Duration
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Webhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = time.Minute
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	switch {
+	case r.URL.Path == "/healthz" && r.Method == http.MethodGet:
+		w.Write([]byte("ok"))
+	case r.URL.Path == "/" && r.Method == http.MethodGet:
+		zones, err := h.zones(ctx)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, DomainFilter{Include: zones})
+	case r.URL.Path == "/records" && r.Method == http.MethodGet:
+		endpoints, err := h.Records(ctx)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, endpoints)
+	case r.URL.Path == "/records" && r.Method == http.MethodPost:
+		var changes Changes
+		if err := json.NewDecoder(r.Body).Decode(&changes); err != nil {
+			http.Error(w, fmt.Sprintf("invalid changes: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := h.ApplyChanges(ctx, &changes); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case r.URL.Path == "/adjustendpoints" && r.Method == http.MethodPost:
+		var endpoints []*Endpoint
+		if err := json.NewDecoder(r.Body).Decode(&endpoints); err != nil {
+			http.Error(w, fmt.Sprintf("invalid endpoints: %v", err), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, AdjustEndpoints(endpoints))
+	case r.URL.Path == "/" || r.URL.Path == "/records" || r.URL.Path == "/adjustendpoints" || r.URL.Path == "/healthz":
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Records returns the RRsets of the managed zones as endpoints, sorted by
+// name and type. SOA records and the types external-dns doesn't manage are
+// left out.
+func (h *Webhook) Records(ctx context.Context) ([]*Endpoint, error) {
+	zones, err := h.zones(ctx)
+	if err != nil {
+		return nil, err
+	}
+	endpoints := []*Endpoint{}
+	for _, zone := range zones {
+		records, err := h.Provider.GetRecords(ctx, zone)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching the records of %s: %w", zone, err)
+		}
+		byKey := make(map[string]*Endpoint)
+		for _, record := range records {
+			rr := record.RR()
+			rtype := strings.ToUpper(rr.Type)
+			if !recordTypes[rtype] {
+				continue
+			}
+			name := hostName(libdns.AbsoluteName(rr.Name, dns.Fqdn(zone)))
+			key := name + " " + rtype
+			endpoint := byKey[key]
+			if endpoint == nil {
+				endpoint = &Endpoint{DNSName: name, RecordType: rtype, RecordTTL: int64(rr.TTL.Seconds())}
+				byKey[key] = endpoint
+				endpoints = append(endpoints, endpoint)
+			}
+			endpoint.Targets = append(endpoint.Targets, target(rtype, rr.Data))
+		}
+	}
+	sort.SliceStable(endpoints, func(i, j int) bool {
+		if endpoints[i].DNSName != endpoints[j].DNSName {
+			return endpoints[i].DNSName < endpoints[j].DNSName
+		}
+		return endpoints[i].RecordType < endpoints[j].RecordType
+	})
+	return endpoints, nil
+}
+
+// AdjustEndpoints normalizes endpoints like Records returns them: names
+// lowercased and targets of host names without trailing dot, so
+// external-dns doesn't see differences where there are none.
+func AdjustEndpoints(endpoints []*Endpoint) []*Endpoint {
+	for _, endpoint := range endpoints {
+		endpoint.DNSName = hostName(endpoint.DNSName)
+		endpoint.RecordType = strings.ToUpper(endpoint.RecordType)
+		for i, value := range endpoint.Targets {
+			endpoint.Targets[i] = target(endpoint.RecordType, value)
+		}
+	}
+	if endpoints == nil {
+		return []*Endpoint{}
+	}
+	return endpoints
+}
+
+// ApplyChanges applies changes zone by zone: the deleted RRsets, and the
+// old versions of the updated ones that are not written again, are
+// deleted with DeleteRecords, then the created and updated RRsets are
+// written with SetRecords, replacing the current ones. It stops at the
+// first failure.
+func (h *Webhook) ApplyChanges(ctx context.Context, changes *Changes) error {
+	zones, err := h.zones(ctx)
+	if err != nil {
+		return err
+	}
+	toDelete := make(map[string][]libdns.Record)
+	toSet := make(map[string][]libdns.Record)
+	written := make(map[string]bool)
+	var order []string
+	for _, endpoint := range append(append([]*Endpoint{}, changes.Create...), changes.UpdateNew...) {
+		zone, records, err := toRecords(zones, endpoint)
+		if err != nil {
+			return err
+		}
+		if toSet[zone] == nil && toDelete[zone] == nil {
+			order = append(order, zone)
+		}
+		toSet[zone] = append(toSet[zone], records...)
+		written[hostName(endpoint.DNSName)+" "+strings.ToUpper(endpoint.RecordType)] = true
+	}
+	for _, endpoint := range append(append([]*Endpoint{}, changes.Delete...), changes.UpdateOld...) {
+		if written[hostName(endpoint.DNSName)+" "+strings.ToUpper(endpoint.RecordType)] {
+			continue
+		}
+		zone, records, err := toRecords(zones, endpoint)
+		if err != nil {
+			return err
+		}
+		if toSet[zone] == nil && toDelete[zone] == nil {
+			order = append(order, zone)
+		}
+		toDelete[zone] = append(toDelete[zone], records...)
+	}
+
+	for _, zone := range order {
+		if len(toDelete[zone]) > 0 {
+			if _, err := h.Provider.DeleteRecords(ctx, zone, toDelete[zone]); err != nil {
+				return fmt.Errorf("error deleting records of %s: %w", zone, err)
+			}
+		}
+		if len(toSet[zone]) > 0 {
+			if _, err := h.Provider.SetRecords(ctx, zone, toSet[zone]); err != nil {
+				return fmt.Errorf("error writing records of %s: %w", zone, err)
+			}
+		}
+	}
+	return nil
+}
+
+// zones returns the managed zones, without trailing dot
+func (h *Webhook) zones(ctx context.Context) ([]string, error) {
+	names := h.Zones
+	if len(names) == 0 {
+		zones, err := h.Provider.ListZones(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error listing the zones: %w", err)
+		}
+		for _, zone := range zones {
+			names = append(names, zone.Name)
+		}
+	}
+	result := make([]string, 0, len(names))
+	for _, name := range names {
+		result = append(result, hostName(name))
+	}
+	return result, nil
+}
+
+// toRecords returns the zone endpoint belongs to, the most specific of
+// zones, and its records
+func toRecords(zones []string, endpoint *Endpoint) (string, []libdns.Record, error) {
+	name := dns.Fqdn(hostName(endpoint.DNSName))
+	var zone string
+	for _, candidate := range zones {
+		if dns.IsSubDomain(dns.Fqdn(candidate), name) && len(candidate) > len(zone) {
+			zone = candidate
+		}
+	}
+	if zone == "" {
+		return "", nil, fmt.Errorf("%s is not in a managed zone", endpoint.DNSName)
+	}
+
+	rtype := strings.ToUpper(endpoint.RecordType)
+	records := make([]libdns.Record, 0, len(endpoint.Targets))
+	for _, value := range endpoint.Targets {
+		if rtype == "TXT" && len(value) >= 2 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
+			// external-dns quotes the values of its TXT registry records
+			value = value[1 : len(value)-1]
+		}
+		records = append(records, libdns.RR{
+			Name: libdns.RelativeName(name, dns.Fqdn(zone)),
+			Type: rtype,
+			TTL:  time.Duration(endpoint.RecordTTL) * time.Second,
+			Data: value,
+		})
+	}
+	return zone, records, nil
+}
+
+// hostName returns name lowercased, without trailing dot
+func hostName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+// target returns the value of a record of type rtype as reported to
+// external-dns
+func target(rtype, value string) string {
+	if hostTargetTypes[rtype] {
+		return strings.TrimSuffix(value, ".")
+	}
+	return value
+}
+
+// writeJSON writes v as the JSON response
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", MediaType)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError answers a failed request, with 500 so external-dns retries
+// later, or 401 for rejected credentials
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, libdnsimmosquare.ErrUnauthorized) {
+		status = http.StatusUnauthorized
+	}
+	http.Error(w, err.Error(), status)
+}
@@ -0,0 +1,78 @@
+package libdnsimmosquare
+
+import (
+	"sync"
+	"time"
+)
+
+// endpointCooldown is how long an endpoint is avoided after failing, unless
+// all the others failed more
+const endpointCooldown = 30 * time.Second
+
+// endpoints returns Endpoint followed by FallbackEndpoints
+func (p *Provider) endpoints() []string {
+	return append([]string{p.Endpoint}, p.FallbackEndpoints...)
+}
+
+// endpointPool tracks the health of the configured endpoints, identified by
+// their index in endpoints(), so requests go to the healthiest one.
+type endpointPool struct {
+	mu     sync.Mutex
+	health []endpointHealth
+}
+
+// endpointHealth counts the consecutive failures of an endpoint
+type endpointHealth struct {
+	failures    int
+	lastFailure time.Time
+}
+
+// pick returns the index of the endpoint to send a request to among n,
+// skipping the ones in skip (unless all are): the one with the fewest
+// consecutive failures in the last endpointCooldown, the first configured
+// on ties.
+func (e *endpointPool) pick(n int, skip map[int]bool, now time.Time) int {
+	if n == 1 {
+		return 0
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.resize(n)
+	best, bestFailures := -1, 0
+	for i, health := range e.health {
+		if skip[i] {
+			continue
+		}
+		failures := health.failures
+		if now.Sub(health.lastFailure) >= endpointCooldown {
+			failures = 0
+		}
+		if best < 0 || failures < bestFailures {
+			best, bestFailures = i, failures
+		}
+	}
+	if best < 0 {
+		return 0
+	}
+	return best
+}
+
+// observe records whether a request to endpoint i failed
+func (e *endpointPool) observe(i int, failed bool, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.resize(i + 1)
+	if failed {
+		e.health[i].failures++
+		e.health[i].lastFailure = now
+	} else {
+		e.health[i].failures = 0
+	}
+}
+
+// resize makes room for n endpoints; e.mu must be held
+func (e *endpointPool) resize(n int) {
+	if len(e.health) < n {
+		e.health = append(e.health, make([]endpointHealth, n-len(e.health))...)
+	}
+}
@@ -1,8 +1,30 @@
 module github.com/immosquare/libdns-immosquare
 
-go 1.18
+go 1.21
 
-require github.com/libdns/libdns v1.0.0
+require (
+	github.com/libdns/libdns v1.0.0
+	github.com/miekg/dns v1.1.62
+	github.com/prometheus/client_golang v1.20.5
+	golang.org/x/oauth2 v0.26.0
+	golang.org/x/sync v0.11.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/kr/text v0.2.0 // indirect
+	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
+	github.com/prometheus/client_model v0.6.1 // indirect
+	github.com/prometheus/common v0.55.0 // indirect
+	github.com/prometheus/procfs v0.15.1 // indirect
+	golang.org/x/mod v0.18.0 // indirect
+	golang.org/x/net v0.27.0 // indirect
+	golang.org/x/sys v0.22.0 // indirect
+	golang.org/x/tools v0.22.0 // indirect
+	google.golang.org/protobuf v1.34.2 // indirect
+)
 
 retract v1.0.0 
 retract v1.0.1 
@@ -0,0 +1,19 @@
+package libdnsimmosquare
+
+import "net/http"
+
+// defaultUserAgent identifies the provider to the API unless UserAgent is set
+const defaultUserAgent = "libdns-immosquare/" + Version
+
+// setStaticHeaders sets the User-Agent and the configured Headers on req.
+// Headers set afterwards by makeRequest take precedence.
+func (p *Provider) setStaticHeaders(req *http.Request) {
+	userAgent := p.UserAgent
+	if userAgent == "" {
+		userAgent = defaultUserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+	for key, value := range p.Headers {
+		req.Header.Set(key, value)
+	}
+}
@@ -0,0 +1,257 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+const (
+	// defaultHealthCheckInterval is the delay between two health checks of
+	// a FailoverController when FailoverConfig.Interval is not set
+	defaultHealthCheckInterval = 30 * time.Second
+
+	// defaultHealthCheckTimeout bounds a health check when
+	// HealthCheck.Timeout is not set
+	defaultHealthCheckTimeout = 5 * time.Second
+
+	// defaultFailoverThreshold is the number of consecutive check results
+	// switching a FailoverController when the thresholds are not set
+	defaultFailoverThreshold = 3
+)
+
+// HealthCheck checks the health of a target, over HTTP(S) when URL is set
+// or with a TCP connection to Address otherwise.
+type HealthCheck struct {
+	// URL is requested with GET; the target is healthy if it answers with
+	// a 2xx or 3xx status (redirects are not followed)
+	URL string
+
+	// Address is the host:port a TCP connection is opened to; the target
+	// is healthy if the connection succeeds
+	Address string
+
+	// Timeout of each check (default 5s)
+	Timeout time.Duration
+}
+
+// check runs the health check and returns why the target is unhealthy, nil
+// if it's healthy
+func (hc HealthCheck) check(ctx context.Context) error {
+	timeout := hc.Timeout
+	if timeout <= 0 {
+		timeout = defaultHealthCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if hc.URL == "" {
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", hc.Address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, hc.URL, nil)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxErrorBodySize))
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return fmt.Errorf("unhealthy status %s", resp.Status)
+	}
+	return nil
+}
+
+// FailoverConfig configures a FailoverController.
+type FailoverConfig struct {
+	// Zone, Name and Type identify the RRset switched between Primary and
+	// Standby; Type is A, AAAA or CNAME
+	Zone string
+	Name string
+	Type string
+
+	// Primary is the value of the RRset while the primary target is
+	// healthy, e.g. an IP address or a CNAME target
+	Primary string
+
+	// Standby is the value of the RRset while the primary target is
+	// unhealthy
+	Standby string
+
+	// Check checks the health of the primary target
+	Check HealthCheck
+
+	// Interval is the delay between two checks (default 30s)
+	Interval time.Duration
+
+	// FailureThreshold is the number of consecutive failed checks after
+	// which the RRset is switched to Standby (default 3)
+	FailureThreshold int
+
+	// RecoveryThreshold is the number of consecutive successful checks
+	// after which the RRset is switched back to Primary (default 3)
+	RecoveryThreshold int
+
+	// OnSwitch, if set, is called after each switch with the new state
+	OnSwitch func(FailoverState)
+}
+
+// FailoverState is the state of a FailoverController, for observability.
+type FailoverState struct {
+	// Active is the value of the RRset, Primary or Standby
+	Active string
+	// OnStandby is set while the RRset is switched to Standby
+	OnStandby bool
+	// Healthy is the result of the last check of the primary target
+	Healthy bool
+	// Failures and Successes count the consecutive failed and successful
+	// checks
+	Failures  int
+	Successes int
+	// LastCheck is the time of the last check
+	LastCheck time.Time
+	// LastError is why the last check, or the last switch, failed
+	LastError error
+	// LastSwitch is the time of the last switch
+	LastSwitch time.Time
+}
+
+// FailoverController monitors the health of a primary target and switches
+// an A, AAAA or CNAME RRset to a standby target when it fails, and back
+// when it recovers. Create it with NewFailoverController and start it with
+// Run.
+type FailoverController struct {
+	provider *Provider
+	config   FailoverConfig
+
+	mu    sync.Mutex
+	state FailoverState
+}
+
+// NewFailoverController returns a controller switching the RRset described
+// by config. It doesn't check or write anything until Run is called.
+func (p *Provider) NewFailoverController(config FailoverConfig) (*FailoverController, error) {
+	config.Type = strings.ToUpper(config.Type)
+	if config.Type != "A" && config.Type != "AAAA" && config.Type != "CNAME" {
+		return nil, fmt.Errorf("unsupported failover record type %q: must be A, AAAA or CNAME", config.Type)
+	}
+	if config.Zone == "" || config.Primary == "" || config.Standby == "" {
+		return nil, errors.New("failover Zone, Primary and Standby are required")
+	}
+	if config.Check.URL == "" && config.Check.Address == "" {
+		return nil, errors.New("failover health check URL or Address is required")
+	}
+	if config.Interval <= 0 {
+		config.Interval = defaultHealthCheckInterval
+	}
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = defaultFailoverThreshold
+	}
+	if config.RecoveryThreshold <= 0 {
+		config.RecoveryThreshold = defaultFailoverThreshold
+	}
+	return &FailoverController{
+		provider: p,
+		config:   config,
+		state:    FailoverState{Active: config.Primary, Healthy: true},
+	}, nil
+}
+
+// State returns the current state of the controller. It may be called
+// concurrently with Run.
+func (c *FailoverController) State() FailoverState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+// Run checks the primary target every Interval and switches the RRset
+// until ctx is done, then returns ctx.Err(). It first reads the RRset, so a
+// controller restarted while on standby carries on from there. Failed
+// switches are retried at the next check.
+func (c *FailoverController) Run(ctx context.Context) error {
+	records, err := c.provider.LookupRecords(ctx, c.config.Zone, c.config.Name, c.config.Type)
+	if err != nil {
+		return fmt.Errorf("error reading the failover RRset: %w", err)
+	}
+	standby := parseRR(libdns.RR{Name: c.config.Name, Type: c.config.Type, Data: c.config.Standby}).RR().Data
+	for _, record := range records {
+		if strings.EqualFold(record.RR().Data, standby) {
+			c.mu.Lock()
+			c.state.Active, c.state.OnStandby = c.config.Standby, true
+			c.mu.Unlock()
+		}
+	}
+
+	for {
+		c.step(ctx)
+		if err := sleepContext(ctx, c.config.Interval); err != nil {
+			return err
+		}
+	}
+}
+
+// step runs a check and switches the RRset if a threshold is reached
+func (c *FailoverController) step(ctx context.Context) {
+	checkErr := c.config.Check.check(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+
+	c.mu.Lock()
+	state := &c.state
+	state.LastCheck, state.Healthy, state.LastError = time.Now(), checkErr == nil, checkErr
+	if checkErr == nil {
+		state.Successes++
+		state.Failures = 0
+	} else {
+		state.Failures++
+		state.Successes = 0
+	}
+	var target string
+	switch {
+	case !state.OnStandby && state.Failures >= c.config.FailureThreshold:
+		target = c.config.Standby
+	case state.OnStandby && state.Successes >= c.config.RecoveryThreshold:
+		target = c.config.Primary
+	}
+	c.mu.Unlock()
+	c.provider.logDebug(ctx, "failover health check", "zone", c.config.Zone, "name", c.config.Name, "healthy", checkErr == nil, "error", checkErr)
+	if target == "" {
+		return
+	}
+
+	_, err := c.provider.ReplaceRRSet(ctx, c.config.Zone, c.config.Name, c.config.Type, []string{target})
+	c.mu.Lock()
+	if err != nil {
+		state.LastError = fmt.Errorf("error switching to %s: %w", target, err)
+		c.mu.Unlock()
+		return
+	}
+	state.Active, state.OnStandby, state.LastSwitch = target, target == c.config.Standby, time.Now()
+	switched := *state
+	c.mu.Unlock()
+
+	c.provider.logInfo(ctx, "switched failover record", "zone", c.config.Zone, "name", c.config.Name, "type", c.config.Type, "value", target)
+	if c.config.OnSwitch != nil {
+		c.config.OnSwitch(switched)
+	}
+}
@@ -0,0 +1,192 @@
+package immosquaretest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// Mode selects whether a Recorder records or replays interactions
+type Mode int
+
+const (
+	// ModeReplay serves responses from the fixture file and fails requests
+	// that have no recorded interaction.
+	ModeReplay Mode = iota
+	// ModeRecord forwards requests to the real API and records them; call
+	// Save to write the fixture file.
+	ModeRecord
+)
+
+// Interaction is a recorded request/response pair. Request headers are not
+// recorded, so fixtures never contain credentials.
+type Interaction struct {
+	Request struct {
+		Method string `json:"method"`
+		// URL is the request path and query, without scheme and host, so
+		// fixtures can be replayed against any endpoint.
+		URL  string `json:"url"`
+		Body string `json:"body,omitempty"`
+	} `json:"request"`
+	Response struct {
+		StatusCode int         `json:"status_code"`
+		Header     http.Header `json:"header,omitempty"`
+		Body       string      `json:"body,omitempty"`
+	} `json:"response"`
+}
+
+// Recorder is a VCR-style http.RoundTripper recording real API interactions
+// to a JSON fixture file and replaying them deterministically:
+//
+//	rec, err := immosquaretest.NewRecorder("testdata/get_records.json", immosquaretest.ModeReplay)
+//	provider := libdnsimmosquare.NewProvider(endpoint, libdnsimmosquare.WithHTTPClient(rec.Client()))
+//
+// In replay mode, a request is matched with the first not yet replayed
+// interaction with the same method, path, query and body.
+type Recorder struct {
+	// Transport performs the real requests in ModeRecord, defaults to
+	// http.DefaultTransport.
+	Transport http.RoundTripper
+
+	mode Mode
+	path string
+
+	mu           sync.Mutex
+	interactions []Interaction
+	replayed     []bool
+}
+
+// NewRecorder returns a Recorder using the fixture file at path. In
+// ModeReplay, the file is loaded and must exist.
+func NewRecorder(path string, mode Mode) (*Recorder, error) {
+	r := &Recorder{mode: mode, path: path}
+	if mode == ModeReplay {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading fixture: %w", err)
+		}
+		if err := json.Unmarshal(data, &r.interactions); err != nil {
+			return nil, fmt.Errorf("decoding fixture %s: %w", path, err)
+		}
+		r.replayed = make([]bool, len(r.interactions))
+	}
+	return r, nil
+}
+
+// Client returns an HTTP client using the recorder as transport
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// RoundTrip implements http.RoundTripper
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	if r.mode == ModeRecord {
+		return r.record(req, body)
+	}
+	return r.replay(req, body)
+}
+
+// record performs req and stores the interaction
+func (r *Recorder) record(req *http.Request, body []byte) (*http.Response, error) {
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	var interaction Interaction
+	interaction.Request.Method = req.Method
+	interaction.Request.URL = req.URL.RequestURI()
+	interaction.Request.Body = string(body)
+	interaction.Response.StatusCode = resp.StatusCode
+	interaction.Response.Header = resp.Header.Clone()
+	interaction.Response.Header.Del("Set-Cookie")
+	interaction.Response.Header.Del("Date")
+	interaction.Response.Body = string(respBody)
+
+	r.mu.Lock()
+	r.interactions = append(r.interactions, interaction)
+	r.mu.Unlock()
+	return resp, nil
+}
+
+// replay serves the first matching interaction not yet replayed
+func (r *Recorder) replay(req *http.Request, body []byte) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, interaction := range r.interactions {
+		if r.replayed[i] ||
+			interaction.Request.Method != req.Method ||
+			interaction.Request.URL != req.URL.RequestURI() ||
+			interaction.Request.Body != string(body) {
+			continue
+		}
+		r.replayed[i] = true
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", interaction.Response.StatusCode, http.StatusText(interaction.Response.StatusCode)),
+			StatusCode:    interaction.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        interaction.Response.Header.Clone(),
+			Body:          io.NopCloser(bytes.NewReader([]byte(interaction.Response.Body))),
+			ContentLength: int64(len(interaction.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("no recorded interaction for %s %s", req.Method, req.URL.RequestURI())
+}
+
+// Save writes the recorded interactions to the fixture file. It is only
+// valid in ModeRecord.
+func (r *Recorder) Save() error {
+	if r.mode != ModeRecord {
+		return errors.New("recorder is not in record mode")
+	}
+	r.mu.Lock()
+	data, err := json.MarshalIndent(r.interactions, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(r.path, append(data, '\n'), 0o644)
+}
+
+// Unused returns the interactions that were not replayed, letting tests
+// assert that every recorded request was made.
+func (r *Recorder) Unused() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var unused []Interaction
+	for i, interaction := range r.interactions {
+		if !r.replayed[i] {
+			unused = append(unused, interaction)
+		}
+	}
+	return unused
+}
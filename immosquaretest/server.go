@@ -0,0 +1,683 @@
+// Package immosquaretest provides an in-memory fake of the immosquare DNS
+// API, backed by net/http/httptest, for testing code built on the
+// libdns-immosquare provider without touching real DNS.
+//
+//	srv := immosquaretest.NewServer("token")
+//	defer srv.Close()
+//	srv.AddZone("example.com")
+//	provider := srv.Provider()
+package immosquaretest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	libdnsimmosquare "github.com/immosquare/libdns-immosquare"
+	"github.com/miekg/dns"
+)
+
+// Record is a record stored by the fake server
+type Record struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+	TTL   int    `json:"ttl"`
+
+	// CreatedAt is set to the current time when zero
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Change is an entry of the audit trail of a zone, recorded for every
+// record created or deleted through the API
+type Change struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Actor     string    `json:"actor"`
+	Action    string    `json:"action"`
+	Record    Record    `json:"record"`
+}
+
+// Webhook is a webhook registered on a zone of the fake server
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Secret is never returned by the API
+	Secret string `json:"-"`
+}
+
+// changeActor is the actor of the changes made through the API
+const changeActor = "api"
+
+// Server is an in-memory implementation of the zones and records endpoints.
+// It is safe for concurrent use.
+type Server struct {
+	*httptest.Server
+
+	// Token is the bearer token required by the server; empty disables
+	// authentication.
+	Token string
+
+	// Async makes record writes answer 202 Accepted with a pending
+	// operation, reported as succeeded, with the result of the write, when
+	// polled at /operations/{id}.
+	Async bool
+
+	mu       sync.Mutex
+	zones    map[string][]Record
+	serials  map[string]uint32
+	changes  map[string][]Change
+	webhooks map[string][]Webhook
+	dnssec   map[string]*dns.DNSKEY
+	results  map[string]interface{}
+	nextID   int
+}
+
+// nameservers are reported as assigned to every zone
+var nameservers = []string{"ns1.immosquare.test", "ns2.immosquare.test"}
+
+// defaultTTL is reported as the default TTL of every zone
+const defaultTTL = 3600
+
+// NewServer starts a fake API server requiring token (empty for none).
+// Call Close when done.
+func NewServer(token string) *Server {
+	s := &Server{
+		Token:    token,
+		zones:    make(map[string][]Record),
+		serials:  make(map[string]uint32),
+		changes:  make(map[string][]Change),
+		webhooks: make(map[string][]Webhook),
+		dnssec:   make(map[string]*dns.DNSKEY),
+		results:  make(map[string]interface{}),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Provider returns a provider talking to the fake server, configured with
+// the server token and opts.
+func (s *Server) Provider(opts ...libdnsimmosquare.Option) *libdnsimmosquare.Provider {
+	opts = append([]libdnsimmosquare.Option{libdnsimmosquare.WithAPIToken(s.Token)}, opts...)
+	return libdnsimmosquare.NewProvider(s.URL, opts...)
+}
+
+// AddZone creates zone, if needed, and adds records to it. IDs and creation
+// times are assigned to records that have none.
+func (s *Server) AddZone(zone string, records ...Record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	zone = normalizeZone(zone)
+	if _, ok := s.zones[zone]; !ok {
+		s.zones[zone] = []Record{}
+	}
+	for _, record := range records {
+		s.zones[zone] = append(s.zones[zone], s.assignID(record))
+	}
+	s.serials[zone]++
+}
+
+// Webhooks returns a copy of the webhooks registered on zone, secrets
+// included
+func (s *Server) Webhooks(zone string) []Webhook {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Webhook{}, s.webhooks[normalizeZone(zone)]...)
+}
+
+// Records returns a copy of the records of zone, nil if it doesn't exist
+func (s *Server) Records(zone string) []Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records, ok := s.zones[normalizeZone(zone)]
+	if !ok {
+		return nil
+	}
+	return append([]Record{}, records...)
+}
+
+// assignID gives record an ID and a creation time if it has none; s.mu
+// must be held
+func (s *Server) assignID(record Record) Record {
+	if record.ID == "" {
+		s.nextID++
+		record.ID = strconv.Itoa(s.nextID)
+	}
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	}
+	return record
+}
+
+// serveHTTP routes requests to the zones and records endpoints, echoing
+// their X-Request-Id header
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if id := r.Header.Get("X-Request-Id"); id != "" {
+		w.Header().Set("X-Request-Id", id)
+	}
+	if s.Token != "" && r.Header.Get("Authorization") != "Bearer "+s.Token {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "invalid or missing API token")
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "zones" && r.Method == http.MethodGet:
+		s.listZones(w)
+	case len(parts) == 1 && parts[0] == "zones" && r.Method == http.MethodPost:
+		s.createZone(w, r)
+	case len(parts) == 2 && parts[0] == "zones" && r.Method == http.MethodGet:
+		s.getZone(w, normalizeZone(parts[1]))
+	case len(parts) == 2 && parts[0] == "zones" && r.Method == http.MethodDelete:
+		s.deleteZone(w, normalizeZone(parts[1]))
+	case len(parts) == 3 && parts[0] == "zones" && parts[2] == "changes" && r.Method == http.MethodGet:
+		s.listChanges(w, r, normalizeZone(parts[1]))
+	case len(parts) == 2 && parts[0] == "operations" && r.Method == http.MethodGet:
+		s.getOperation(w, parts[1])
+	case len(parts) == 3 && parts[0] == "zones" && parts[2] == "webhooks" && r.Method == http.MethodGet:
+		s.listWebhooks(w, normalizeZone(parts[1]))
+	case len(parts) == 3 && parts[0] == "zones" && parts[2] == "webhooks" && r.Method == http.MethodPost:
+		s.createWebhook(w, r, normalizeZone(parts[1]))
+	case len(parts) == 4 && parts[0] == "zones" && parts[2] == "webhooks" && r.Method == http.MethodDelete:
+		s.deleteWebhook(w, normalizeZone(parts[1]), parts[3])
+	case len(parts) == 3 && parts[0] == "zones" && parts[2] == "dnssec":
+		zone := normalizeZone(parts[1])
+		switch r.Method {
+		case http.MethodGet:
+			s.getDNSSEC(w, zone)
+		case http.MethodPost:
+			s.enableDNSSEC(w, zone)
+		case http.MethodDelete:
+			s.disableDNSSEC(w, zone)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", r.Method+" is not allowed")
+		}
+	case len(parts) == 3 && parts[0] == "zones" && parts[2] == "records":
+		zone := normalizeZone(parts[1])
+		switch r.Method {
+		case http.MethodGet:
+			s.getRecords(w, r, zone)
+		case http.MethodPost:
+			s.appendRecords(w, r, zone)
+		case http.MethodDelete:
+			s.deleteRecords(w, r, zone)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", r.Method+" is not allowed")
+		}
+	default:
+		writeError(w, http.StatusNotFound, "not_found", "no route for "+r.Method+" "+r.URL.Path)
+	}
+}
+
+func (s *Server) listZones(w http.ResponseWriter) {
+	s.mu.Lock()
+	names := make([]string, 0, len(s.zones))
+	for name := range s.zones {
+		names = append(names, name)
+	}
+	s.mu.Unlock()
+	sort.Strings(names)
+
+	zones := make([]map[string]string, 0, len(names))
+	for _, name := range names {
+		zones = append(zones, map[string]string{"name": name})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"zones": zones})
+}
+
+// createZone creates the zone named in the {"name": "..."} request body
+func (s *Server) createZone(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", err.Error())
+		return
+	}
+	name := normalizeZone(body.Name)
+	if name == "" {
+		writeError(w, http.StatusUnprocessableEntity, "invalid_zone", "name is required")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.zones[name]; ok {
+		writeError(w, http.StatusConflict, "zone_exists", "zone "+name+" already exists")
+		return
+	}
+	s.zones[name] = []Record{}
+	s.serials[name]++
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"zone": map[string]string{"name": name}})
+}
+
+// getZone returns the metadata of zone; its serial is incremented by every
+// change
+func (s *Server) getZone(w http.ResponseWriter, zone string) {
+	s.mu.Lock()
+	_, ok := s.zones[zone]
+	serial := s.serials[zone]
+	signed := s.dnssec[zone] != nil
+	s.mu.Unlock()
+	if !ok {
+		writeZoneNotFound(w, zone)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"zone": map[string]interface{}{
+		"name":        zone,
+		"serial":      serial,
+		"ttl":         defaultTTL,
+		"nameservers": nameservers,
+		"dnssec":      signed,
+	}})
+}
+
+// deleteZone deletes zone and its records
+func (s *Server) deleteZone(w http.ResponseWriter, zone string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.zones[zone]; !ok {
+		writeZoneNotFound(w, zone)
+		return
+	}
+	delete(s.zones, zone)
+	delete(s.serials, zone)
+	delete(s.changes, zone)
+	delete(s.webhooks, zone)
+	delete(s.dnssec, zone)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getRecords lists the records of zone, optionally only those matching the
+// name and type query parameters, with an ETag so clients can send
+// conditional requests
+func (s *Server) getRecords(w http.ResponseWriter, r *http.Request, zone string) {
+	records := s.Records(zone)
+	if records == nil {
+		writeZoneNotFound(w, zone)
+		return
+	}
+	query := r.URL.Query()
+	filtered := records[:0]
+	for _, record := range records {
+		if (query.Get("name") == "" || sameName(record.Name, query.Get("name"))) &&
+			(query.Get("type") == "" || strings.EqualFold(record.Type, query.Get("type"))) {
+			filtered = append(filtered, record)
+		}
+	}
+	records = filtered
+	body, _ := json.Marshal(map[string]interface{}{"records": records})
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// listChanges returns the changes of zone, optionally since the RFC 3339
+// time of the since query parameter and of the records matching the name
+// and type query parameters
+func (s *Server) listChanges(w http.ResponseWriter, r *http.Request, zone string) {
+	query := r.URL.Query()
+	var since time.Time
+	if value := query.Get("since"); value != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, value); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_since", err.Error())
+			return
+		}
+	}
+
+	s.mu.Lock()
+	_, ok := s.zones[zone]
+	changes := make([]Change, 0, len(s.changes[zone]))
+	for _, change := range s.changes[zone] {
+		if !change.CreatedAt.Before(since) &&
+			(query.Get("name") == "" || sameName(change.Record.Name, query.Get("name"))) &&
+			(query.Get("type") == "" || strings.EqualFold(change.Record.Type, query.Get("type"))) {
+			changes = append(changes, change)
+		}
+	}
+	s.mu.Unlock()
+	if !ok {
+		writeZoneNotFound(w, zone)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"changes": changes})
+}
+
+// logChange appends a change of record to the audit trail of zone; s.mu
+// must be held
+func (s *Server) logChange(zone, action string, record Record) {
+	s.nextID++
+	s.changes[zone] = append(s.changes[zone], Change{
+		ID:        strconv.Itoa(s.nextID),
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+		Actor:     changeActor,
+		Action:    action,
+		Record:    record,
+	})
+}
+
+// listWebhooks returns the webhooks registered on zone
+func (s *Server) listWebhooks(w http.ResponseWriter, zone string) {
+	s.mu.Lock()
+	_, ok := s.zones[zone]
+	webhooks := append([]Webhook{}, s.webhooks[zone]...)
+	s.mu.Unlock()
+	if !ok {
+		writeZoneNotFound(w, zone)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"webhooks": webhooks})
+}
+
+// createWebhook registers the webhook of the {"url", "events", "secret"}
+// request body on zone
+func (s *Server) createWebhook(w http.ResponseWriter, r *http.Request, zone string) {
+	var body struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+		Secret string   `json:"secret"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", err.Error())
+		return
+	}
+	if body.URL == "" {
+		writeError(w, http.StatusUnprocessableEntity, "invalid_webhook", "url is required")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.zones[zone]; !ok {
+		writeZoneNotFound(w, zone)
+		return
+	}
+	s.nextID++
+	webhook := Webhook{
+		ID:        strconv.Itoa(s.nextID),
+		URL:       body.URL,
+		Events:    body.Events,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+		Secret:    body.Secret,
+	}
+	s.webhooks[zone] = append(s.webhooks[zone], webhook)
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"webhook": webhook})
+}
+
+// deleteWebhook deletes the webhook with the given ID from zone
+func (s *Server) deleteWebhook(w http.ResponseWriter, zone, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.zones[zone]; !ok {
+		writeZoneNotFound(w, zone)
+		return
+	}
+	for i, webhook := range s.webhooks[zone] {
+		if webhook.ID == id {
+			s.webhooks[zone] = append(s.webhooks[zone][:i], s.webhooks[zone][i+1:]...)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "webhook_not_found", "webhook "+id+" not found")
+}
+
+// getDNSSEC returns the DNSSEC status of zone and, when it's signed, its
+// key signing key and the matching DS record
+func (s *Server) getDNSSEC(w http.ResponseWriter, zone string) {
+	s.mu.Lock()
+	_, ok := s.zones[zone]
+	key := s.dnssec[zone]
+	s.mu.Unlock()
+	if !ok {
+		writeZoneNotFound(w, zone)
+		return
+	}
+	state := map[string]interface{}{"status": "disabled"}
+	if key != nil {
+		ds := key.ToDS(dns.SHA256)
+		state = map[string]interface{}{
+			"status": "signed",
+			"dnskeys": []map[string]interface{}{{
+				"flags":      key.Flags,
+				"protocol":   key.Protocol,
+				"algorithm":  key.Algorithm,
+				"public_key": key.PublicKey,
+			}},
+			"ds": []map[string]interface{}{{
+				"key_tag":     ds.KeyTag,
+				"algorithm":   ds.Algorithm,
+				"digest_type": ds.DigestType,
+				"digest":      ds.Digest,
+			}},
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"dnssec": state})
+}
+
+// enableDNSSEC signs zone with a new ECDSA P-256 key signing key, unless
+// it's already signed
+func (s *Server) enableDNSSEC(w http.ResponseWriter, zone string) {
+	s.mu.Lock()
+	_, ok := s.zones[zone]
+	if ok && s.dnssec[zone] == nil {
+		key := &dns.DNSKEY{
+			Hdr:       dns.RR_Header{Name: dns.Fqdn(zone), Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: defaultTTL},
+			Flags:     dns.ZONE | dns.SEP,
+			Protocol:  3,
+			Algorithm: dns.ECDSAP256SHA256,
+		}
+		if _, err := key.Generate(256); err != nil {
+			s.mu.Unlock()
+			writeError(w, http.StatusInternalServerError, "key_generation_failed", err.Error())
+			return
+		}
+		s.dnssec[zone] = key
+		s.serials[zone]++
+	}
+	s.mu.Unlock()
+	if !ok {
+		writeZoneNotFound(w, zone)
+		return
+	}
+	s.getDNSSEC(w, zone)
+}
+
+// disableDNSSEC stops signing zone
+func (s *Server) disableDNSSEC(w http.ResponseWriter, zone string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.zones[zone]; !ok {
+		writeZoneNotFound(w, zone)
+		return
+	}
+	if s.dnssec[zone] != nil {
+		delete(s.dnssec, zone)
+		s.serials[zone]++
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeRecord is a record as sent by the provider
+type writeRecord struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Data string `json:"data"`
+	TTL  int    `json:"ttl"`
+}
+
+// decodeRecords decodes a {"records": [...]} request body
+func decodeRecords(w http.ResponseWriter, r *http.Request) ([]writeRecord, bool) {
+	var body struct {
+		Records []writeRecord `json:"records"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", err.Error())
+		return nil, false
+	}
+	return body.Records, true
+}
+
+func (s *Server) appendRecords(w http.ResponseWriter, r *http.Request, zone string) {
+	input, ok := decodeRecords(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.zones[zone]; !ok {
+		writeZoneNotFound(w, zone)
+		return
+	}
+	created := make([]Record, 0, len(input))
+	for _, in := range input {
+		if in.Name == "" || in.Type == "" {
+			writeError(w, http.StatusUnprocessableEntity, "invalid_record", "name and type are required")
+			return
+		}
+		created = append(created, s.assignID(Record{
+			Name:  in.Name,
+			Type:  strings.ToUpper(in.Type),
+			Value: in.Data,
+			TTL:   in.TTL,
+		}))
+	}
+	s.zones[zone] = append(s.zones[zone], created...)
+	s.serials[zone]++
+	for _, record := range created {
+		s.logChange(zone, "create", record)
+	}
+	s.writeWriteResult(w, http.StatusCreated, map[string]interface{}{"records": created})
+}
+
+// deleteRecords removes the records matching the input: by ID when given,
+// otherwise by name and, when not empty, type, data and TTL.
+func (s *Server) deleteRecords(w http.ResponseWriter, r *http.Request, zone string) {
+	input, ok := decodeRecords(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records, ok := s.zones[zone]
+	if !ok {
+		writeZoneNotFound(w, zone)
+		return
+	}
+	kept := records[:0:0]
+	for _, record := range records {
+		deleted := false
+		for _, in := range input {
+			if matches(record, in) {
+				deleted = true
+				break
+			}
+		}
+		if deleted {
+			s.logChange(zone, "delete", record)
+		} else {
+			kept = append(kept, record)
+		}
+	}
+	s.zones[zone] = kept
+	s.serials[zone]++
+	s.writeWriteResult(w, http.StatusNoContent, nil)
+}
+
+// writeWriteResult answers a record write with status and result, or with a
+// pending operation holding them in Async mode; s.mu must be held
+func (s *Server) writeWriteResult(w http.ResponseWriter, status int, result interface{}) {
+	if !s.Async {
+		if result == nil {
+			w.WriteHeader(status)
+			return
+		}
+		writeJSON(w, status, result)
+		return
+	}
+	s.nextID++
+	id := strconv.Itoa(s.nextID)
+	s.results[id] = result
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{"operation": map[string]string{"id": id, "status": "pending"}})
+}
+
+// getOperation reports the operation with the given ID as succeeded
+func (s *Server) getOperation(w http.ResponseWriter, id string) {
+	s.mu.Lock()
+	result, ok := s.results[id]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "operation_not_found", "operation "+id+" not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"operation": map[string]interface{}{
+		"id":     id,
+		"status": "succeeded",
+		"result": result,
+	}})
+}
+
+// matches reports whether record is designated by the deletion input in
+func matches(record Record, in writeRecord) bool {
+	if in.ID != "" {
+		return record.ID == in.ID
+	}
+	return sameName(record.Name, in.Name) &&
+		(in.Type == "" || strings.EqualFold(record.Type, in.Type)) &&
+		(in.Data == "" || record.Value == in.Data) &&
+		(in.TTL == 0 || record.TTL == in.TTL)
+}
+
+// sameName reports whether the record names a and b are equal, ignoring
+// case and with an empty name meaning the apex "@"
+func sameName(a, b string) bool {
+	if a == "" {
+		a = "@"
+	}
+	if b == "" {
+		b = "@"
+	}
+	return strings.EqualFold(a, b)
+}
+
+// normalizeZone makes zone names case- and trailing-dot-insensitive
+func normalizeZone(zone string) string {
+	return strings.ToLower(strings.TrimSuffix(zone, "."))
+}
+
+func writeZoneNotFound(w http.ResponseWriter, zone string) {
+	writeError(w, http.StatusNotFound, "zone_not_found", "zone "+zone+" not found")
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]string{"code": code, "message": message},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,33 @@
+//go:build go1.23
+
+package libdnsimmosquare
+
+import (
+	"context"
+	"iter"
+
+	"github.com/libdns/libdns"
+)
+
+// GetRecordsIter returns an iterator over the records of zone, fetched page
+// by page as the iteration goes, so huge zones can be processed without
+// holding all of their records in memory. It bypasses the GetRecords cache,
+// and its pages are never kept for conditional requests.
+// An error ends the iteration, yielded with a nil record:
+//
+//	for record, err := range provider.GetRecordsIter(ctx, "example.com") {
+//		if err != nil {
+//			return err
+//		}
+//		// ...
+//	}
+func (p *Provider) GetRecordsIter(ctx context.Context, zone string) iter.Seq2[libdns.Record, error] {
+	return func(yield func(libdns.Record, error) bool) {
+		err := p.walkRecords(ctx, zone, RecordFilter{}, false, func(record libdns.Record) bool {
+			return yield(record, nil)
+		})
+		if err != nil {
+			yield(nil, err)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// Defaults of LegoProvider
+const (
+	defaultLegoTTL                = 2 * time.Minute
+	defaultLegoPropagationTimeout = 2 * time.Minute
+	defaultLegoPollingInterval    = 2 * time.Second
+	legoRequestTimeout            = time.Minute
+)
+
+// LegoProvider adapts a Provider to the challenge.Provider interface of
+// go-acme/lego, and so to the tools built on it such as Traefik, to solve
+// DNS-01 challenges:
+//
+//	client.Challenge.SetDNS01Provider(libdnsimmosquare.NewLegoProvider(provider))
+//
+// It also implements challenge.ProviderTimeout. lego's interfaces are
+// matched without importing lego.
+type LegoProvider struct {
+	// Provider writes the challenge records
+	Provider *Provider
+
+	// Zone is the zone hosting the challenge records; if empty, the most
+	// specific zone of the account the challenge name belongs to, listed
+	// with ListZones, is used.
+	Zone string
+
+	// TTL is the TTL of the challenge records. Defaults to 2m.
+	TTL time.Duration
+
+	// PropagationTimeout and PollingInterval are returned by Timeout, for
+	// lego to wait for the records to be served. They default to 2m and 2s.
+	PropagationTimeout time.Duration
+	PollingInterval    time.Duration
+}
+
+// NewLegoProvider returns a LegoProvider writing the challenge records with
+// provider, in the zone of the account they belong to.
+func NewLegoProvider(provider *Provider) *LegoProvider {
+	return &LegoProvider{Provider: provider}
+}
+
+// Present adds the TXT record of the DNS-01 challenge of domain, with
+// EnsureTXT so a retried presentation doesn't add it twice.
+func (l *LegoProvider) Present(domain, token, keyAuth string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), legoRequestTimeout)
+	defer cancel()
+	zone, name, value, err := l.challenge(ctx, domain, keyAuth)
+	if err != nil {
+		return err
+	}
+	ttl := l.TTL
+	if ttl <= 0 {
+		ttl = defaultLegoTTL
+	}
+	if _, err := l.Provider.EnsureTXT(ctx, zone, name, value, ttl); err != nil {
+		return fmt.Errorf("error presenting the challenge of %s: %w", domain, err)
+	}
+	return nil
+}
+
+// CleanUp deletes the TXT record of the DNS-01 challenge of domain added by
+// Present, leaving the other challenges of the name alone.
+func (l *LegoProvider) CleanUp(domain, token, keyAuth string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), legoRequestTimeout)
+	defer cancel()
+	zone, name, value, err := l.challenge(ctx, domain, keyAuth)
+	if err != nil {
+		return err
+	}
+	if _, err := l.Provider.DeleteRecords(ctx, zone, []libdns.Record{libdns.TXT{Name: name, Text: value}}); err != nil {
+		return fmt.Errorf("error cleaning up the challenge of %s: %w", domain, err)
+	}
+	return nil
+}
+
+// Timeout returns how long lego waits for the challenge records to be
+// served, and how often it checks.
+func (l *LegoProvider) Timeout() (timeout, interval time.Duration) {
+	timeout, interval = l.PropagationTimeout, l.PollingInterval
+	if timeout <= 0 {
+		timeout = defaultLegoPropagationTimeout
+	}
+	if interval <= 0 {
+		interval = defaultLegoPollingInterval
+	}
+	return timeout, interval
+}
+
+// challenge returns the zone hosting the challenge record of domain, its
+// name relative to the zone and its value, the base64url-encoded SHA-256
+// digest of keyAuth (RFC 8555 §8.4)
+func (l *LegoProvider) challenge(ctx context.Context, domain, keyAuth string) (zone, name, value string, err error) {
+	fqdn := acmeChallengeLabel + "." + normalizeZone(strings.TrimPrefix(domain, "*."))
+	zone = normalizeZone(l.Zone)
+	if zone == "" {
+		zones, err := l.Provider.ListZones(ctx)
+		if err != nil {
+			return "", "", "", fmt.Errorf("error listing the zones: %w", err)
+		}
+		names := make([]string, 0, len(zones))
+		for _, z := range zones {
+			names = append(names, normalizeZone(z.Name))
+		}
+		if zone = hostingZone(names, fqdn); zone == "" {
+			return "", "", "", fmt.Errorf("no zone of the account hosts %s", fqdn)
+		}
+	}
+	digest := sha256.Sum256([]byte(keyAuth))
+	return zone, relativeName(fqdn, zone), base64.RawURLEncoding.EncodeToString(digest[:]), nil
+}
@@ -0,0 +1,53 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"log/slog"
+)
+
+// redacted replaces secrets in logs
+const redacted = "REDACTED"
+
+// logDebug logs at debug level to the configured logger, if any.
+// Never pass request headers or credentials as attributes.
+func (p *Provider) logDebug(ctx context.Context, msg string, args ...any) {
+	if p.logger != nil {
+		p.logger.DebugContext(ctx, msg, args...)
+	}
+}
+
+// logInfo logs at info level to the configured logger, if any, for events
+// worth noticing without debug logs, such as failover switches.
+func (p *Provider) logInfo(ctx context.Context, msg string, args ...any) {
+	if p.logger != nil {
+		p.logger.InfoContext(ctx, msg, args...)
+	}
+}
+
+// LogValue implements slog.LogValuer so that logging a Provider never
+// leaks its API token.
+func (p *Provider) LogValue() slog.Value {
+	token := ""
+	if p.APIToken != "" {
+		token = redacted
+	}
+	attrs := []slog.Attr{
+		slog.String("endpoint", p.Endpoint),
+		slog.String("api_token", token),
+	}
+	if p.AccountID != "" {
+		attrs = append(attrs, slog.String("account_id", p.AccountID))
+	}
+	if p.APITokenFile != "" {
+		attrs = append(attrs, slog.String("api_token_file", p.APITokenFile))
+	}
+	if p.OAuth2ClientID != "" {
+		attrs = append(attrs,
+			slog.String("oauth2_client_id", p.OAuth2ClientID),
+			slog.String("oauth2_client_secret", redacted))
+	}
+	if p.OAuth2RefreshToken != "" {
+		attrs = append(attrs, slog.String("oauth2_refresh_token", redacted))
+	}
+	return slog.GroupValue(attrs...)
+}
@@ -0,0 +1,51 @@
+package libdnsimmosquare
+
+import (
+	"context"
+
+	"github.com/libdns/libdns"
+)
+
+// RecordFilter selects records by name and type for FindRecords. Names are
+// relative to the zone and compared case-insensitively and without trailing
+// dot, types case-insensitively; an empty field matches any record.
+type RecordFilter struct {
+	Name string
+	Type string
+}
+
+// match reports whether rr is selected by f
+func (f RecordFilter) match(rr libdns.RR) bool {
+	want, got := keyOf(libdns.RR{Name: f.Name, Type: f.Type}), keyOf(rr)
+	return (f.Name == "" || want.name == got.name) && (f.Type == "" || want.rtype == got.rtype)
+}
+
+// FindRecords returns the records selected by filter, in their original
+// order. It returns an empty slice when none is.
+func FindRecords(records []libdns.Record, filter RecordFilter) []libdns.Record {
+	found := []libdns.Record{}
+	for _, record := range records {
+		if filter.match(record.RR()) {
+			found = append(found, record)
+		}
+	}
+	return found
+}
+
+// LookupRecords returns the records of zone with the given name and type,
+// either of which may be empty to match any; the name may be relative or
+// absolute. The name and type are sent as query parameters, so the API can
+// return only the matching records instead of the whole zone. When CacheTTL
+// is set and the zone is cached, the cached records are filtered instead.
+func (p *Provider) LookupRecords(ctx context.Context, zone, name, rtype string) ([]libdns.Record, error) {
+	filter := RecordFilter{Type: rtype}
+	if name != "" {
+		filter.Name = relativeName(name, zone)
+	}
+	if p.CacheTTL > 0 {
+		if records, ok := p.recordCache.get(zone); ok {
+			return FindRecords(records, filter), nil
+		}
+	}
+	return p.fetchFilteredRecords(ctx, zone, filter)
+}
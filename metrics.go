@@ -0,0 +1,36 @@
+package libdnsimmosquare
+
+import (
+	"time"
+)
+
+// Metrics receives measurements about the provider's API operations.
+// Implementations must be safe for concurrent use. The metrics subpackage
+// provides a Prometheus implementation.
+type Metrics interface {
+	// ObserveRequest is called after each HTTP attempt with the request
+	// method, the response status code (0 when no response was received),
+	// the time until the response headers arrived and the transport error,
+	// if any.
+	ObserveRequest(method string, statusCode int, duration time.Duration, err error)
+
+	// ObserveRecords is called after a successful operation with the number
+	// of records fetched ("get") or written ("append", "set", "delete") in
+	// zone.
+	ObserveRecords(zone, operation string, count int)
+}
+
+// observeRequest reports an HTTP attempt to the configured metrics, if any
+func (p *Provider) observeRequest(method string, statusCode int, duration time.Duration, err error) {
+	if p.metrics != nil {
+		p.metrics.ObserveRequest(method, statusCode, duration, err)
+	}
+}
+
+// observeRecords reports records fetched or written to the configured
+// metrics, if any
+func (p *Provider) observeRecords(zone, operation string, count int) {
+	if p.metrics != nil {
+		p.metrics.ObserveRecords(normalizeZone(zone), operation, count)
+	}
+}
@@ -0,0 +1,107 @@
+// Package metrics exposes libdns-immosquare API metrics to Prometheus.
+//
+//	collector := metrics.NewCollector("")
+//	prometheus.MustRegister(collector)
+//	provider := libdnsimmosquare.NewProvider(endpoint,
+//		libdnsimmosquare.WithMetrics(collector),
+//	)
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	libdnsimmosquare "github.com/immosquare/libdns-immosquare"
+)
+
+// defaultNamespace prefixes metric names unless another namespace is given
+const defaultNamespace = "libdns_immosquare"
+
+// Collector records provider metrics and exposes them as a
+// prometheus.Collector.
+type Collector struct {
+	requests *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+	records  *prometheus.CounterVec
+}
+
+// NewCollector returns a Collector whose metric names are prefixed with
+// namespace (default "libdns_immosquare"):
+//
+//   - requests_total{method,code}: HTTP attempts, code being "error" when
+//     no response was received
+//   - errors_total{method,code}: failed attempts (transport errors and
+//     non-2xx statuses)
+//   - request_duration_seconds{method}: time until the response headers
+//   - records_total{zone,operation}: records fetched or written
+func NewCollector(namespace string) *Collector {
+	if namespace == "" {
+		namespace = defaultNamespace
+	}
+	return &Collector{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "requests_total",
+			Help:      "HTTP requests sent to the immosquare API, by method and status code.",
+		}, []string{"method", "code"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "errors_total",
+			Help:      "Failed HTTP requests to the immosquare API, by method and status code.",
+		}, []string{"method", "code"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "request_duration_seconds",
+			Help:      "Latency of HTTP requests to the immosquare API, by method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+		records: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "records_total",
+			Help:      "DNS records fetched or written, by zone and operation.",
+		}, []string{"zone", "operation"}),
+	}
+}
+
+// ObserveRequest implements libdnsimmosquare.Metrics.
+func (c *Collector) ObserveRequest(method string, statusCode int, duration time.Duration, err error) {
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(statusCode)
+	}
+	c.requests.WithLabelValues(method, code).Inc()
+	c.latency.WithLabelValues(method).Observe(duration.Seconds())
+	if err != nil || statusCode < 200 || statusCode > 299 {
+		c.errors.WithLabelValues(method, code).Inc()
+	}
+}
+
+// ObserveRecords implements libdnsimmosquare.Metrics.
+func (c *Collector) ObserveRecords(zone, operation string, count int) {
+	c.records.WithLabelValues(zone, operation).Add(float64(count))
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.requests.Describe(ch)
+	c.errors.Describe(ch)
+	c.latency.Describe(ch)
+	c.records.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.requests.Collect(ch)
+	c.errors.Collect(ch)
+	c.latency.Collect(ch)
+	c.records.Collect(ch)
+}
+
+// Interface guards
+var (
+	_ libdnsimmosquare.Metrics = (*Collector)(nil)
+	_ prometheus.Collector     = (*Collector)(nil)
+)
@@ -0,0 +1,92 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// ImportFromProvider copies the records of zone from src, any other libdns
+// provider (Cloudflare, OVH, ...), to zone on this provider, which must
+// exist, e.g. to migrate a zone to immosquare DNS. SOA records are skipped,
+// and so are apex NS records unless opts.IncludeApexNS is set and ownership
+// markers in the ownership mode.
+//
+// The changes are computed as a Plan against the current records of zone:
+// the missing records are created or, with opts.Replace, the RRsets present
+// in src are replaced, updating and deleting records as needed; other
+// RRsets are left untouched. The plan is then applied with Apply, unless
+// opts.DryRun is set, and returned.
+func (p *Provider) ImportFromProvider(ctx context.Context, src libdns.RecordGetter, zone string, opts ImportOptions) (*Plan, error) {
+	records, err := src.GetRecords(ctx, dns.Fqdn(normalizeZone(zone)))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching the records from the source provider: %w", err)
+	}
+	var imported []libdns.Record
+	for _, record := range relativeRecords(zone, records) {
+		rr := record.RR()
+		rtype := strings.ToUpper(rr.Type)
+		if rtype == "SOA" || (rtype == "NS" && normalizeName(rr.Name) == apexName && !opts.IncludeApexNS) {
+			continue
+		}
+		imported = append(imported, record)
+	}
+
+	plan, err := p.importPlan(ctx, zone, imported, opts.Replace)
+	if err != nil || opts.DryRun {
+		return plan, err
+	}
+	if err := p.Apply(ctx, plan); err != nil {
+		return plan, err
+	}
+	return plan, nil
+}
+
+// importPlan computes the changes adding records to zone or, with replace,
+// replacing the RRsets of records, like Plan does for the whole zone
+func (p *Provider) importPlan(ctx context.Context, zone string, records []libdns.Record, replace bool) (*Plan, error) {
+	records = p.ownershipOf(ctx, nil).withoutMarkers(records)
+	if err := validateRecords(records); err != nil {
+		return nil, err
+	}
+	if _, err := checkCNAMEConflicts(records, nil, false); err != nil {
+		return nil, err
+	}
+	wanted, err := normalizeRecords(records, p.ttlLimits(ctx))
+	if err != nil {
+		return nil, err
+	}
+	existing, err := p.fetchRecords(ctx, zone)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching current records: %w", err)
+	}
+
+	wantedKeys := make(map[rrsetKey]bool, len(wanted))
+	for _, rr := range wanted {
+		wantedKeys[keyOf(rr)] = true
+	}
+	// present holds the existing values, whatever their TTL
+	var current []libdns.Record
+	present := make(map[recordKey]bool, len(existing))
+	for _, record := range existing {
+		rr := record.RR()
+		if key := keyOf(rr); wantedKeys[key] {
+			current = append(current, record)
+			present[recordKey{rrsetKey: key, data: rr.Data}] = true
+		}
+	}
+	if replace {
+		return computePlan(zone, current, wanted), nil
+	}
+
+	plan := &Plan{Zone: zone}
+	for _, rr := range wanted {
+		if !present[recordKey{rrsetKey: keyOf(rr), data: rr.Data}] {
+			plan.Creates = append(plan.Creates, parseRR(rr))
+		}
+	}
+	return plan, nil
+}
@@ -0,0 +1,107 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// Names of the MTA-STS (RFC 8461) and TLS-RPT (RFC 8460) records, relative
+// to the mail domain
+const (
+	mtaSTSLabel     = "_mta-sts"
+	mtaSTSHostLabel = "mta-sts"
+	tlsRPTLabel     = "_smtp._tls"
+)
+
+// MTASTSOptions configures the records published by PublishMTASTS.
+type MTASTSOptions struct {
+	// ID identifies the version of the MTA-STS policy, 1 to 32 letters and
+	// digits, and must change whenever the policy served over HTTPS does,
+	// so senders fetch it again (default: the current UTC time, as
+	// YYYYMMDDhhmmss)
+	ID string
+
+	// ReportURIs are where TLS-RPT reports are sent, mailto: or https:
+	// URIs; email addresses get the "mailto:" scheme. No _smtp._tls record
+	// is published when empty.
+	ReportURIs []string
+
+	// PolicyHost, if set, is the target of the mta-sts CNAME, the host
+	// serving the policy file, e.g. that of a hosted MTA-STS service
+	PolicyHost string
+
+	// PolicyIPs, if set, are the addresses of the mta-sts A and AAAA
+	// records, for a policy file served by your own servers
+	PolicyIPs []netip.Addr
+}
+
+// PublishMTASTS publishes the MTA-STS and TLS-RPT records of zone: the
+// _mta-sts TXT record ("v=STSv1; id=..."), the _smtp._tls TXT record
+// ("v=TLSRPTv1; rua=...") when ReportURIs is set, and the mta-sts CNAME or
+// A and AAAA records when PolicyHost or PolicyIPs is. Each RRset is replaced
+// with ReplaceRRSet, one after the other. It returns the published records.
+//
+// The policy file itself must be served at
+// https://mta-sts.<zone>/.well-known/mta-sts.txt.
+func (p *Provider) PublishMTASTS(ctx context.Context, zone string, opts MTASTSOptions) ([]libdns.Record, error) {
+	id := opts.ID
+	if id == "" {
+		id = time.Now().UTC().Format("20060102150405")
+	}
+	if len(id) > 32 || !isAlphanumeric(id) {
+		return nil, fmt.Errorf("invalid MTA-STS policy ID %q: must be 1 to 32 letters and digits", id)
+	}
+	if opts.PolicyHost != "" && len(opts.PolicyIPs) > 0 {
+		return nil, fmt.Errorf("MTA-STS PolicyHost and PolicyIPs are mutually exclusive")
+	}
+
+	rrsets := []rrsetValues{
+		{mtaSTSLabel, "TXT", []string{"v=STSv1; id=" + id}},
+	}
+	if len(opts.ReportURIs) > 0 {
+		uris := make([]string, len(opts.ReportURIs))
+		for i, uri := range opts.ReportURIs {
+			if !strings.Contains(uri, ":") && strings.Contains(uri, "@") {
+				uri = "mailto:" + uri
+			}
+			if u, err := url.Parse(uri); err != nil || (u.Scheme != "mailto" && u.Scheme != "https") || strings.ContainsAny(uri, ",; ") {
+				return nil, fmt.Errorf("invalid TLS-RPT report URI %q: a mailto: or https: URI is required", opts.ReportURIs[i])
+			}
+			uris[i] = uri
+		}
+		rrsets = append(rrsets, rrsetValues{tlsRPTLabel, "TXT", []string{"v=TLSRPTv1; rua=" + strings.Join(uris, ",")}})
+	}
+	if opts.PolicyHost != "" {
+		rrsets = append(rrsets, rrsetValues{mtaSTSHostLabel, "CNAME", []string{opts.PolicyHost}})
+	}
+	if len(opts.PolicyIPs) > 0 {
+		var ipv4, ipv6 []string
+		for _, ip := range opts.PolicyIPs {
+			if ip.Unmap().Is4() {
+				ipv4 = append(ipv4, ip.Unmap().String())
+			} else {
+				ipv6 = append(ipv6, ip.String())
+			}
+		}
+		rrsets = append(rrsets, rrsetValues{mtaSTSHostLabel, "A", ipv4}, rrsetValues{mtaSTSHostLabel, "AAAA", ipv6})
+	}
+
+	return p.replaceRRSets(ctx, zone, rrsets)
+}
+
+// isAlphanumeric reports whether s is a non-empty string of ASCII letters
+// and digits
+func isAlphanumeric(s string) bool {
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,124 @@
+package libdnsimmosquare
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// apexName is the relative name of the zone apex, in libdns and in the API
+const apexName = "@"
+
+// normalizeName returns a relative record name in the form used by libdns
+// and sent to the API: "@" for the apex, whether given as "@" or an empty
+// name, and "*" for wildcard labels, also when escaped in presentation
+// format as `\*` or `\052`.
+func normalizeName(name string) string {
+	name = strings.TrimSpace(name)
+	if name == "" || name == apexName || name == apexName+"." {
+		return apexName
+	}
+	if !strings.Contains(name, `\`) {
+		return name
+	}
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		if label == `\*` || label == `\052` {
+			labels[i] = "*"
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+// normalizeZone returns zone in the form sent to the API: lowercase and
+// without trailing dot, as libdns callers such as certmagic pass
+// "example.com." while the API knows "example.com"
+func normalizeZone(zone string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(zone), "."))
+}
+
+// zonePath returns the API path of zone, normalized with normalizeZone and
+// escaped as a path segment
+func zonePath(zone string) string {
+	return "/zones/" + url.PathEscape(normalizeZone(zone))
+}
+
+// relativeName returns name relative to zone, normalized with
+// normalizeName. Names within the zone are accepted with or without a
+// trailing dot, so "www.example.com" in zone "example.com." is "www" rather
+// than "www.example.com.example.com"; other names are already relative.
+// Names outside of the zone are returned as given, with or without their
+// trailing dot.
+func relativeName(name, zone string) string {
+	name = normalizeName(name)
+	origin := strings.TrimSuffix(zone, ".")
+	if origin == "" {
+		return name
+	}
+	fqdn := strings.TrimSuffix(name, ".")
+	if strings.EqualFold(fqdn, origin) ||
+		len(fqdn) > len(origin) && strings.EqualFold(fqdn[len(fqdn)-len(origin)-1:], "."+origin) {
+		// Take the zone as spelled in name, since libdns.RelativeName is
+		// case-sensitive
+		origin = fqdn[len(fqdn)-len(origin):]
+		return normalizeName(libdns.RelativeName(fqdn+".", origin+"."))
+	}
+	return name
+}
+
+// relativeRecords returns records with their names relative to zone, see
+// relativeName. The records are returned as is when no name changes.
+func relativeRecords(zone string, records []libdns.Record) []libdns.Record {
+	var relative []libdns.Record
+	for i, record := range records {
+		rel := relativeRecord(zone, record)
+		if rel.RR().Name == record.RR().Name {
+			continue
+		}
+		if relative == nil {
+			relative = append([]libdns.Record{}, records...)
+		}
+		relative[i] = rel
+	}
+	if relative == nil {
+		return records
+	}
+	return relative
+}
+
+// relativeRecord returns record with its name relative to zone, keeping its
+// type-specific form and provider data. For SRV, SVCB and HTTPS records only
+// the owner name following the service labels is converted.
+func relativeRecord(zone string, record libdns.Record) libdns.Record {
+	switch r := record.(type) {
+	case libdns.Address:
+		r.Name = relativeName(r.Name, zone)
+		return r
+	case libdns.TXT:
+		r.Name = relativeName(r.Name, zone)
+		return r
+	case libdns.CNAME:
+		r.Name = relativeName(r.Name, zone)
+		return r
+	case libdns.MX:
+		r.Name = relativeName(r.Name, zone)
+		return r
+	case libdns.NS:
+		r.Name = relativeName(r.Name, zone)
+		return r
+	case libdns.SRV:
+		r.Name = relativeName(r.Name, zone)
+		return r
+	case libdns.CAA:
+		r.Name = relativeName(r.Name, zone)
+		return r
+	case libdns.ServiceBinding:
+		r.Name = relativeName(r.Name, zone)
+		return r
+	default:
+		rr := record.RR()
+		rr.Name = relativeName(rr.Name, zone)
+		return rr
+	}
+}
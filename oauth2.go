@@ -0,0 +1,55 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// oauth2ClientCredentialsFetch returns a tokenCache fetch function obtaining
+// access tokens with the OAuth2 client-credentials flow. Token requests are
+// sent with client, so they honor the TLS and proxy settings but are never
+// dumped by Debug, as they carry the client secret.
+func (p *Provider) oauth2ClientCredentialsFetch(client *http.Client) func(context.Context, *oauth2.Token) (*oauth2.Token, error) {
+	config := &clientcredentials.Config{
+		ClientID:     p.OAuth2ClientID,
+		ClientSecret: p.OAuth2ClientSecret,
+		TokenURL:     p.OAuth2TokenURL,
+		Scopes:       p.OAuth2Scopes,
+	}
+	return func(ctx context.Context, _ *oauth2.Token) (*oauth2.Token, error) {
+		token, err := config.Token(context.WithValue(ctx, oauth2.HTTPClient, client))
+		if err != nil {
+			return nil, fmt.Errorf("OAuth2 token error: %w", err)
+		}
+		return token, nil
+	}
+}
+
+// oauth2RefreshTokenFetch returns a tokenCache fetch function obtaining
+// access tokens with the OAuth2 refresh-token grant, starting with
+// OAuth2RefreshToken and then using the latest refresh token returned by the
+// server, in case it rotates them. Token requests are sent with client.
+func (p *Provider) oauth2RefreshTokenFetch(client *http.Client) func(context.Context, *oauth2.Token) (*oauth2.Token, error) {
+	config := &oauth2.Config{
+		ClientID:     p.OAuth2ClientID,
+		ClientSecret: p.OAuth2ClientSecret,
+		Endpoint:     oauth2.Endpoint{TokenURL: p.OAuth2TokenURL},
+		Scopes:       p.OAuth2Scopes,
+	}
+	return func(ctx context.Context, current *oauth2.Token) (*oauth2.Token, error) {
+		refreshToken := p.OAuth2RefreshToken
+		if current != nil && current.RefreshToken != "" {
+			refreshToken = current.RefreshToken
+		}
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, client)
+		token, err := config.TokenSource(ctx, &oauth2.Token{RefreshToken: refreshToken}).Token()
+		if err != nil {
+			return nil, fmt.Errorf("OAuth2 token refresh error: %w", err)
+		}
+		return token, nil
+	}
+}
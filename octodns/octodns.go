@@ -0,0 +1,337 @@
+// Package octodns reads and writes the YAML zone files of octoDNS, the
+// ones read by its YamlProvider, so teams using its tooling can work with
+// zones managed by the libdns-immosquare provider.
+//
+//	err := octodns.Export(ctx, provider, "example.com", f)
+package octodns
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+	"gopkg.in/yaml.v3"
+
+	libdnsimmosquare "github.com/immosquare/libdns-immosquare"
+)
+
+// defaultTTL is the TTL of the RRsets without one, as in octoDNS
+const defaultTTL = time.Hour
+
+// record is an RRset of an octoDNS zone file: value holds the single value
+// of the RRset, values several ones
+type record struct {
+	Type   string      `yaml:"type"`
+	TTL    *uint32     `yaml:"ttl,omitempty"`
+	Value  yaml.Node   `yaml:"value,omitempty"`
+	Values []yaml.Node `yaml:"values,omitempty"`
+}
+
+// Values of the octoDNS record types whose data isn't a single string
+type (
+	mxValue struct {
+		Exchange   string `yaml:"exchange"`
+		Preference uint16 `yaml:"preference"`
+	}
+	srvValue struct {
+		Port     uint16 `yaml:"port"`
+		Priority uint16 `yaml:"priority"`
+		Target   string `yaml:"target"`
+		Weight   uint16 `yaml:"weight"`
+	}
+	caaValue struct {
+		Flags uint8  `yaml:"flags"`
+		Tag   string `yaml:"tag"`
+		Value string `yaml:"value"`
+	}
+	sshfpValue struct {
+		Algorithm       uint8  `yaml:"algorithm"`
+		Fingerprint     string `yaml:"fingerprint"`
+		FingerprintType uint8  `yaml:"fingerprint_type"`
+	}
+	tlsaValue struct {
+		CertificateAssociationData string `yaml:"certificate_association_data"`
+		CertificateUsage           uint8  `yaml:"certificate_usage"`
+		MatchingType               uint8  `yaml:"matching_type"`
+		Selector                   uint8  `yaml:"selector"`
+	}
+	dsValue struct {
+		Algorithm  uint8  `yaml:"algorithm"`
+		Digest     string `yaml:"digest"`
+		DigestType uint8  `yaml:"digest_type"`
+		KeyTag     uint16 `yaml:"key_tag"`
+	}
+)
+
+// Export writes the records of zone, fetched from getter, to w as an
+// octoDNS zone file, see Write.
+func Export(ctx context.Context, getter libdns.RecordGetter, zone string, w io.Writer) error {
+	records, err := getter.GetRecords(ctx, zone)
+	if err != nil {
+		return err
+	}
+	return Write(w, zone, records)
+}
+
+// Import parses the octoDNS zone file read from r and writes its records to
+// zone with provider.ImportRecords. It returns the records written, or that
+// would be with DryRun.
+func Import(ctx context.Context, provider *libdnsimmosquare.Provider, zone string, r io.Reader, opts libdnsimmosquare.ImportOptions) ([]libdns.Record, error) {
+	records, err := Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	return provider.ImportRecords(ctx, zone, records, opts)
+}
+
+// Write renders records, with names relative to zone, as an octoDNS zone
+// file: one entry per name, "" for the apex, holding its RRsets sorted by
+// type, as a list when there are several. The TTL of an RRset is the one
+// of its first record. SOA records are skipped, and it fails on record
+// types not supported by octoDNS or this conversion.
+func Write(w io.Writer, zone string, records []libdns.Record) error {
+	origin := dns.Fqdn(strings.ToLower(strings.TrimSuffix(strings.TrimSpace(zone), ".")))
+	sets := make(map[string]map[string]*record)
+	for _, rec := range records {
+		rr := rec.RR()
+		rr.Type = strings.ToUpper(rr.Type)
+		if rr.Type == "SOA" {
+			continue
+		}
+		value, err := octoValue(rr, origin)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSpace(rr.Name)
+		if name == "@" {
+			name = ""
+		}
+		if sets[name] == nil {
+			sets[name] = make(map[string]*record)
+		}
+		set := sets[name][rr.Type]
+		if set == nil {
+			ttl := uint32(rr.TTL.Seconds())
+			set = &record{Type: rr.Type, TTL: &ttl}
+			sets[name][rr.Type] = set
+		}
+		set.Values = append(set.Values, value)
+	}
+
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	names := make([]string, 0, len(sets))
+	for name := range sets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		types := make([]string, 0, len(sets[name]))
+		for rtype := range sets[name] {
+			types = append(types, rtype)
+		}
+		sort.Strings(types)
+
+		list := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, rtype := range types {
+			set := sets[name][rtype]
+			if len(set.Values) == 1 {
+				set.Value, set.Values = set.Values[0], nil
+			}
+			var node yaml.Node
+			if err := node.Encode(set); err != nil {
+				return err
+			}
+			list.Content = append(list.Content, &node)
+		}
+		if len(list.Content) == 1 {
+			list = list.Content[0]
+		}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, list)
+	}
+
+	if _, err := io.WriteString(w, "---\n"); err != nil {
+		return err
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(root); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// octoValue returns the octoDNS value of rr, whose name is relative to
+// origin. Host names are made absolute, as octoDNS requires.
+func octoValue(rr libdns.RR, origin string) (yaml.Node, error) {
+	var value interface{}
+	switch rr.Type {
+	case "TXT", "SPF":
+		// octoDNS escapes semicolons in TXT values
+		value = strings.ReplaceAll(rr.Data, ";", `\;`)
+	default:
+		parsed, err := toDNSRR(rr, origin)
+		if err != nil {
+			return yaml.Node{}, err
+		}
+		switch r := parsed.(type) {
+		case *dns.A:
+			value = r.A.String()
+		case *dns.AAAA:
+			value = r.AAAA.String()
+		case *dns.CNAME:
+			value = r.Target
+		case *dns.DNAME:
+			value = r.Target
+		case *dns.NS:
+			value = r.Ns
+		case *dns.PTR:
+			value = r.Ptr
+		case *dns.MX:
+			value = mxValue{Exchange: r.Mx, Preference: r.Preference}
+		case *dns.SRV:
+			value = srvValue{Port: r.Port, Priority: r.Priority, Target: r.Target, Weight: r.Weight}
+		case *dns.CAA:
+			value = caaValue{Flags: r.Flag, Tag: r.Tag, Value: r.Value}
+		case *dns.SSHFP:
+			value = sshfpValue{Algorithm: r.Algorithm, Fingerprint: r.FingerPrint, FingerprintType: r.Type}
+		case *dns.TLSA:
+			value = tlsaValue{CertificateAssociationData: r.Certificate, CertificateUsage: r.Usage, MatchingType: r.MatchingType, Selector: r.Selector}
+		case *dns.DS:
+			value = dsValue{Algorithm: r.Algorithm, Digest: r.Digest, DigestType: r.DigestType, KeyTag: r.KeyTag}
+		default:
+			return yaml.Node{}, fmt.Errorf("record type %s of %q is not supported by octoDNS", rr.Type, rr.Name)
+		}
+	}
+	var node yaml.Node
+	err := node.Encode(value)
+	return node, err
+}
+
+// toDNSRR parses rr, whose name is relative to origin, from its master file
+// rendering, which spells host names the way the zone file parser reads
+// them back
+func toDNSRR(rr libdns.RR, origin string) (dns.RR, error) {
+	var master bytes.Buffer
+	if err := libdnsimmosquare.WriteZoneFile(&master, origin, []libdns.Record{rr}); err != nil {
+		return nil, err
+	}
+	parser := dns.NewZoneParser(&master, origin, "")
+	parsed, ok := parser.Next()
+	if !ok {
+		if err := parser.Err(); err != nil {
+			return nil, fmt.Errorf("invalid %s record %q: %w", rr.Type, rr.Name, err)
+		}
+		return nil, fmt.Errorf("invalid %s record %q: %q", rr.Type, rr.Name, rr.Data)
+	}
+	return parsed, nil
+}
+
+// Parse parses an octoDNS zone file. Record names are returned relative to
+// the zone ("@" for the apex) and records are converted to their libdns
+// types when supported. RRsets without a TTL get the octoDNS default of one
+// hour; octoDNS-specific settings, like the octodns key of records, are
+// ignored.
+func Parse(r io.Reader) ([]libdns.Record, error) {
+	var file map[string]yaml.Node
+	if err := yaml.NewDecoder(r).Decode(&file); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("octoDNS zone file parsing error: %w", err)
+	}
+	names := make([]string, 0, len(file))
+	for name := range file {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var records []libdns.Record
+	for _, name := range names {
+		node := file[name]
+		var sets []record
+		if node.Kind == yaml.SequenceNode {
+			if err := node.Decode(&sets); err != nil {
+				return nil, fmt.Errorf("invalid records of %q: %w", name, err)
+			}
+		} else {
+			sets = make([]record, 1)
+			if err := node.Decode(&sets[0]); err != nil {
+				return nil, fmt.Errorf("invalid record of %q: %w", name, err)
+			}
+		}
+
+		if name == "" {
+			name = "@"
+		}
+		for _, set := range sets {
+			rtype := strings.ToUpper(set.Type)
+			ttl := defaultTTL
+			if set.TTL != nil {
+				ttl = time.Duration(*set.TTL) * time.Second
+			}
+			values := set.Values
+			if len(values) == 0 && !set.Value.IsZero() {
+				values = []yaml.Node{set.Value}
+			}
+			if len(values) == 0 {
+				return nil, fmt.Errorf("%s record of %q has no value", rtype, name)
+			}
+			for _, value := range values {
+				data, err := octoData(rtype, &value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid %s record of %q: %w", rtype, name, err)
+				}
+				rr := libdns.RR{Name: name, Type: rtype, TTL: ttl, Data: data}
+				if parsed, err := rr.Parse(); err == nil {
+					records = append(records, parsed)
+				} else {
+					records = append(records, rr)
+				}
+			}
+		}
+	}
+	return records, nil
+}
+
+// octoData returns the record data in presentation format of an octoDNS
+// value of type rtype
+func octoData(rtype string, value *yaml.Node) (string, error) {
+	switch rtype {
+	case "MX":
+		var mx mxValue
+		err := value.Decode(&mx)
+		return fmt.Sprintf("%d %s", mx.Preference, mx.Exchange), err
+	case "SRV":
+		var srv srvValue
+		err := value.Decode(&srv)
+		return fmt.Sprintf("%d %d %d %s", srv.Priority, srv.Weight, srv.Port, srv.Target), err
+	case "CAA":
+		var caa caaValue
+		err := value.Decode(&caa)
+		return libdns.CAA{Flags: caa.Flags, Tag: caa.Tag, Value: caa.Value}.RR().Data, err
+	case "SSHFP":
+		var sshfp sshfpValue
+		err := value.Decode(&sshfp)
+		return fmt.Sprintf("%d %d %s", sshfp.Algorithm, sshfp.FingerprintType, sshfp.Fingerprint), err
+	case "TLSA":
+		var tlsa tlsaValue
+		err := value.Decode(&tlsa)
+		return fmt.Sprintf("%d %d %d %s", tlsa.CertificateUsage, tlsa.Selector, tlsa.MatchingType, tlsa.CertificateAssociationData), err
+	case "DS":
+		var ds dsValue
+		err := value.Decode(&ds)
+		return fmt.Sprintf("%d %d %d %s", ds.KeyTag, ds.Algorithm, ds.DigestType, ds.Digest), err
+	}
+
+	var data string
+	if err := value.Decode(&data); err != nil {
+		return "", err
+	}
+	if rtype == "TXT" || rtype == "SPF" {
+		data = strings.ReplaceAll(data, `\;`, ";")
+	}
+	return data, nil
+}
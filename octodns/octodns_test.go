@@ -0,0 +1,70 @@
+package octodns_test
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	libdnsimmosquare "github.com/immosquare/libdns-immosquare"
+	"github.com/immosquare/libdns-immosquare/immosquaretest"
+	"github.com/immosquare/libdns-immosquare/octodns"
+)
+
+const zoneFile = `---
+'':
+  - type: A
+    value: 192.0.2.1
+  - type: MX
+    ttl: 300
+    values:
+      - exchange: mx1.example.com.
+        preference: 10
+      - exchange: mx2.example.com.
+        preference: 20
+  - type: TXT
+    ttl: 300
+    value: v=spf1 include:mail.example.net\; -all
+www:
+  type: CNAME
+  ttl: 300
+  value: example.com.
+`
+
+func TestImportExport(t *testing.T) {
+	srv := immosquaretest.NewServer("token")
+	defer srv.Close()
+	srv.AddZone("example.com")
+	provider := srv.Provider()
+	ctx := context.Background()
+
+	if _, err := octodns.Import(ctx, provider, "example.com", strings.NewReader(zoneFile), libdnsimmosquare.ImportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range srv.Records("example.com") {
+		got = append(got, r.Name+" "+r.Type+" "+r.Value)
+	}
+	sort.Strings(got)
+	want := []string{
+		"@ A 192.0.2.1",
+		"@ MX 10 mx1.example.com.",
+		"@ MX 20 mx2.example.com.",
+		"@ TXT v=spf1 include:mail.example.net; -all",
+		"www CNAME example.com.",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("imported records = %q, want %q", got, want)
+	}
+
+	var exported bytes.Buffer
+	if err := octodns.Export(ctx, provider, "example.com", &exported); err != nil {
+		t.Fatal(err)
+	}
+	// The A RRset gets the default TTL it was imported with
+	wantFile := strings.Replace(zoneFile, "  - type: A\n", "  - type: A\n    ttl: 3600\n", 1)
+	if exported.String() != wantFile {
+		t.Errorf("exported zone file:\n%s\nwant:\n%s", exported.String(), wantFile)
+	}
+}
@@ -0,0 +1,168 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultOperationPollInterval is used when
+	// Provider.OperationPollInterval is zero
+	defaultOperationPollInterval = time.Second
+
+	// maxOperationPollInterval caps the Retry-After value of an operation
+	maxOperationPollInterval = 30 * time.Second
+)
+
+// OperationError is returned when an asynchronous operation, started by a
+// write answered with 202 Accepted, completes with a failure.
+type OperationError struct {
+	// ID is the ID of the operation
+	ID string
+	// Status is the final status of the operation, e.g. "failed"
+	Status string
+	// Code is the machine-readable error code of the operation, if any
+	Code string
+	// Message is the human-readable error message of the operation, if any
+	Message string
+}
+
+// Error implements the error interface.
+func (e *OperationError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "operation %s %s", e.ID, e.Status)
+	if e.Code != "" {
+		b.WriteString(" [" + e.Code + "]")
+	}
+	if e.Message != "" {
+		b.WriteString(": " + e.Message)
+	}
+	return b.String()
+}
+
+// apiOperation is an asynchronous operation as returned by the API, either
+// directly or in an operation field
+type apiOperation struct {
+	ID     apiID           `json:"id"`
+	Status string          `json:"status"`
+	Error  json.RawMessage `json:"error"`
+	Result json.RawMessage `json:"result"`
+}
+
+// decodeOperation decodes an operation from body; ok is false when body
+// describes no operation
+func decodeOperation(body []byte) (operation apiOperation, ok bool) {
+	var wrapped struct {
+		Operation *apiOperation `json:"operation"`
+	}
+	if err := json.Unmarshal(body, &wrapped); err == nil && wrapped.Operation != nil {
+		return *wrapped.Operation, true
+	}
+	if err := json.Unmarshal(body, &operation); err != nil || (operation.ID == "" && operation.Status == "") {
+		return apiOperation{}, false
+	}
+	return operation, true
+}
+
+// operationDone reports whether status is final, and whether it is a
+// success. Unknown statuses are treated as pending.
+func operationDone(status string) (done, succeeded bool) {
+	switch strings.ToLower(status) {
+	case "succeeded", "success", "successful", "completed", "complete", "done":
+		return true, true
+	case "failed", "failure", "error", "canceled", "cancelled":
+		return true, false
+	}
+	return false, false
+}
+
+// awaitOperation waits for the completion of the asynchronous operation
+// started by a write answered with 202 Accepted, whose body was read into
+// body. The operation status is polled at the Location header of the
+// response, or at /operations/{id}, until it succeeds, fails or ctx is done.
+//
+// It returns the result of the operation, to be handled like the body of a
+// synchronous response: its result field if any, otherwise the operation
+// itself. When the response describes no operation, the write is considered
+// complete and body is returned as is.
+func (p *Provider) awaitOperation(ctx context.Context, resp *http.Response, body []byte) ([]byte, error) {
+	operation, ok := decodeOperation(body)
+	path := ""
+	if location := resp.Header.Get("Location"); location != "" {
+		var err error
+		if path, err = p.endpointRelativePath(resp.Request.URL, location); err != nil {
+			return nil, fmt.Errorf("operation status error: %w", err)
+		}
+	} else if ok && operation.ID != "" {
+		path = "/operations/" + url.PathEscape(string(operation.ID))
+	}
+	if path == "" {
+		return body, nil
+	}
+
+	interval := p.OperationPollInterval
+	if interval <= 0 {
+		interval = defaultOperationPollInterval
+	}
+	for {
+		if done, succeeded := operationDone(operation.Status); done {
+			if !succeeded {
+				code, message := decodeErrorField(operation.Error, "", "")
+				return nil, &OperationError{ID: string(operation.ID), Status: operation.Status, Code: code, Message: message}
+			}
+			if len(operation.Result) > 0 && string(operation.Result) != "null" {
+				return operation.Result, nil
+			}
+			return body, nil
+		}
+
+		wait := interval
+		if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			wait = min(retryAfter, maxOperationPollInterval)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("waiting for operation %s: %w", operation.ID, ctx.Err())
+		case <-timer.C:
+		}
+
+		var err error
+		if resp, body, err = p.getOperation(ctx, path); err != nil {
+			return nil, err
+		}
+		polled, ok := decodeOperation(body)
+		if !ok {
+			return nil, fmt.Errorf("operation status error: response describes no operation")
+		}
+		if polled.ID == "" {
+			polled.ID = operation.ID
+		}
+		operation = polled
+	}
+}
+
+// getOperation fetches the status of an operation at path
+func (p *Provider) getOperation(ctx context.Context, path string) (*http.Response, []byte, error) {
+	resp, err := p.makeRequest(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("GET request error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("operation status error: %w", newAPIError(resp))
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("body reading error: %w", err)
+	}
+	return resp, body, nil
+}
@@ -0,0 +1,107 @@
+package libdnsimmosquare_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+
+	libdnsimmosquare "github.com/immosquare/libdns-immosquare"
+	"github.com/immosquare/libdns-immosquare/immosquaretest"
+)
+
+func TestAsyncWrites(t *testing.T) {
+	srv := immosquaretest.NewServer("token")
+	defer srv.Close()
+	srv.AddZone("example.com")
+	srv.Async = true
+
+	// The operations are pending the first time they are polled
+	var polls atomic.Int32
+	front := newFront(t, srv, func(w http.ResponseWriter, r *http.Request) bool {
+		if !strings.HasPrefix(r.URL.Path, "/operations/") || polls.Add(1)%2 == 0 {
+			return false
+		}
+		id := strings.TrimPrefix(r.URL.Path, "/operations/")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"operation": map[string]string{"id": id, "status": "pending"}})
+		return true
+	})
+	provider := libdnsimmosquare.NewProvider(front.URL,
+		libdnsimmosquare.WithAPIToken("token"),
+		libdnsimmosquare.WithOperationPollInterval(time.Millisecond),
+	)
+	ctx := context.Background()
+
+	added, err := provider.AppendRecords(ctx, "example.com", []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.1"), TTL: time.Hour},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The IDs come from the result of the operation
+	if len(added) != 1 {
+		t.Fatalf("added = %v, want 1 record", added)
+	}
+	address, _ := added[0].(libdns.Address)
+	if metadata, ok := address.ProviderData.(libdnsimmosquare.RecordMetadata); !ok || metadata.ID == "" {
+		t.Errorf("added = %#v, want the record with its ID", added[0])
+	}
+	if _, err := provider.SetRecords(ctx, "example.com", []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.2"), TTL: time.Hour},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	assertZone(t, srv, "example.com", "www A 192.0.2.2")
+	if _, err := provider.DeleteRecords(ctx, "example.com", []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.2")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	assertZone(t, srv, "example.com")
+	if got := polls.Load(); got != 8 {
+		t.Errorf("%d polls, want 8", got)
+	}
+}
+
+func TestAsyncWriteFailure(t *testing.T) {
+	srv := immosquaretest.NewServer("token")
+	defer srv.Close()
+	srv.AddZone("example.com")
+	srv.Async = true
+
+	front := newFront(t, srv, func(w http.ResponseWriter, r *http.Request) bool {
+		if !strings.HasPrefix(r.URL.Path, "/operations/") {
+			return false
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"operation": map[string]interface{}{
+			"id":     strings.TrimPrefix(r.URL.Path, "/operations/"),
+			"status": "failed",
+			"error":  map[string]string{"code": "quota_exceeded", "message": "too many records"},
+		}})
+		return true
+	})
+	provider := libdnsimmosquare.NewProvider(front.URL,
+		libdnsimmosquare.WithAPIToken("token"),
+		libdnsimmosquare.WithOperationPollInterval(time.Millisecond),
+	)
+
+	_, err := provider.AppendRecords(context.Background(), "example.com", []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.1"), TTL: time.Hour},
+	})
+	var opErr *libdnsimmosquare.OperationError
+	if !errors.As(err, &opErr) {
+		t.Fatalf("err = %v, want an *OperationError", err)
+	}
+	if opErr.Status != "failed" || opErr.Code != "quota_exceeded" || opErr.Message != "too many records" {
+		t.Errorf("operation error = %+v", opErr)
+	}
+}
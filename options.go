@@ -0,0 +1,369 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Option configures a Provider created with NewProvider.
+type Option func(*Provider)
+
+// NewProvider returns a Provider for the API at endpoint, configured with
+// opts. It is equivalent to setting the corresponding struct fields, but new
+// settings can be added as options without changing the public struct.
+func NewProvider(endpoint string, opts ...Option) *Provider {
+	p := &Provider{Endpoint: endpoint}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// WithAPIToken sets the bearer token sent with every request.
+func WithAPIToken(token string) Option {
+	return func(p *Provider) {
+		p.APIToken = token
+	}
+}
+
+// WithAPITokenFile reads the bearer token from the file at path, which is
+// read again whenever it changes, see APITokenFile.
+func WithAPITokenFile(path string) Option {
+	return func(p *Provider) {
+		p.APITokenFile = path
+	}
+}
+
+// WithOAuth2ClientCredentials authenticates with access tokens obtained
+// from tokenURL with the OAuth2 client-credentials flow, instead of a static
+// API token.
+func WithOAuth2ClientCredentials(clientID, clientSecret, tokenURL string, scopes ...string) Option {
+	return func(p *Provider) {
+		p.OAuth2ClientID = clientID
+		p.OAuth2ClientSecret = clientSecret
+		p.OAuth2TokenURL = tokenURL
+		p.OAuth2Scopes = scopes
+	}
+}
+
+// WithOAuth2RefreshToken authenticates with access tokens obtained from
+// tokenURL with the OAuth2 refresh-token grant, instead of a static API
+// token.
+func WithOAuth2RefreshToken(clientID, clientSecret, tokenURL, refreshToken string, scopes ...string) Option {
+	return func(p *Provider) {
+		p.OAuth2ClientID = clientID
+		p.OAuth2ClientSecret = clientSecret
+		p.OAuth2TokenURL = tokenURL
+		p.OAuth2RefreshToken = refreshToken
+		p.OAuth2Scopes = scopes
+	}
+}
+
+// WithTokenRefresher sets the function called for a new API token when a
+// request is rejected with 401, see TokenRefresher.
+func WithTokenRefresher(refresh func(ctx context.Context) (string, error)) Option {
+	return func(p *Provider) {
+		p.TokenRefresher = refresh
+	}
+}
+
+// WithAuthProvider authenticates requests with auth instead of the built-in
+// schemes, see AuthProvider.
+func WithAuthProvider(auth AuthProvider) Option {
+	return func(p *Provider) {
+		p.Auth = auth
+	}
+}
+
+// WithAccountID sets the account requests apply to, see AccountID.
+func WithAccountID(id string) Option {
+	return func(p *Provider) {
+		p.AccountID = id
+	}
+}
+
+// WithAccountIDInPath sends AccountID as a path prefix instead of a header.
+func WithAccountIDInPath() Option {
+	return func(p *Provider) {
+		p.AccountIDInPath = true
+	}
+}
+
+// WithZone sets the credentials and endpoint used for zone, see Zones.
+func WithZone(zone string, config ZoneConfig) Option {
+	return func(p *Provider) {
+		if p.Zones == nil {
+			p.Zones = make(map[string]ZoneConfig)
+		}
+		p.Zones[zone] = config
+	}
+}
+
+// WithTemplate registers template as name, to be applied with
+// ApplyTemplate.
+func WithTemplate(name string, template Template) Option {
+	return func(p *Provider) {
+		if p.Templates == nil {
+			p.Templates = make(map[string]Template)
+		}
+		p.Templates[name] = template
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with every request.
+func WithUserAgent(userAgent string) Option {
+	return func(p *Provider) {
+		p.UserAgent = userAgent
+	}
+}
+
+// WithHeader adds a header sent with every request, see Headers.
+func WithHeader(key, value string) Option {
+	return func(p *Provider) {
+		if p.Headers == nil {
+			p.Headers = make(map[string]string)
+		}
+		p.Headers[key] = value
+	}
+}
+
+// WithHTTPClient sets the HTTP client used to reach the API. The client's
+// own Timeout, if any, applies on top of the read and write timeouts.
+func WithHTTPClient(client *http.Client) Option {
+	return func(p *Provider) {
+		p.client = client
+	}
+}
+
+// WithTLSConfig sets the TLS configuration used to reach the API, e.g. for
+// client certificates or custom root CAs. It is cloned, and CAFile and
+// TLSServerName, if set, apply on top of it. It can't be combined with a
+// WithHTTPClient client whose Transport isn't an *http.Transport.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(p *Provider) {
+		p.tlsConfig = config
+	}
+}
+
+// WithCAFile sets CAFile, a PEM bundle of additional root CAs.
+func WithCAFile(file string) Option {
+	return func(p *Provider) {
+		p.CAFile = file
+	}
+}
+
+// WithTLSServerName sets TLSServerName, overriding the server name used to
+// verify the API certificate.
+func WithTLSServerName(name string) Option {
+	return func(p *Provider) {
+		p.TLSServerName = name
+	}
+}
+
+// WithClientCertificate adds a certificate presented to the API for mutual
+// TLS authentication, in addition to or instead of the API token.
+func WithClientCertificate(certificate tls.Certificate) Option {
+	return func(p *Provider) {
+		p.clientCertificates = append(p.clientCertificates, certificate)
+	}
+}
+
+// WithClientCertificateFiles sets ClientCertFile and ClientKeyFile, the PEM
+// certificate and key used for mutual TLS authentication.
+func WithClientCertificateFiles(certFile, keyFile string) Option {
+	return func(p *Provider) {
+		p.ClientCertFile = certFile
+		p.ClientKeyFile = keyFile
+	}
+}
+
+// WithProxyURL sets ProxyURL, the proxy used to reach the API.
+func WithProxyURL(proxyURL string) Option {
+	return func(p *Provider) {
+		p.ProxyURL = proxyURL
+	}
+}
+
+// WithTimeout sets both the read and the write timeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(p *Provider) {
+		p.ReadTimeout = timeout
+		p.WriteTimeout = timeout
+	}
+}
+
+// WithReadTimeout sets the timeout of read requests (default 60s).
+func WithReadTimeout(timeout time.Duration) Option {
+	return func(p *Provider) {
+		p.ReadTimeout = timeout
+	}
+}
+
+// WithWriteTimeout sets the timeout of write requests (default 30s).
+func WithWriteTimeout(timeout time.Duration) Option {
+	return func(p *Provider) {
+		p.WriteTimeout = timeout
+	}
+}
+
+// WithMinTTL sets MinTTL, the minimum TTL applied by AppendRecords and
+// SetRecords (default 120s).
+func WithMinTTL(ttl time.Duration) Option {
+	return func(p *Provider) {
+		p.MinTTL = ttl
+	}
+}
+
+// WithMaxTTL sets MaxTTL, the maximum TTL applied by AppendRecords and
+// SetRecords (default none).
+func WithMaxTTL(ttl time.Duration) Option {
+	return func(p *Provider) {
+		p.MaxTTL = ttl
+	}
+}
+
+// WithRawTTL sets RawTTL, forwarding TTLs to the API without clamping
+func WithRawTTL() Option {
+	return func(p *Provider) {
+		p.RawTTL = true
+	}
+}
+
+// WithBatchSize sets BatchSize, the maximum number of records per write
+// request (default 500, negative for no limit)
+func WithBatchSize(size int) Option {
+	return func(p *Provider) {
+		p.BatchSize = size
+	}
+}
+
+// WithParallelism sets Parallelism, the maximum number of batches of a
+// write sent concurrently (default 1)
+func WithParallelism(n int) Option {
+	return func(p *Provider) {
+		p.Parallelism = n
+	}
+}
+
+// WithResolveCNAMEConflicts sets ResolveCNAMEConflicts, deleting existing
+// records conflicting with a written CNAME, or the CNAME conflicting with a
+// written record
+func WithResolveCNAMEConflicts() Option {
+	return func(p *Provider) {
+		p.ResolveCNAMEConflicts = true
+	}
+}
+
+// WithOperationPollInterval sets OperationPollInterval, the delay between
+// two polls of an asynchronous write (default 1s)
+func WithOperationPollInterval(interval time.Duration) Option {
+	return func(p *Provider) {
+		p.OperationPollInterval = interval
+	}
+}
+
+// WithFallbackEndpoints sets FallbackEndpoints, the endpoints tried when
+// the primary one fails
+func WithFallbackEndpoints(endpoints ...string) Option {
+	return func(p *Provider) {
+		p.FallbackEndpoints = endpoints
+	}
+}
+
+// WithCacheTTL sets CacheTTL, enabling the GetRecords cache
+func WithCacheTTL(ttl time.Duration) Option {
+	return func(p *Provider) {
+		p.CacheTTL = ttl
+	}
+}
+
+// WithSerialSource sets SerialSource, revalidating the GetRecords cache
+// against the SOA serial of zones read from source, SerialSourceAPI or
+// SerialSourceDNS.
+func WithSerialSource(source string) Option {
+	return func(p *Provider) {
+		p.SerialSource = source
+	}
+}
+
+// WithDynamicUpdateFallback sets DynamicUpdate, falling back to RFC 2136
+// updates sent to nameserver, signed with tsig if not nil, when the API is
+// unreachable.
+func WithDynamicUpdateFallback(nameserver string, tsig *TSIGKey) Option {
+	return func(p *Provider) {
+		p.DynamicUpdate = &DynamicUpdateConfig{Nameserver: nameserver, TSIG: tsig}
+	}
+}
+
+// WithLogger sets the logger receiving debug logs about API requests
+// (method, path, status, duration) and retries. Credentials and request
+// headers are never logged.
+func WithLogger(logger *slog.Logger) Option {
+	return func(p *Provider) {
+		p.logger = logger
+	}
+}
+
+// WithMetrics sets the recorder of API metrics, see the metrics subpackage
+// for a Prometheus implementation.
+func WithMetrics(metrics Metrics) Option {
+	return func(p *Provider) {
+		p.metrics = metrics
+	}
+}
+
+// WithDebug dumps every HTTP request and response, bodies included, to w
+// with credentials redacted.
+func WithDebug(w io.Writer) Option {
+	return func(p *Provider) {
+		p.Debug = true
+		p.debugWriter = w
+	}
+}
+
+// WithMaxRetries sets the number of retries after a transient failure;
+// a negative value disables retries.
+func WithMaxRetries(retries int) Option {
+	return func(p *Provider) {
+		p.MaxRetries = retries
+	}
+}
+
+// WithRateLimit limits requests to rps per second, allowing bursts of burst
+// requests.
+func WithRateLimit(rps float64, burst int) Option {
+	return func(p *Provider) {
+		p.RateLimit = rps
+		p.RateLimitBurst = burst
+	}
+}
+
+// WithOwnership enables the ownership mode with the given owner ID and
+// marker prefix, "_owner." if empty, see OwnerID.
+func WithOwnership(ownerID, prefix string) Option {
+	return func(p *Provider) {
+		p.OwnerID = ownerID
+		p.OwnershipPrefix = prefix
+	}
+}
+
+// WithWriteVerification makes AppendRecords and SetRecords check that the
+// authoritative nameservers serve the written records, for up to timeout,
+// 2m if zero, see VerifyWrites.
+func WithWriteVerification(timeout time.Duration) Option {
+	return func(p *Provider) {
+		p.VerifyWrites = true
+		p.VerifyTimeout = timeout
+	}
+}
+
+// WithPageSize sets the number of records requested per page by GetRecords.
+func WithPageSize(size int) Option {
+	return func(p *Provider) {
+		p.PageSize = size
+	}
+}
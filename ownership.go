@@ -0,0 +1,274 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+const (
+	// defaultOwnershipPrefix is prepended to record names to get the names
+	// of their ownership markers when OwnershipPrefix is not set
+	defaultOwnershipPrefix = "_owner."
+
+	// ownershipHeritage identifies the ownership markers written by this
+	// provider among the other TXT records
+	ownershipHeritage = "libdns-immosquare"
+)
+
+// ownership holds the ownership markers of a zone, for the ownership mode
+// enabled by OwnerID. Each RRset written in that mode gets a TXT marker
+// "heritage=libdns-immosquare,owner=<OwnerID>,type=<type>" at the marker
+// name of the RRset, see markerName, and existing RRsets can only be
+// changed by the owner of their marker.
+type ownership struct {
+	owner  string
+	prefix string
+	ttl    time.Duration
+
+	// members counts the records of each RRset of the zone
+	members map[rrsetKey]int
+	// markers are the ownership markers of the zone, by lowercase name
+	markers map[string][]libdns.Record
+}
+
+// loadOwnership reads the records of zone and their ownership markers. It
+// returns nil when the ownership mode is disabled, for which the methods
+// of ownership check and return nothing. When the API is unreachable and
+// DynamicUpdate is set, the zone is transferred from its nameserver
+// instead, so the DNS UPDATE fallback works in the ownership mode too.
+func (p *Provider) loadOwnership(ctx context.Context, zone string) (*ownership, error) {
+	if p.OwnerID == "" {
+		return nil, nil
+	}
+	records, err := p.fetchRecords(ctx, zone)
+	if err != nil && p.DynamicUpdate != nil && apiUnreachable(ctx, err) {
+		transferred, transferErr := TransferZone(ctx, zone, p.DynamicUpdate.Nameserver, p.DynamicUpdate.TSIG)
+		if transferErr != nil {
+			return nil, errors.Join(
+				fmt.Errorf("error fetching the ownership markers: %w", err),
+				fmt.Errorf("zone transfer fallback error: %w", transferErr),
+			)
+		}
+		records, err = transferred, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching the ownership markers: %w", err)
+	}
+	return p.ownershipOf(ctx, records), nil
+}
+
+// ownershipOf returns the ownership of the zone holding records, like
+// loadOwnership does, nil when the ownership mode is disabled. With no
+// records, it is only good for telling markers apart, see isMarker.
+func (p *Provider) ownershipOf(ctx context.Context, records []libdns.Record) *ownership {
+	if p.OwnerID == "" {
+		return nil
+	}
+	o := &ownership{
+		owner:   p.OwnerID,
+		prefix:  p.OwnershipPrefix,
+		ttl:     p.ttlLimits(ctx).clamp(0),
+		members: make(map[rrsetKey]int),
+		markers: make(map[string][]libdns.Record),
+	}
+	if o.prefix == "" {
+		o.prefix = defaultOwnershipPrefix
+	}
+	for _, record := range records {
+		rr := record.RR()
+		key := keyOf(rr)
+		o.members[key]++
+		if _, _, ok := parseOwnershipMarker(rr); ok {
+			o.markers[key.name] = append(o.markers[key.name], record)
+		}
+	}
+	return o
+}
+
+// check returns an error matching ErrNotOwned if one of the RRsets of
+// records exists and is not owned by this provider. A record without type
+// stands for every RRset of its name, as in DeleteRecords.
+func (o *ownership) check(records ...[]libdns.Record) error {
+	if o == nil {
+		return nil
+	}
+	for _, batch := range records {
+		for _, record := range batch {
+			for _, key := range o.existingKeys(keyOf(record.RR())) {
+				if owner, _ := o.ownerOf(key); owner != o.owner {
+					if owner == "" {
+						return fmt.Errorf("%w: the %s %s records have no owner", ErrNotOwned, key.name, key.rtype)
+					}
+					return fmt.Errorf("%w: the %s %s records are owned by %q", ErrNotOwned, key.name, key.rtype, owner)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// claims returns the markers to add for the RRsets of added that this
+// provider doesn't own a marker of yet
+func (o *ownership) claims(added []libdns.Record) []libdns.Record {
+	if o == nil {
+		return nil
+	}
+	var claims []libdns.Record
+	seen := make(map[rrsetKey]bool)
+	for _, record := range added {
+		key := keyOf(record.RR())
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if _, marker := o.ownerOf(key); marker == nil {
+			claims = append(claims, libdns.TXT{
+				Name: o.markerName(key.name),
+				Text: fmt.Sprintf("heritage=%s,owner=%s,type=%s", ownershipHeritage, o.owner, key.rtype),
+				TTL:  o.ttl,
+			})
+		}
+	}
+	return claims
+}
+
+// releases returns the markers of this provider to delete for the RRsets
+// left empty once deleted are deleted and added are added. A deleted record
+// without data stands for its whole RRset, as in DeleteRecords.
+func (o *ownership) releases(deleted, added []libdns.Record) []libdns.Record {
+	if o == nil {
+		return nil
+	}
+	remaining := make(map[rrsetKey]int)
+	for _, record := range deleted {
+		rr := record.RR()
+		for _, key := range o.existingKeys(keyOf(rr)) {
+			if _, ok := remaining[key]; !ok {
+				remaining[key] = o.members[key]
+			}
+			if rr.Data == "" {
+				remaining[key] = 0
+			} else {
+				remaining[key]--
+			}
+		}
+	}
+	for _, record := range added {
+		remaining[keyOf(record.RR())]++
+	}
+
+	var releases []libdns.Record
+	for key, count := range remaining {
+		if count > 0 {
+			continue
+		}
+		if _, marker := o.ownerOf(key); marker != nil {
+			releases = append(releases, marker)
+		}
+	}
+	return releases
+}
+
+// existingKeys returns key if its RRset exists, or the keys of the RRsets
+// of its name if it has no type
+func (o *ownership) existingKeys(key rrsetKey) []rrsetKey {
+	if key.rtype != "" {
+		if o.members[key] == 0 {
+			return nil
+		}
+		return []rrsetKey{key}
+	}
+	var keys []rrsetKey
+	for existing, count := range o.members {
+		if existing.name == key.name && count > 0 {
+			keys = append(keys, existing)
+		}
+	}
+	return keys
+}
+
+// ownerOf returns the owner of the RRset with the given key, empty if it
+// has no marker, and the marker of this provider for it, if any
+func (o *ownership) ownerOf(key rrsetKey) (string, libdns.Record) {
+	var owner string
+	for _, marker := range o.markers[keyOf(libdns.RR{Name: o.markerName(key.name)}).name] {
+		markerOwner, rtype, _ := parseOwnershipMarker(marker.RR())
+		if rtype != key.rtype {
+			continue
+		}
+		if markerOwner == o.owner {
+			return markerOwner, marker
+		}
+		owner = markerOwner
+	}
+	return owner, nil
+}
+
+// isMarker reports whether rr is an ownership marker: a TXT record in the
+// format written by claims, at a marker name, see markerName
+func (o *ownership) isMarker(rr libdns.RR) bool {
+	if _, _, ok := parseOwnershipMarker(rr); !ok {
+		return false
+	}
+	name, prefix := keyOf(rr).name, strings.ToLower(o.prefix)
+	return name == strings.TrimSuffix(prefix, ".") || strings.HasPrefix(name, prefix)
+}
+
+// withoutMarkers returns records without their ownership markers, which are
+// written and deleted along with the RRsets they own, see claims and
+// releases, rather than as records of their own. records is returned as is
+// when o is nil.
+func (o *ownership) withoutMarkers(records []libdns.Record) []libdns.Record {
+	if o == nil {
+		return records
+	}
+	kept := make([]libdns.Record, 0, len(records))
+	for _, record := range records {
+		if !o.isMarker(record.RR()) {
+			kept = append(kept, record)
+		}
+	}
+	return kept
+}
+
+// markerName returns the name of the ownership markers of the RRsets named
+// name: the prefix followed by the name, with a leading wildcard label
+// spelled "_wildcard", or the prefix without trailing dot for the apex
+func (o *ownership) markerName(name string) string {
+	if name == apexName {
+		return strings.TrimSuffix(o.prefix, ".")
+	}
+	if name == "*" || strings.HasPrefix(name, "*.") {
+		name = "_wildcard" + name[1:]
+	}
+	return o.prefix + name
+}
+
+// parseOwnershipMarker returns the owner and the RRset type of an ownership
+// marker, ok is false if rr is not one
+func parseOwnershipMarker(rr libdns.RR) (owner, rtype string, ok bool) {
+	if !strings.EqualFold(rr.Type, "TXT") {
+		return "", "", false
+	}
+	var heritage string
+	for _, field := range strings.Split(rr.Data, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		switch name {
+		case "heritage":
+			heritage = value
+		case "owner":
+			owner = value
+		case "type":
+			rtype = strings.ToUpper(value)
+		}
+	}
+	if heritage != ownershipHeritage || owner == "" || rtype == "" {
+		return "", "", false
+	}
+	return owner, rtype, true
+}
@@ -0,0 +1,151 @@
+package libdnsimmosquare_test
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+
+	libdnsimmosquare "github.com/immosquare/libdns-immosquare"
+	"github.com/immosquare/libdns-immosquare/immosquaretest"
+)
+
+func TestOwnership(t *testing.T) {
+	srv := immosquaretest.NewServer("token")
+	defer srv.Close()
+	srv.AddZone("example.com",
+		immosquaretest.Record{Name: "legacy", Type: "A", Value: "192.0.2.1", TTL: 3600},
+		immosquaretest.Record{Name: "other", Type: "A", Value: "192.0.2.2", TTL: 3600},
+		immosquaretest.Record{Name: "_owner.other", Type: "TXT", Value: "heritage=libdns-immosquare,owner=other,type=A", TTL: 3600})
+	ctx := context.Background()
+	provider := srv.Provider(libdnsimmosquare.WithOwnership("me", ""))
+	www := func(ip string) libdns.Record {
+		return libdns.Address{Name: "www", IP: netip.MustParseAddr(ip), TTL: time.Hour}
+	}
+	unowned := []string{
+		"legacy A 192.0.2.1",
+		"other A 192.0.2.2",
+		"_owner.other TXT heritage=libdns-immosquare,owner=other,type=A",
+	}
+
+	// New RRsets are claimed, once
+	if _, err := provider.AppendRecords(ctx, "example.com", []libdns.Record{
+		www("192.0.2.3"),
+		libdns.TXT{Name: "@", Text: "hello", TTL: time.Hour},
+		libdns.CNAME{Name: "*.app", Target: "www.example.com.", TTL: time.Hour},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.AppendRecords(ctx, "example.com", []libdns.Record{www("192.0.2.4")}); err != nil {
+		t.Fatal(err)
+	}
+	assertZone(t, srv, "example.com", append([]string{
+		"www A 192.0.2.3",
+		"www A 192.0.2.4",
+		"_owner.www TXT heritage=libdns-immosquare,owner=me,type=A",
+		"@ TXT hello",
+		"_owner TXT heritage=libdns-immosquare,owner=me,type=TXT",
+		"*.app CNAME www.example.com.",
+		"_owner._wildcard.app TXT heritage=libdns-immosquare,owner=me,type=CNAME",
+	}, unowned...)...)
+
+	// RRsets without a marker of this owner are left alone
+	for name, write := range map[string]func() error{
+		"AppendRecords": func() error {
+			_, err := provider.AppendRecords(ctx, "example.com", []libdns.Record{
+				libdns.Address{Name: "legacy", IP: netip.MustParseAddr("192.0.2.5"), TTL: time.Hour},
+			})
+			return err
+		},
+		"SetRecords": func() error {
+			_, err := provider.SetRecords(ctx, "example.com", []libdns.Record{
+				libdns.Address{Name: "other", IP: netip.MustParseAddr("192.0.2.5"), TTL: time.Hour},
+			})
+			return err
+		},
+		"DeleteRecords": func() error {
+			_, err := provider.DeleteRecords(ctx, "example.com", []libdns.Record{libdns.RR{Name: "legacy"}})
+			return err
+		},
+	} {
+		if err := write(); !errors.Is(err, libdnsimmosquare.ErrNotOwned) {
+			t.Errorf("%s: err = %v, want ErrNotOwned", name, err)
+		}
+	}
+
+	// The marker is released along with the last record of its RRset
+	if _, err := provider.DeleteRecords(ctx, "example.com", []libdns.Record{www("192.0.2.3")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.DeleteRecords(ctx, "example.com", []libdns.Record{
+		www("192.0.2.4"),
+		libdns.TXT{Name: "@", Text: "hello"},
+		libdns.CNAME{Name: "*.app", Target: "www.example.com."},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	assertZone(t, srv, "example.com", unowned...)
+}
+
+// TestCopyOwnership checks that the ownership markers of the source are not
+// copied, the RRsets written being claimed for the destination's owner
+func TestCopyOwnership(t *testing.T) {
+	ctx := context.Background()
+	// newServer returns a server with an example.org zone and an
+	// example.com one holding an RRset owned by another provider
+	newServer := func() *immosquaretest.Server {
+		srv := immosquaretest.NewServer("token")
+		srv.AddZone("example.com")
+		srv.AddZone("example.org")
+		src := srv.Provider(libdnsimmosquare.WithOwnership("other", ""))
+		if _, err := src.AppendRecords(ctx, "example.com", []libdns.Record{
+			libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.1"), TTL: time.Hour},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return srv
+	}
+	want := []string{
+		"_owner.www TXT heritage=libdns-immosquare,owner=me,type=A",
+		"www A 192.0.2.1",
+	}
+
+	t.Run("CloneZone", func(t *testing.T) {
+		srv := newServer()
+		defer srv.Close()
+		provider := srv.Provider(libdnsimmosquare.WithOwnership("me", ""))
+		if _, err := provider.CloneZone(ctx, "example.com", "example.org", libdnsimmosquare.CloneOptions{Replace: true}); err != nil {
+			t.Fatal(err)
+		}
+		assertZone(t, srv, "example.org", want...)
+	})
+
+	t.Run("ImportFromProvider", func(t *testing.T) {
+		src, srv := newServer(), immosquaretest.NewServer("token")
+		defer src.Close()
+		defer srv.Close()
+		srv.AddZone("example.com")
+		provider := srv.Provider(libdnsimmosquare.WithOwnership("me", ""))
+		if _, err := provider.ImportFromProvider(ctx, src.Provider(), "example.com", libdnsimmosquare.ImportOptions{Replace: true}); err != nil {
+			t.Fatal(err)
+		}
+		assertZone(t, srv, "example.com", want...)
+	})
+
+	t.Run("ImportZoneFile", func(t *testing.T) {
+		srv := newServer()
+		defer srv.Close()
+		provider := srv.Provider(libdnsimmosquare.WithOwnership("me", ""))
+		file := `_owner.www 3600 IN TXT "heritage=libdns-immosquare,owner=other,type=A"
+www 3600 IN A 192.0.2.1
+`
+		if _, err := provider.ImportZoneFile(ctx, "example.org", strings.NewReader(file), libdnsimmosquare.ImportOptions{Replace: true}); err != nil {
+			t.Fatal(err)
+		}
+		assertZone(t, srv, "example.org", want...)
+	})
+}
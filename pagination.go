@@ -0,0 +1,224 @@
+package libdnsimmosquare
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// recordsPage is a decoded page of GetRecords results
+type recordsPage struct {
+	records []apiRecord
+	// next is the path of the next page, empty on the last page
+	next string
+}
+
+// apiRecordsResponse is the object form of a GetRecords response.
+// Pagination metadata is optional; when absent the response is a single page.
+type apiRecordsResponse struct {
+	Records    []apiRecord `json:"records"`
+	NextCursor string      `json:"next_cursor"`
+	Meta       struct {
+		Page       int    `json:"page"`
+		TotalPages int    `json:"total_pages"`
+		NextCursor string `json:"next_cursor"`
+	} `json:"meta"`
+}
+
+// decodeRecordsResponse decodes a GetRecords response, either an
+// apiRecordsResponse object or a bare array of records, one record at a
+// time so the raw body is never held in memory as a whole.
+func decodeRecordsResponse(r io.Reader) (*apiRecordsResponse, error) {
+	dec := json.NewDecoder(r)
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	response := &apiRecordsResponse{}
+	switch tok {
+	case json.Delim('['):
+		response.Records, err = decodeRecordsArray(dec, false)
+		return response, err
+	case json.Delim('{'):
+	default:
+		return nil, fmt.Errorf("unexpected %v, want an object or an array", tok)
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch key, _ := tok.(string); key {
+		case "records":
+			response.Records, err = decodeRecordsArray(dec, true)
+		case "next_cursor":
+			err = dec.Decode(&response.NextCursor)
+		case "meta":
+			err = dec.Decode(&response.Meta)
+		default:
+			var ignored json.RawMessage
+			err = dec.Decode(&ignored)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("field %v: %w", tok, err)
+		}
+	}
+	// Consume the closing brace
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// decodeRecordsArray decodes the elements of a JSON array of records. When
+// readOpening is true, the opening bracket is read first and null is
+// accepted; otherwise it must have been read already.
+func decodeRecordsArray(dec *json.Decoder, readOpening bool) ([]apiRecord, error) {
+	if readOpening {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if tok == nil {
+			return nil, nil
+		}
+		if tok != json.Delim('[') {
+			return nil, fmt.Errorf("unexpected %v, want an array", tok)
+		}
+	}
+	var records []apiRecord
+	for dec.More() {
+		var record apiRecord
+		if err := dec.Decode(&record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	// Consume the closing bracket
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// firstRecordsPagePath returns the path of the first page of records for
+// zone, with the name and type query parameters of filter
+func (p *Provider) firstRecordsPagePath(zone string, filter RecordFilter) string {
+	path := zonePath(zone) + "/records"
+	key := keyOf(libdns.RR{Name: filter.Name, Type: filter.Type})
+	params := map[string]string{"type": key.rtype}
+	if filter.Name != "" {
+		params["name"] = key.name
+	}
+	if p.PageSize > 0 {
+		params["page"] = "1"
+		params["per_page"] = strconv.Itoa(p.PageSize)
+	}
+	return withQuery(path, params)
+}
+
+// nextRecordsPagePath works out the path of the page following the one at
+// path, supporting in order of precedence: a Link header with rel="next",
+// a next_cursor field and page/total_pages metadata.
+// It returns an empty path when there are no more pages.
+func (p *Provider) nextRecordsPagePath(resp *http.Response, path string, page *apiRecordsResponse) (string, error) {
+	if len(page.Records) == 0 {
+		return "", nil
+	}
+
+	var next string
+	if link := nextLink(resp.Header.Values("Link")); link != "" {
+		var err error
+		next, err = p.endpointRelativePath(resp.Request.URL, link)
+		if err != nil {
+			return "", err
+		}
+	} else if cursor := firstNonEmpty(page.NextCursor, page.Meta.NextCursor); cursor != "" {
+		next = withQuery(path, map[string]string{"cursor": cursor, "page": ""})
+	} else if page.Meta.TotalPages > 0 && page.Meta.Page < page.Meta.TotalPages {
+		next = withQuery(path, map[string]string{"page": strconv.Itoa(page.Meta.Page + 1)})
+	}
+
+	// Guard against servers that keep pointing at the same page
+	if next == path {
+		return "", nil
+	}
+	return next, nil
+}
+
+// endpointRelativePath resolves a pagination link against the request URL and
+// returns it relative to the configured endpoint it belongs to, and to the
+// account prefix if any. Links leaving the endpoints are rejected so the API
+// token is never sent to another server.
+func (p *Provider) endpointRelativePath(base *url.URL, link string) (string, error) {
+	ref, err := url.Parse(link)
+	if err != nil {
+		return "", fmt.Errorf("invalid pagination link %q: %w", link, err)
+	}
+	resolved := base.ResolveReference(ref).String()
+	for _, endpoint := range p.knownEndpoints() {
+		endpoint = strings.TrimSuffix(endpoint, "/") + p.accountPrefix()
+		if strings.HasPrefix(resolved, endpoint+"/") {
+			return strings.TrimPrefix(resolved, endpoint), nil
+		}
+	}
+	return "", fmt.Errorf("pagination link %q is outside of the API endpoint", link)
+}
+
+// nextLink extracts the rel="next" target from Link header values (RFC 8288)
+func nextLink(values []string) string {
+	for _, value := range values {
+		for _, link := range strings.Split(value, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, param := range parts[1:] {
+				param = strings.ReplaceAll(strings.TrimSpace(param), " ", "")
+				if param == `rel="next"` || param == "rel=next" {
+					return strings.Trim(target, "<>")
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// withQuery returns path with the given query parameters set. An empty
+// value removes the parameter.
+func withQuery(path string, params map[string]string) string {
+	rawPath, rawQuery, _ := strings.Cut(path, "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		query = url.Values{}
+	}
+	for key, value := range params {
+		if value == "" {
+			query.Del(key)
+		} else {
+			query.Set(key, value)
+		}
+	}
+	if len(query) == 0 {
+		return rawPath
+	}
+	return rawPath + "?" + query.Encode()
+}
+
+// firstNonEmpty returns the first non-empty string
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
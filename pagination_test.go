@@ -0,0 +1,97 @@
+package libdnsimmosquare_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	libdnsimmosquare "github.com/immosquare/libdns-immosquare"
+	"github.com/immosquare/libdns-immosquare/immosquaretest"
+)
+
+func TestGetRecordsPagination(t *testing.T) {
+	srv := immosquaretest.NewServer("token")
+	defer srv.Close()
+	srv.AddZone("example.com",
+		immosquaretest.Record{Name: "a", Type: "A", Value: "192.0.2.1", TTL: 300},
+		immosquaretest.Record{Name: "b", Type: "A", Value: "192.0.2.2", TTL: 300},
+		immosquaretest.Record{Name: "c", Type: "A", Value: "192.0.2.3", TTL: 300},
+		immosquaretest.Record{Name: "d", Type: "A", Value: "192.0.2.4", TTL: 300},
+		immosquaretest.Record{Name: "e", Type: "A", Value: "192.0.2.5", TTL: 300})
+
+	// Each page points to the next one a different way: a Link header, a
+	// cursor, then page metadata
+	var mu sync.Mutex
+	var queries []string
+	front := newFront(t, srv, func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method != http.MethodGet || r.URL.Path != "/zones/example.com/records" {
+			return false
+		}
+		mu.Lock()
+		queries = append(queries, r.URL.RawQuery)
+		mu.Unlock()
+		records := srv.Records("example.com")
+		body := map[string]interface{}{}
+		switch query := r.URL.Query(); {
+		case query.Get("cursor") == "c" && query.Get("page") == "":
+			body["records"] = records[4:]
+			body["meta"] = map[string]int{"page": 3, "total_pages": 3}
+		case query.Get("page") == "2":
+			body["records"] = records[2:4]
+			body["next_cursor"] = "c"
+		case len(query) == 0:
+			body["records"] = records[:2]
+			w.Header().Set("Link", `</zones/example.com/records?page=2>; rel="next"`)
+		default:
+			t.Errorf("unexpected query %q", r.URL.RawQuery)
+		}
+		json.NewEncoder(w).Encode(body)
+		return true
+	})
+
+	provider := libdnsimmosquare.NewProvider(front.URL, libdnsimmosquare.WithAPIToken("token"))
+	records, err := provider.GetRecords(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, record := range records {
+		names = append(names, record.RR().Name)
+	}
+	if got := strings.Join(names, ","); got != "a,b,c,d,e" {
+		t.Errorf("records = %s, want a,b,c,d,e", got)
+	}
+	if got := strings.Join(queries, " "); got != " page=2 cursor=c" {
+		t.Errorf("queries = %q, want %q", got, " page=2 cursor=c")
+	}
+}
+
+func TestGetRecordsPaginationForeignLink(t *testing.T) {
+	srv := immosquaretest.NewServer("token")
+	defer srv.Close()
+	srv.AddZone("example.com", immosquaretest.Record{Name: "a", Type: "A", Value: "192.0.2.1", TTL: 300})
+
+	// The token must not be sent to another server
+	var followed bool
+	other := newFront(t, srv, func(w http.ResponseWriter, r *http.Request) bool {
+		followed = true
+		return false
+	})
+	front := newFront(t, srv, func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == http.MethodGet && r.URL.Path == "/zones/example.com/records" {
+			w.Header().Set("Link", "<"+other.URL+`/zones/example.com/records?page=2>; rel="next"`)
+		}
+		return false
+	})
+
+	provider := libdnsimmosquare.NewProvider(front.URL, libdnsimmosquare.WithAPIToken("token"))
+	if _, err := provider.GetRecords(context.Background(), "example.com"); err == nil || !strings.Contains(err.Error(), "outside of the API endpoint") {
+		t.Errorf("err = %v, want a pagination link error", err)
+	}
+	if followed {
+		t.Error("the pagination link to another server was followed")
+	}
+}
@@ -0,0 +1,134 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// MailPreset names a bundle of the records a mail provider needs, applied
+// with ApplyPreset.
+type MailPreset string
+
+// Mail presets
+const (
+	// PresetGoogleWorkspace is Google Workspace (Gmail)
+	PresetGoogleWorkspace MailPreset = "google-workspace"
+	// PresetMicrosoft365 is Microsoft 365 (Exchange Online)
+	PresetMicrosoft365 MailPreset = "microsoft-365"
+	// PresetOVHcloud is the OVHcloud MX Plan and Email Pro offers
+	PresetOVHcloud MailPreset = "ovhcloud"
+	// PresetGandi is Gandi mailboxes
+	PresetGandi MailPreset = "gandi"
+	// PresetIONOS is IONOS (1&1) France mailboxes
+	PresetIONOS MailPreset = "ionos"
+)
+
+// mailPreset is the content of a MailPreset for a zone
+type mailPreset struct {
+	// rrsets replace the RRsets of the same name and type
+	rrsets []rrsetValues
+	// spfInclude is merged into the SPF record of the apex
+	spfInclude string
+}
+
+// mailPresets returns the content of each MailPreset for zone
+var mailPresets = map[MailPreset]func(zone string) mailPreset{
+	PresetGoogleWorkspace: func(string) mailPreset {
+		return mailPreset{
+			rrsets:     []rrsetValues{{apexName, "MX", []string{"1 smtp.google.com."}}},
+			spfInclude: "include:_spf.google.com",
+		}
+	},
+	PresetMicrosoft365: func(zone string) mailPreset {
+		mx := strings.ReplaceAll(normalizeZone(zone), ".", "-") + ".mail.protection.outlook.com."
+		return mailPreset{
+			rrsets: []rrsetValues{
+				{apexName, "MX", []string{"0 " + mx}},
+				{"autodiscover", "CNAME", []string{"autodiscover.outlook.com."}},
+			},
+			spfInclude: "include:spf.protection.outlook.com",
+		}
+	},
+	PresetOVHcloud: func(string) mailPreset {
+		return mailPreset{
+			rrsets: []rrsetValues{
+				{apexName, "MX", []string{"1 mx1.mail.ovh.net.", "5 mx2.mail.ovh.net.", "100 mx3.mail.ovh.net."}},
+				{"autoconfig", "CNAME", []string{"mailconfig.ovh.net."}},
+				{"_autodiscover._tcp", "SRV", []string{"0 0 443 mailconfig.ovh.net."}},
+			},
+			spfInclude: "include:mx.ovh.com",
+		}
+	},
+	PresetGandi: func(string) mailPreset {
+		return mailPreset{
+			rrsets: []rrsetValues{
+				{apexName, "MX", []string{"10 spool.mail.gandi.net.", "50 fb.mail.gandi.net."}},
+				{"webmail", "CNAME", []string{"webmail.gandi.net."}},
+			},
+			spfInclude: "include:_mailcust.gandi.net",
+		}
+	},
+	PresetIONOS: func(string) mailPreset {
+		return mailPreset{
+			rrsets: []rrsetValues{
+				{apexName, "MX", []string{"10 mx00.ionos.fr.", "10 mx01.ionos.fr."}},
+				{"autodiscover", "CNAME", []string{"adsredir.ionos.info."}},
+			},
+			spfInclude: "include:_spf-eu.ionos.com",
+		}
+	},
+}
+
+// MailPresets returns the names of the available mail presets, sorted.
+func MailPresets() []MailPreset {
+	presets := make([]MailPreset, 0, len(mailPresets))
+	for preset := range mailPresets {
+		presets = append(presets, preset)
+	}
+	sort.Slice(presets, func(i, j int) bool { return presets[i] < presets[j] })
+	return presets
+}
+
+// PresetOptions holds the customer-specific values of ApplyPreset.
+type PresetOptions struct {
+	// Verification, if set, is the domain ownership verification TXT
+	// value given by the provider, e.g. "google-site-verification=..." or
+	// "MS=ms12345678", added to the apex alongside its other TXT records
+	Verification string
+}
+
+// ApplyPreset sets zone up for the mail provider preset in one call: the MX
+// records of the apex and the provider CNAME and SRV records, such as
+// autodiscover, replace the current ones of their name and type with
+// ReplaceRRSet; the provider SPF include is merged into the apex SPF record
+// with MergeSPF; and the verification TXT record, if any, is added with
+// EnsureTXT. The changes are made one after the other and the function
+// stops at the first failure. It returns the records of the preset.
+func (p *Provider) ApplyPreset(ctx context.Context, zone string, preset MailPreset, opts PresetOptions) ([]libdns.Record, error) {
+	content, ok := mailPresets[preset]
+	if !ok {
+		return nil, fmt.Errorf("unknown mail preset %q, available presets: %v", preset, MailPresets())
+	}
+	bundle := content(zone)
+
+	records, err := p.replaceRRSets(ctx, zone, bundle.rrsets)
+	if err != nil {
+		return records, err
+	}
+	if opts.Verification != "" {
+		record, err := p.EnsureTXT(ctx, zone, apexName, opts.Verification, 0)
+		if err != nil {
+			return records, fmt.Errorf("error adding the verification record: %w", err)
+		}
+		records = append(records, record)
+	}
+	spf, err := p.MergeSPF(ctx, zone, bundle.spfInclude)
+	if err != nil {
+		return records, err
+	}
+	return append(records, spf), nil
+}
@@ -0,0 +1,217 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+const (
+	// defaultPropagationTimeout bounds WaitForPropagation when
+	// PropagationOptions.Timeout is not set
+	defaultPropagationTimeout = 2 * time.Minute
+
+	// defaultPropagationInterval is the delay between two polls
+	defaultPropagationInterval = 2 * time.Second
+
+	// dnsQueryTimeout is the timeout of a single DNS query
+	dnsQueryTimeout = 5 * time.Second
+)
+
+// PropagationOptions configures WaitForPropagation
+type PropagationOptions struct {
+	// Nameservers to poll, as "host" or "host:port". Defaults to the
+	// Nameservers of the provider, or else to the authoritative nameservers
+	// of the zone, found through the system resolver. Custom nameservers
+	// are queried with recursion desired, so public resolvers can be used
+	// too.
+	Nameservers []string
+
+	// Interval between two polls (default 2s)
+	Interval time.Duration
+
+	// Timeout after which waiting fails (default 2m)
+	Timeout time.Duration
+}
+
+// WaitForPropagation polls DNS until every nameserver serves record, or
+// until the timeout or ctx expires. It is typically called after
+// AppendRecords with an ACME DNS-01 challenge, so the CA doesn't check the
+// TXT record before the nameservers have picked it up.
+func (p *Provider) WaitForPropagation(ctx context.Context, zone string, record libdns.Record, opts PropagationOptions) error {
+	rr := record.RR()
+	// Names may be given as FQDNs or with the zone suffix, like for
+	// AppendRecords
+	rr.Name = relativeName(rr.Name, zone)
+	qtype, ok := dns.StringToType[strings.ToUpper(rr.Type)]
+	if !ok {
+		return fmt.Errorf("unsupported record type %q", rr.Type)
+	}
+	normalized, err := normalizeRecords([]libdns.Record{rr}, ttlLimits{})
+	if err != nil {
+		return err
+	}
+	want := normalized[0]
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = defaultPropagationTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = defaultPropagationInterval
+	}
+
+	origin := dns.Fqdn(normalizeZone(zone))
+	pending, recursive := nameserverAddresses(opts.Nameservers), true
+	if len(pending) == 0 {
+		if pending, err = p.zoneNameservers(ctx, origin); err != nil {
+			return err
+		}
+		recursive = false
+	}
+
+	name := libdns.AbsoluteName(rr.Name, origin)
+	for attempt := 1; ; attempt++ {
+		remaining := pending[:0]
+		for _, ns := range pending {
+			found, err := queryRecord(ctx, ns, name, qtype, recursive, origin, want)
+			if err != nil {
+				p.logDebug(ctx, "propagation check failed", "nameserver", ns, "name", name, "error", err)
+			}
+			if !found {
+				remaining = append(remaining, ns)
+			}
+		}
+		pending = remaining
+		p.logDebug(ctx, "propagation check", "name", name, "type", rr.Type, "attempt", attempt, "pending", len(pending))
+		if len(pending) == 0 {
+			return nil
+		}
+		if err := sleepContext(ctx, interval); err != nil {
+			return fmt.Errorf("record %s %s not propagated to %s: %w", name, rr.Type, strings.Join(pending, ", "), err)
+		}
+	}
+}
+
+// zoneNameservers returns the addresses of the authoritative nameservers
+// of zone: the Nameservers of the provider if set, or else the NS hosts of
+// zone
+func (p *Provider) zoneNameservers(ctx context.Context, zone string) ([]string, error) {
+	if len(p.Nameservers) > 0 {
+		return nameserverAddresses(p.Nameservers), nil
+	}
+	nameservers, err := authoritativeNameservers(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	return nameserverAddresses(nameservers), nil
+}
+
+// nameserverAddresses returns the "host:port" addresses of nameservers
+// given as "host" or "host:port", port 53 being the default
+func nameserverAddresses(nameservers []string) []string {
+	addresses := make([]string, 0, len(nameservers))
+	for _, ns := range nameservers {
+		if _, _, err := net.SplitHostPort(ns); err != nil {
+			ns = net.JoinHostPort(ns, "53")
+		}
+		addresses = append(addresses, ns)
+	}
+	return addresses
+}
+
+// authoritativeNameservers returns the NS hosts of zone
+func authoritativeNameservers(ctx context.Context, zone string) ([]string, error) {
+	records, err := net.DefaultResolver.LookupNS(ctx, zone)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up nameservers of %s: %w", zone, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("no nameservers found for %s", zone)
+	}
+	nameservers := make([]string, 0, len(records))
+	for _, ns := range records {
+		nameservers = append(nameservers, strings.TrimSuffix(ns.Host, "."))
+	}
+	return nameservers, nil
+}
+
+// queryRecord asks nameserver for name and reports whether the answer
+// contains want
+func queryRecord(ctx context.Context, nameserver, name string, qtype uint16, recursive bool, origin string, want libdns.RR) (bool, error) {
+	served, err := queryRRset(ctx, nameserver, name, qtype, recursive, origin)
+	if err != nil {
+		return false, err
+	}
+	for _, got := range served {
+		if sameData(want.Type, got.Data, want.Data) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// queryRRset asks nameserver for the records of name with type qtype and
+// returns them relative to origin. The NS records of a delegation are read
+// from the authority section of the referral.
+func queryRRset(ctx context.Context, nameserver, name string, qtype uint16, recursive bool, origin string) ([]libdns.RR, error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(name, qtype)
+	msg.RecursionDesired = recursive
+
+	client := &dns.Client{Timeout: dnsQueryTimeout}
+	resp, _, err := client.ExchangeContext(ctx, msg, nameserver)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Truncated {
+		client.Net = "tcp"
+		if resp, _, err = client.ExchangeContext(ctx, msg, nameserver); err != nil {
+			return nil, err
+		}
+	}
+	answers := resp.Answer
+	if qtype == dns.TypeNS && len(answers) == 0 {
+		answers = resp.Ns
+	}
+	var served []libdns.RR
+	for _, answer := range answers {
+		if answer.Header().Rrtype != qtype || !strings.EqualFold(answer.Header().Name, name) {
+			continue
+		}
+		rr, err := fromDNSRR(answer, origin)
+		if err != nil {
+			return nil, err
+		}
+		served = append(served, rr)
+	}
+	return served, nil
+}
+
+// sameData compares record data as served by DNS and as written through
+// the API, ignoring the case and trailing dots of host names. TXT data is
+// compared exactly.
+func sameData(rtype, got, want string) bool {
+	if strings.EqualFold(rtype, "TXT") {
+		return got == want
+	}
+	gotFields, wantFields := strings.Fields(got), strings.Fields(want)
+	if len(gotFields) != len(wantFields) {
+		return false
+	}
+	for i := range gotFields {
+		if !strings.EqualFold(strings.TrimSuffix(gotFields[i], "."), strings.TrimSuffix(wantFields[i], ".")) {
+			return false
+		}
+	}
+	return true
+}
@@ -2,16 +2,24 @@
 package libdnsimmosquare
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/netip"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/libdns/libdns"
+	"golang.org/x/sync/singleflight"
 )
 
 // Version of the libdns-immosquare provider
@@ -22,135 +30,614 @@ const Version = "1.0.4"
 // high zone defaults like 1800s, which slows down DNS propagation.
 const defaultMinTTL = 120 * time.Second
 
+// apiRecord is a DNS record as returned by the API
+type apiRecord struct {
+	ID    apiID  `json:"id"`
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+	TTL   int    `json:"ttl"`
+
+	// CreatedAt is optional, used by CleanupACMEChallenges
+	CreatedAt apiTime `json:"created_at"`
+}
 
+// Provider manages the DNS records of zones through the immosquare API.
+//
+// A Provider is safe for concurrent use by multiple goroutines, e.g. by
+// certmagic issuing several certificates at once. Its fields must not be
+// changed once it has been used. Concurrent writes to the same RRset are
+// not atomic with respect to each other, since SetRecords and Sync read the
+// zone before writing it.
 type Provider struct {
 	APIToken string `json:"api_token,omitempty"`
 	Endpoint string `json:"endpoint"`
-	client *http.Client
+
+	// AccountID selects the account (organization) requests apply to, for
+	// credentials giving access to several accounts. It is sent as the
+	// X-Account-ID header, or as an /accounts/<id> path prefix when
+	// AccountIDInPath is set.
+	AccountID       string `json:"account_id,omitempty"`
+	AccountIDInPath bool   `json:"account_id_in_path,omitempty"`
+
+	// PageSize is the number of records requested per page by GetRecords
+	// (sent as the per_page query parameter). Zero lets the API decide.
+	PageSize int `json:"page_size,omitempty"`
+
+	// MaxRetries is the number of times a request is retried after a
+	// transient failure (network error, 429 or 5xx). Zero uses the default
+	// of 3 retries, a negative value disables retries.
+	MaxRetries int `json:"max_retries,omitempty"`
+
+	// ReadTimeout bounds each attempt of a read request (GET), including
+	// reading the response body. Defaults to 60s, leaving room for large zones.
+	ReadTimeout time.Duration `json:"read_timeout,omitempty"`
+
+	// WriteTimeout bounds each attempt of a write request (POST, PUT,
+	// DELETE), including reading the response body. Defaults to 30s.
+	WriteTimeout time.Duration `json:"write_timeout,omitempty"`
+
+	// RateLimit is the maximum number of requests per second sent to the
+	// API, zero for no limit. Regardless of this setting, requests are paced
+	// according to the X-RateLimit-* headers returned by the API.
+	RateLimit float64 `json:"rate_limit,omitempty"`
+
+	// RateLimitBurst is the number of requests that may be sent at once
+	// before RateLimit applies. Defaults to 1.
+	RateLimitBurst int `json:"rate_limit_burst,omitempty"`
+
+	// MinTTL is the minimum TTL of records written by AppendRecords and
+	// SetRecords; lower TTLs are raised to it. Defaults to 120s.
+	MinTTL time.Duration `json:"min_ttl,omitempty"`
+
+	// MaxTTL is the maximum TTL of records written by AppendRecords and
+	// SetRecords; higher TTLs are lowered to it. Zero means no maximum.
+	MaxTTL time.Duration `json:"max_ttl,omitempty"`
+
+	// RawTTL disables MinTTL and MaxTTL, forwarding TTLs to the API as
+	// given, e.g. TTL 0 for the zone default. Use ContextWithRawTTL to do
+	// so for a single call.
+	RawTTL bool `json:"raw_ttl,omitempty"`
+
+	// BatchSize is the maximum number of records sent in a single write
+	// request; larger inputs are split into several requests. Zero uses the
+	// default of 500, a negative value disables batching.
+	BatchSize int `json:"batch_size,omitempty"`
+
+	// Parallelism is the maximum number of batches of a write sent
+	// concurrently. Defaults to 1, sending batches one after the other.
+	Parallelism int `json:"parallelism,omitempty"`
+
+	// ResolveCNAMEConflicts makes SetRecords, UpsertRecord and ReplaceRRSet
+	// delete the existing records conflicting with the written ones: the
+	// other records at the name of a CNAME, or the CNAME at the name of
+	// another record. By default such writes are rejected.
+	ResolveCNAMEConflicts bool `json:"resolve_cname_conflicts,omitempty"`
+
+	// OwnerID enables the ownership mode: every RRset written by this
+	// provider gets a companion TXT marker naming OwnerID as its owner,
+	// and writes changing existing RRsets without such a marker, e.g.
+	// created by hand or by another client, are refused with an error
+	// matching ErrNotOwned. Markers are removed along with their RRset.
+	OwnerID string `json:"owner_id,omitempty"`
+
+	// OwnershipPrefix is prepended to record names to get the names of
+	// their ownership markers, the marker of the apex being the prefix
+	// without trailing dot. Defaults to "_owner.".
+	OwnershipPrefix string `json:"ownership_prefix,omitempty"`
+
+	// OperationPollInterval is the delay between two polls of an
+	// asynchronous operation, when a write is answered with 202 Accepted
+	// and no Retry-After header. Defaults to 1 second.
+	OperationPollInterval time.Duration `json:"operation_poll_interval,omitempty"`
+
+	// OAuth2ClientID, OAuth2ClientSecret and OAuth2TokenURL enable the
+	// OAuth2 client-credentials flow: access tokens are obtained from the
+	// token URL, cached and refreshed before they expire or when the API
+	// rejects them with 401, and take precedence over APIToken.
+	// OAuth2Scopes are optional.
+	OAuth2ClientID     string   `json:"oauth2_client_id,omitempty"`
+	OAuth2ClientSecret string   `json:"oauth2_client_secret,omitempty"`
+	OAuth2TokenURL     string   `json:"oauth2_token_url,omitempty"`
+	OAuth2Scopes       []string `json:"oauth2_scopes,omitempty"`
+
+	// OAuth2RefreshToken switches the OAuth2 flow to the refresh-token
+	// grant: access tokens are obtained from the token URL in exchange for
+	// it. Refresh tokens rotated by the server are followed.
+	OAuth2RefreshToken string `json:"oauth2_refresh_token,omitempty"`
+
+	// APITokenFile is the path of a file holding the API token, used
+	// instead of APIToken. The file is read again whenever it changes, so
+	// the token can be rotated without restarting. Surrounding whitespace
+	// is ignored.
+	APITokenFile string `json:"api_token_file,omitempty"`
+
+	// TokenRefresher, when set, is called for a new API token when a
+	// request is rejected with 401, or before the first request if APIToken
+	// is empty. The request is then retried once with the new token, which
+	// is kept for the following requests.
+	TokenRefresher func(ctx context.Context) (string, error) `json:"-"`
+
+	// Auth authenticates requests with a custom scheme, see AuthProvider.
+	// It takes precedence over APIToken, APITokenFile, TokenRefresher and
+	// OAuth2.
+	Auth AuthProvider `json:"-"`
+
+	// CAFile is a PEM bundle of root CAs trusted in addition to the system
+	// ones, e.g. for a self-hosted API with an internal CA.
+	CAFile string `json:"ca_file,omitempty"`
+
+	// TLSServerName overrides the server name used to verify the API
+	// certificate (and sent as SNI).
+	TLSServerName string `json:"tls_server_name,omitempty"`
+
+	// ClientCertFile and ClientKeyFile are the PEM certificate and key
+	// presented to the API for mutual TLS authentication, in addition to or
+	// instead of APIToken. They are loaded on first use.
+	ClientCertFile string `json:"client_cert_file,omitempty"`
+	ClientKeyFile  string `json:"client_key_file,omitempty"`
+
+	// ProxyURL is the HTTP(S) proxy used to reach the API, instead of the
+	// one from the HTTP_PROXY/HTTPS_PROXY environment variables.
+	ProxyURL string `json:"proxy_url,omitempty"`
+
+	// FallbackEndpoints are tried, in order, when Endpoint fails with a
+	// network error or a 5xx response. Endpoints that failed recently are
+	// avoided until they recover, see failover.go.
+	FallbackEndpoints []string `json:"fallback_endpoints,omitempty"`
+
+	// UserAgent is sent as the User-Agent header, instead of the default
+	// libdns-immosquare/<Version>.
+	UserAgent string `json:"user_agent,omitempty"`
+
+	// Headers are added to every request, e.g. tracing or team headers.
+	// Headers set by the provider itself, such as Authorization and
+	// Content-Type, take precedence.
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Zones maps zone names to the credentials and endpoint used for them,
+	// so a single provider can manage zones hosted under other accounts or
+	// on regional endpoints. Zone names are matched case-insensitively,
+	// with or without the trailing dot.
+	Zones map[string]ZoneConfig `json:"zones,omitempty"`
+
+	// Nameservers are the authoritative nameservers of the zones, as
+	// "host" or "host:port", queried by DetectDrift and WaitForPropagation.
+	// Defaults to the NS hosts of each zone, found through the system
+	// resolver.
+	Nameservers []string `json:"nameservers,omitempty"`
+
+	// VerifyWrites makes AppendRecords and SetRecords poll the
+	// authoritative nameservers of the zone, see Nameservers, after a
+	// successful write until they serve the written records, and return a
+	// *VerificationError if they still don't after VerifyTimeout.
+	VerifyWrites bool `json:"verify_writes,omitempty"`
+
+	// VerifyTimeout bounds the verification of a write. Defaults to 2m.
+	VerifyTimeout time.Duration `json:"verify_timeout,omitempty"`
+
+	// Templates are the record templates applied with ApplyTemplate, by
+	// name.
+	Templates map[string]Template `json:"templates,omitempty"`
+
+	// CacheTTL enables caching GetRecords results for this long, per zone.
+	// The cache of a zone is dropped by every write to it through this
+	// provider. Zero disables caching.
+	CacheTTL time.Duration `json:"cache_ttl,omitempty"`
+
+	// SerialSource makes GetRecords read the SOA serial of a zone whose
+	// cached records expired, and reuse them when it hasn't changed since
+	// they were fetched, so polling a zone costs a single request rather
+	// than fetching all its records: SerialSourceAPI reads it with
+	// GetZone, SerialSourceDNS from the nameservers of the zone. Empty
+	// disables it.
+	SerialSource string `json:"serial_source,omitempty"`
+
+	// DynamicUpdate, if set, makes AppendRecords and DeleteRecords send
+	// their records as an RFC 2136 DNS UPDATE to its nameserver when the
+	// API is unreachable, e.g. so ACME challenges can still be solved
+	// during an API outage.
+	DynamicUpdate *DynamicUpdateConfig `json:"dynamic_update,omitempty"`
+
+	// Debug dumps every HTTP request and response, bodies included, to
+	// stderr with credentials redacted. It can also be enabled with the
+	// LIBDNS_IMMOSQUARE_DEBUG environment variable.
+	Debug bool `json:"debug,omitempty"`
+
+	client             *http.Client
+	debugWriter        io.Writer
+	tlsConfig          *tls.Config
+	clientCertificates []tls.Certificate
+	limiter            *rateLimiter
+	logger             *slog.Logger
+	metrics            Metrics
+
+	// State shared by concurrent calls
+	initMu          sync.Mutex
+	pageCache       pageCache
+	recordCache     recordCache
+	getRecordsGroup singleflight.Group
+	endpointPool    endpointPool
+	targets         *apiTargets
+
+	// transportConfigured is set once the TLS and proxy settings are applied
+	transportConfigured bool
 }
 
-// initClient initializes the HTTP client if necessary
-func (p *Provider) initClient() error {
+// initClient initializes the HTTP client, rate limiter and API targets if
+// necessary, and returns them. It may be called concurrently.
+func (p *Provider) initClient() (*http.Client, *rateLimiter, *apiTargets, error) {
+	p.initMu.Lock()
+	defer p.initMu.Unlock()
 	if p.client == nil {
-		p.client = &http.Client{
-			Timeout: 30 * time.Second,
+		// Timeouts are applied per request, see requestTimeout
+		p.client = &http.Client{}
+	}
+	if !p.transportConfigured && p.hasTransportSettings() {
+		// Before the debug transport wraps it, see transport.go
+		client, err := p.configureTransport(p.client)
+		if err != nil {
+			return nil, nil, nil, err
 		}
+		p.client = client
+		p.transportConfigured = true
+	}
+	if p.targets == nil {
+		p.targets = p.newAPITargets(p.newAuthProvider(p.client))
+	}
+	if p.debugEnabled() {
+		if _, ok := p.client.Transport.(*debugTransport); !ok {
+			w := p.debugWriter
+			if w == nil {
+				w = os.Stderr
+			}
+			next := p.client.Transport
+			if next == nil {
+				next = http.DefaultTransport
+			}
+			// Copy the client so a caller-provided one is left untouched
+			client := *p.client
+			client.Transport = &debugTransport{next: next, w: w}
+			p.client = &client
+		}
+	}
+	if p.limiter == nil {
+		p.limiter = newRateLimiter(p.RateLimit, p.RateLimitBurst)
 	}
 	if p.Endpoint == "" {
-		return fmt.Errorf("endpoint is required for the immosquare provider")
+		return nil, nil, nil, fmt.Errorf("endpoint is required for the immosquare provider")
 	}
-	return nil
+	return p.client, p.limiter, p.targets, nil
+}
+
+// ttlLimits bounds the TTLs of written records; zero means no bound
+type ttlLimits struct {
+	min time.Duration
+	max time.Duration
 }
 
-// makeRequest makes an HTTP request to the immosquare API
+// clamp returns ttl within the limits. The maximum wins when the limits
+// overlap.
+func (l ttlLimits) clamp(ttl time.Duration) time.Duration {
+	if ttl < l.min {
+		ttl = l.min
+	}
+	if l.max > 0 && ttl > l.max {
+		ttl = l.max
+	}
+	return ttl
+}
+
+// ttlLimits returns the TTL limits applied by AppendRecords and SetRecords,
+// none when RawTTL is set on the provider or on ctx
+func (p *Provider) ttlLimits(ctx context.Context) ttlLimits {
+	if p.RawTTL || rawTTL(ctx) {
+		return ttlLimits{}
+	}
+	limits := ttlLimits{min: p.MinTTL, max: p.MaxTTL}
+	if limits.min <= 0 {
+		limits.min = defaultMinTTL
+	}
+	return limits
+}
+
+// makeRequest makes an HTTP request to the immosquare API.
+// Transient failures (network errors, 429 and 5xx responses) are retried
+// with exponential backoff, see retry.go; POST requests only when they
+// can't have been processed.
 func (p *Provider) makeRequest(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
-	if err := p.initClient(); err != nil {
+	return p.makeRequestWithHeader(ctx, method, path, body, nil)
+}
+
+// makeRequestWithHeader is makeRequest with additional request headers.
+func (p *Provider) makeRequestWithHeader(ctx context.Context, method, path string, body interface{}, header http.Header) (*http.Response, error) {
+	client, limiter, targets, err := p.initClient()
+	if err != nil {
 		return nil, err
 	}
-	
-	url := p.Endpoint + path
-	var req *http.Request
-	var err error
-	
+
+	var jsonBody []byte
 	if body != nil {
-		jsonBody, err := json.Marshal(body)
+		var err error
+		jsonBody, err = json.Marshal(body)
 		if err != nil {
 			return nil, fmt.Errorf("JSON serialization error: %w", err)
 		}
-		req, err = http.NewRequestWithContext(ctx, method, url, strings.NewReader(string(jsonBody)))
-		if err != nil {
-			return nil, fmt.Errorf("request creation error: %w", err)
+	}
+
+	// Zones may have their own endpoint and credentials, see zonemap.go
+	target := targets.forPath(path)
+	endpoints := target.endpoints
+	// Endpoints that failed since the last backoff are skipped, see failover.go
+	failedOver := make(map[int]bool)
+	maxRetries := p.maxRetries()
+	// Credentials are refreshed at most once per request
+	refreshed := false
+	// Attempts share the same request ID, see requestid.go
+	requestID := newRequestID(ctx)
+	for attempt := 0; ; {
+		index := target.pool.pick(len(endpoints), failedOver, time.Now())
+		url := endpoints[index] + p.accountPrefix() + path
+		var bodyReader io.Reader
+		if jsonBody != nil {
+			bodyReader = bytes.NewReader(jsonBody)
 		}
-		req.Header.Set("Content-Type", "application/json")
-	} else {
-		req, err = http.NewRequestWithContext(ctx, method, url, nil)
+		attemptCtx, cancel := context.WithTimeout(ctx, p.requestTimeout(method))
+		req, err := http.NewRequestWithContext(attemptCtx, method, url, bodyReader)
 		if err != nil {
+			cancel()
 			return nil, fmt.Errorf("request creation error: %w", err)
 		}
+		p.setStaticHeaders(req)
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		req.Header.Set(requestIDHeader, requestID)
+		if jsonBody != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if p.AccountID != "" && !p.AccountIDInPath {
+			req.Header.Set(accountIDHeader, p.AccountID)
+		}
+
+		// Add authentication, see auth.go; the headers it sets are redacted
+		// from debug dumps, see applyAuth
+		if target.auth != nil {
+			if req, err = applyAuth(target.auth, req); err != nil {
+				cancel()
+				return nil, err
+			}
+		}
+
+		if err := limiter.wait(ctx); err != nil {
+			cancel()
+			return nil, err
+		}
+		start := time.Now()
+		resp, err := client.Do(req)
+		duration := time.Since(start)
+		if resp != nil {
+			limiter.observe(resp, time.Now())
+			p.observeRequest(method, resp.StatusCode, duration, nil)
+			p.logDebug(ctx, "immosquare API request",
+				"method", method, "path", path, "status", resp.StatusCode, "duration", duration, "attempt", attempt+1,
+				"request_id", responseRequestID(resp))
+		} else {
+			p.observeRequest(method, 0, duration, err)
+			p.logDebug(ctx, "immosquare API request failed",
+				"method", method, "path", path, "error", err, "duration", duration, "attempt", attempt+1,
+				"request_id", requestID)
+		}
+		failed := err != nil || resp.StatusCode >= 500
+		target.pool.observe(index, failed, time.Now())
+		if refresher, ok := target.auth.(AuthRefresher); ok && resp != nil && resp.StatusCode == http.StatusUnauthorized && !refreshed {
+			// The credentials may have expired or been revoked: renew them
+			// and try again right away
+			p.logDebug(ctx, "refreshing immosquare API credentials",
+				"method", method, "path", path, "attempt", attempt+1, "request_id", requestID)
+			refreshed = true
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+			cancel()
+			if err := refresher.Refresh(ctx, req); err != nil {
+				return nil, fmt.Errorf("credentials refresh error: %w", err)
+			}
+			continue
+		}
+		retry := shouldRetry(ctx, method, resp, err)
+		failover := retry && failed && len(failedOver)+1 < len(endpoints)
+		if !failover && (attempt >= maxRetries || !retry) {
+			if err != nil {
+				cancel()
+				return nil, &transportError{err: err, requestID: requestID}
+			}
+			// The timeout also covers reading the body
+			resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+			return resp, nil
+		}
+
+		if failover {
+			// Try the next endpoint right away
+			p.logDebug(ctx, "failing over to another immosquare API endpoint",
+				"method", method, "path", path, "endpoint", endpoints[index], "reason", retryReason(resp, err),
+				"request_id", requestID)
+			failedOver[index] = true
+			if resp != nil {
+				io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+				resp.Body.Close()
+			}
+			cancel()
+			continue
+		}
+
+		wait := p.retryDelay(attempt, resp)
+		p.logDebug(ctx, "retrying immosquare API request",
+			"method", method, "path", path, "attempt", attempt+1, "wait", wait, "reason", retryReason(resp, err),
+			"request_id", requestID)
+		if resp != nil {
+			// Drain the body so the connection can be reused
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+		}
+		cancel()
+		if err := sleepContext(ctx, wait); err != nil {
+			return nil, err
+		}
+		attempt++
+		failedOver = make(map[int]bool)
 	}
-	
-	// Add authentication token
-	if p.APIToken != "" {
-		req.Header.Set("Authorization", "Bearer "+p.APIToken)
-	}
-	
-	return p.client.Do(req)
 }
 
 // GetRecords retrieves all DNS records for the specified zone.
+// Paginated responses are followed until the full record set is fetched.
+// Concurrent calls for the same zone share a single fetch, and when
+// CacheTTL or SerialSource is set, results are cached, see recordCache.
 func (p *Provider) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
-	resp, err := p.makeRequest(ctx, "GET", "/zones/"+zone+"/records", nil)
+	if p.CacheTTL > 0 || p.SerialSource != "" {
+		if records, ok := p.recordCache.get(zone); ok {
+			return records, nil
+		}
+	}
+
+	// The shared fetch must not fail because the caller that started it
+	// gave up, so it runs without its cancellation. Writes bump the
+	// generation of the zone, so a call made after a write never joins a
+	// fetch started before it.
+	fetchCtx := context.WithoutCancel(ctx)
+	generation := p.recordCache.generation(zone)
+	key := normalizeZone(zone) + "\x00" + strconv.FormatUint(generation, 10)
+	result := p.getRecordsGroup.DoChan(key, func() (interface{}, error) {
+		var serial uint32
+		var hasSerial bool
+		if p.SerialSource != "" {
+			var err error
+			if serial, err = p.zoneSerial(fetchCtx, zone); err != nil {
+				p.logDebug(fetchCtx, "SOA serial unavailable, fetching all records", "zone", zone, "error", err)
+			} else if records, ok := p.recordCache.revalidate(zone, generation, serial, p.CacheTTL); ok {
+				return records, nil
+			} else {
+				hasSerial = true
+			}
+		}
+		records, err := p.fetchRecords(fetchCtx, zone)
+		if err == nil && (p.CacheTTL > 0 || hasSerial) {
+			p.recordCache.set(zone, generation, records, p.CacheTTL, serial, hasSerial)
+		}
+		return records, err
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-result:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		// Every caller gets its own slice
+		return append([]libdns.Record{}, res.Val.([]libdns.Record)...), nil
+	}
+}
+
+// fetchRecords retrieves all DNS records of zone from the API, bypassing
+// the cache. It is used by writes that need the current state of the zone.
+func (p *Provider) fetchRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	return p.fetchFilteredRecords(ctx, zone, RecordFilter{})
+}
+
+// fetchFilteredRecords retrieves the records of zone selected by filter
+// from the API, bypassing the cache, see walkRecords.
+func (p *Provider) fetchFilteredRecords(ctx context.Context, zone string, filter RecordFilter) ([]libdns.Record, error) {
+	records := []libdns.Record{}
+	err := p.walkRecords(ctx, zone, filter, true, func(record libdns.Record) bool {
+		records = append(records, record)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// walkRecords fetches the records of zone selected by filter page by page
+// and calls fn for each of them, until fn returns false. The filter is sent
+// as the name and type query parameters so the API can skip the other
+// records, and applied again to the records returned, for APIs that ignore
+// them. Pages of the whole zone are kept in the page cache if cache is
+// true; filtered ones never are.
+func (p *Provider) walkRecords(ctx context.Context, zone string, filter RecordFilter, cache bool, fn func(libdns.Record) bool) error {
+	count := 0
+	path := p.firstRecordsPagePath(zone, filter)
+	cache = cache && filter == RecordFilter{}
+	for path != "" {
+		page, err := p.getRecordsPage(ctx, path, cache)
+		if err != nil {
+			return err
+		}
+		for _, apiRecord := range page.records {
+			record, err := p.convertAPIRecordToLibDNS(zone, apiRecord)
+			if err != nil {
+				return fmt.Errorf("record conversion error: %w", err)
+			}
+			if !filter.match(record.RR()) {
+				continue
+			}
+			count++
+			if !fn(withMetadata(record, apiRecord)) {
+				p.observeRecords(zone, "get", count)
+				return nil
+			}
+		}
+		path = page.next
+	}
+	p.observeRecords(zone, "get", count)
+	return nil
+}
+
+// getRecordsPage fetches and decodes a single page of records.
+// Pages are requested conditionally when a previous response carried an
+// ETag or Last-Modified header, and reused on 304 Not Modified. The page is
+// only kept for the next request if cache is true.
+func (p *Provider) getRecordsPage(ctx context.Context, path string, cache bool) (*recordsPage, error) {
+	var cached *recordsPage
+	var header http.Header
+	if cache {
+		cached, header = p.pageCache.conditionalHeader(path)
+	}
+	resp, err := p.makeRequestWithHeader(ctx, "GET", path, nil, header)
 	if err != nil {
 		return nil, fmt.Errorf("GET request error: %w", err)
 	}
 	defer resp.Body.Close()
-	
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		return cached, nil
+	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API error: %s", resp.Status)
+		return nil, newAPIError(resp)
 	}
-	
-	// Read the raw response to see the structure
-	bodyBytes, err := io.ReadAll(resp.Body)
+
+	// Decode the records as they are read, large zones don't fit a buffer
+	apiResponse, err := decodeRecordsResponse(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("body reading error: %w", err)
-	}
-	
-	// Try to decode as an object with a records field
-	var apiResponse struct {
-		Records []struct {
-			Name  string `json:"name"`
-			Type  string `json:"type"`
-			Value string `json:"value"`
-			TTL   int    `json:"ttl"`
-		} `json:"records"`
-	}
-	
-	if err := json.Unmarshal(bodyBytes, &apiResponse); err != nil {
-		// If it doesn't work, try as a direct array
-		var apiRecords []struct {
-			Name  string `json:"name"`
-			Type  string `json:"type"`
-			Value string `json:"value"`
-			TTL   int    `json:"ttl"`
-		}
-		
-		if err := json.Unmarshal(bodyBytes, &apiRecords); err != nil {
-			return nil, fmt.Errorf("JSON decoding error: %w", err)
-		}
-		
-		records := make([]libdns.Record, 0, len(apiRecords))
-		for _, apiRecord := range apiRecords {
-			record, err := p.convertAPIRecordToLibDNS(apiRecord)
-			if err != nil {
-				return nil, fmt.Errorf("record conversion error: %w", err)
-			}
-			records = append(records, record)
-		}
-		return records, nil
+		return nil, fmt.Errorf("JSON decoding error: %w", err)
 	}
-	
-	// Utiliser la réponse avec le champ records
-	records := make([]libdns.Record, 0, len(apiResponse.Records))
-	for _, apiRecord := range apiResponse.Records {
-		record, err := p.convertAPIRecordToLibDNS(apiRecord)
-		if err != nil {
-			return nil, fmt.Errorf("record conversion error: %w", err)
-		}
-		records = append(records, record)
+
+	next, err := p.nextRecordsPagePath(resp, path, apiResponse)
+	if err != nil {
+		return nil, err
 	}
-	
-	return records, nil
+	page := &recordsPage{records: apiResponse.Records, next: next}
+	if cache {
+		p.pageCache.store(path, resp, page)
+	}
+	return page, nil
 }
 
-// convertAPIRecordToLibDNS converts an API record to the appropriate libdns structure
-func (p *Provider) convertAPIRecordToLibDNS(apiRecord struct {
-	Name  string `json:"name"`
-	Type  string `json:"type"`
-	Value string `json:"value"`
-	TTL   int    `json:"ttl"`
-}) (libdns.Record, error) {
+// convertAPIRecordToLibDNS converts an API record of zone to the appropriate
+// libdns structure, with its name relative to zone
+func (p *Provider) convertAPIRecordToLibDNS(zone string, apiRecord apiRecord) (libdns.Record, error) {
 	ttl := time.Duration(apiRecord.TTL) * time.Second
-	
+	apiRecord.Name = relativeName(apiRecord.Name, zone)
+
 	switch strings.ToUpper(apiRecord.Type) {
 	case "A", "AAAA":
 		ip, err := netip.ParseAddr(apiRecord.Value)
@@ -166,7 +653,7 @@ func (p *Provider) convertAPIRecordToLibDNS(apiRecord struct {
 	case "TXT":
 		txt := libdns.TXT{
 			Name: apiRecord.Name,
-			Text: apiRecord.Value,
+			Text: decodeTXT(apiRecord.Value),
 			TTL:  ttl,
 		}
 		return txt, nil
@@ -183,7 +670,7 @@ func (p *Provider) convertAPIRecordToLibDNS(apiRecord struct {
 		parts := strings.Fields(apiRecord.Value)
 		var preference uint16 = 10
 		var target string
-		
+
 		if len(parts) >= 2 {
 			// Format: "10 mail.example.com"
 			if pref, err := parseUint16(parts[0]); err == nil {
@@ -197,7 +684,7 @@ func (p *Provider) convertAPIRecordToLibDNS(apiRecord struct {
 			// Format: "mail.example.com"
 			target = apiRecord.Value
 		}
-		
+
 		mx := libdns.MX{
 			Name:       apiRecord.Name,
 			Preference: preference,
@@ -212,6 +699,36 @@ func (p *Provider) convertAPIRecordToLibDNS(apiRecord struct {
 			TTL:    ttl,
 		}
 		return ns, nil
+	case "CAA":
+		// Expected format: 'flags tag "value"', quotes being optional
+		rr := libdns.RR{
+			Name: apiRecord.Name,
+			Type: "CAA",
+			Data: apiRecord.Value,
+			TTL:  ttl,
+		}
+		caa, err := parseCAA(rr)
+		if err != nil {
+			// Keep records the API accepted but that libdns can't represent
+			return rr, nil
+		}
+		return caa, nil
+	case "SRV", "HTTPS", "SVCB":
+		// Expected format: "priority weight port target" for SRV, with the
+		// name in the form "_service._proto.name", and
+		// "priority target [SvcParams]" for HTTPS/SVCB
+		rr := libdns.RR{
+			Name: apiRecord.Name,
+			Type: strings.ToUpper(apiRecord.Type),
+			Data: apiRecord.Value,
+			TTL:  ttl,
+		}
+		parsed, err := rr.Parse()
+		if err != nil {
+			// Keep records the API accepted but that libdns can't represent
+			return rr, nil
+		}
+		return parsed, nil
 	default:
 		rr := libdns.RR{
 			Name: apiRecord.Name,
@@ -230,6 +747,46 @@ func parseUint16(s string) (uint16, error) {
 	return result, err
 }
 
+// parseCAA parses CAA data in the form 'flags tag "value"'. Unlike
+// libdns.RR.Parse, the value may contain spaces and needs not be quoted,
+// e.g. 'letsencrypt.org; validationmethods=dns-01'.
+func parseCAA(rr libdns.RR) (libdns.CAA, error) {
+	fields := strings.SplitN(strings.TrimSpace(rr.Data), " ", 3)
+	if len(fields) != 3 {
+		return libdns.CAA{}, fmt.Errorf(`expected 3 fields in the form 'flags tag "value"'`)
+	}
+	flags, err := strconv.ParseUint(fields[0], 10, 8)
+	if err != nil {
+		return libdns.CAA{}, fmt.Errorf("invalid flags %s: %w", fields[0], err)
+	}
+	tag := fields[1]
+	if tag == "" {
+		return libdns.CAA{}, fmt.Errorf("empty tag")
+	}
+	for _, c := range tag {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return libdns.CAA{}, fmt.Errorf("invalid tag %q", tag)
+		}
+	}
+
+	value := strings.TrimSpace(fields[2])
+	if strings.HasPrefix(value, `"`) {
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else {
+			value = strings.Trim(value, `"`)
+		}
+	}
+
+	return libdns.CAA{
+		Name:  rr.Name,
+		TTL:   rr.TTL,
+		Flags: uint8(flags),
+		Tag:   tag,
+		Value: value,
+	}, nil
+}
+
 // convertToSpecificTypes converts records to specific types
 func (p *Provider) convertToSpecificTypes(records []libdns.Record) []libdns.Record {
 	result := make([]libdns.Record, 0, len(records))
@@ -268,7 +825,7 @@ func (p *Provider) convertToSpecificTypes(records []libdns.Record) []libdns.Reco
 			parts := strings.Fields(rr.Data)
 			var preference uint16 = 10
 			var target string
-			
+
 			if len(parts) >= 2 {
 				if pref, err := parseUint16(parts[0]); err == nil {
 					preference = pref
@@ -279,7 +836,7 @@ func (p *Provider) convertToSpecificTypes(records []libdns.Record) []libdns.Reco
 			} else {
 				target = rr.Data
 			}
-			
+
 			mx := libdns.MX{
 				Name:       rr.Name,
 				Preference: preference,
@@ -294,6 +851,23 @@ func (p *Provider) convertToSpecificTypes(records []libdns.Record) []libdns.Reco
 				TTL:    rr.TTL,
 			}
 			result = append(result, ns)
+		case "CAA":
+			caa, err := parseCAA(rr)
+			if err != nil {
+				// If the CAA is malformed, keep the RR
+				result = append(result, rr)
+				continue
+			}
+			result = append(result, caa)
+		case "SRV", "HTTPS", "SVCB":
+			rr.Type = strings.ToUpper(rr.Type)
+			parsed, err := rr.Parse()
+			if err != nil {
+				// If the record is malformed, keep the RR
+				result = append(result, rr)
+				continue
+			}
+			result = append(result, parsed)
 		default:
 			result = append(result, rr)
 		}
@@ -301,29 +875,139 @@ func (p *Provider) convertToSpecificTypes(records []libdns.Record) []libdns.Reco
 	return result
 }
 
+// toAPIRecords converts records to the API format, with TTLs clamped to
+// limits.
+func toAPIRecords(records []libdns.Record, limits ttlLimits) ([]map[string]interface{}, error) {
+	rrs, err := normalizeRecords(records, limits)
+	if err != nil {
+		return nil, err
+	}
+	apiRecords := make([]map[string]interface{}, 0, len(rrs))
+	for i, rr := range rrs {
+		apiRecord := apiRecordFromRR(rr)
+		// Let the API match on the server-assigned ID when known
+		if id := recordID(records[i]); id != "" {
+			apiRecord["id"] = id
+		}
+		apiRecords = append(apiRecords, apiRecord)
+	}
+	return apiRecords, nil
+}
+
+// apiRecordFromRR converts a normalized RR to the API format
+func apiRecordFromRR(rr libdns.RR) map[string]interface{} {
+	if strings.EqualFold(rr.Type, "TXT") {
+		rr.Data = encodeTXT(rr.Data)
+	}
+	return map[string]interface{}{
+		"name": rr.Name,
+		"type": rr.Type,
+		"data": rr.Data, // The API expects "data" for all types
+		"ttl":  int(rr.TTL.Seconds()),
+	}
+}
+
+// normalizeRecords converts records to RRs in the form sent to the API,
+// with names normalized by normalizeName and TTLs clamped to limits.
+func normalizeRecords(records []libdns.Record, limits ttlLimits) ([]libdns.RR, error) {
+	rrs := make([]libdns.RR, 0, len(records))
+	for _, record := range records {
+		rr := record.RR()
+		rr.Name = normalizeName(rr.Name)
+		switch strings.ToUpper(rr.Type) {
+		case "SRV", "HTTPS", "SVCB":
+			if rr.Data == "" {
+				// Empty data matches any value in DeleteRecords
+				break
+			}
+			// Re-render through libdns.SRV / libdns.ServiceBinding so the data
+			// is always "priority weight port target" / "priority target params"
+			rr.Type = strings.ToUpper(rr.Type)
+			parsed, err := rr.Parse()
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s record %q: %w", rr.Type, rr.Name, err)
+			}
+			rr = parsed.RR()
+			rr.Data = strings.TrimSpace(rr.Data)
+		case "CAA":
+			if rr.Data == "" {
+				break
+			}
+			// Always send 'flags tag "value"' with the value quoted
+			caa, err := parseCAA(rr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CAA record %q: %w", rr.Name, err)
+			}
+			rr = caa.RR()
+		}
+
+		rr.TTL = limits.clamp(rr.TTL)
+		rrs = append(rrs, rr)
+	}
+	return rrs, nil
+}
+
 // AppendRecords adds new DNS records to the zone.
-// Returns the records that have been added.
+// Returns the records that have been added. Inputs larger than BatchSize are
+// sent in several requests, up to Parallelism at a time; if some fail, the
+// records added by the others are returned along with the errors. In the
+// ownership mode, see OwnerID, adding to RRsets not owned by the provider is
+// refused. With VerifyWrites, the nameservers are then checked to serve the
+// added records. With DynamicUpdate, the records are added with a DNS
+// UPDATE if the API is unreachable.
 func (p *Provider) AppendRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
 	if len(records) == 0 {
 		return []libdns.Record{}, nil
 	}
-	
-	// Convert records to API format according to the type
-	apiRecords := make([]map[string]interface{}, 0, len(records))
-	for _, record := range records {
-		rr := record.RR()
-		ttl := rr.TTL
-		if ttl < defaultMinTTL {
-			ttl = defaultMinTTL
+
+	// Validate every record before sending the first batch
+	records = relativeRecords(zone, records)
+	if err := validateRecords(records); err != nil {
+		return nil, err
+	}
+	if _, err := checkCNAMEConflicts(records, nil, false); err != nil {
+		return nil, err
+	}
+	limits := p.ttlLimits(ctx)
+	if _, err := normalizeRecords(records, limits); err != nil {
+		return nil, err
+	}
+	owned, err := p.loadOwnership(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	if err := owned.check(records); err != nil {
+		return nil, err
+	}
+	defer p.recordCache.invalidate(zone)
+	added, err := p.writeBatches(records, func(batch []libdns.Record) ([]libdns.Record, error) {
+		return p.appendBatch(ctx, zone, batch, limits)
+	})
+	added, viaUpdate, err := p.updateFallback(ctx, zone, records, added, err, false, limits)
+	if claims := owned.claims(added); len(claims) > 0 {
+		var claimErr error
+		if viaUpdate {
+			// The API is unreachable, the markers go with a DNS UPDATE too
+			_, claimErr = p.dynamicUpdate(ctx, zone, claims, false, limits)
+		} else {
+			_, claimErr = p.sendRecords(ctx, "POST", zone, claims, http.StatusCreated, http.StatusOK)
 		}
-		apiRecord := map[string]interface{}{
-			"name": rr.Name,
-			"type": rr.Type,
-			"data": rr.Data, // The API expects "data" for all types
-			"ttl":  int(ttl.Seconds()),
+		if claimErr != nil {
+			err = errors.Join(err, fmt.Errorf("error adding the ownership markers: %w", claimErr))
 		}
+	}
+	if err == nil && p.VerifyWrites {
+		err = p.verifyWrite(ctx, zone, added, false)
+	}
+	return added, err
+}
 
-		apiRecords = append(apiRecords, apiRecord)
+// appendBatch adds records with a single POST request
+func (p *Provider) appendBatch(ctx context.Context, zone string, records []libdns.Record, limits ttlLimits) ([]libdns.Record, error) {
+	// Convert records to API format according to the type
+	apiRecords, err := toAPIRecords(records, limits)
+	if err != nil {
+		return nil, err
 	}
 
 	// Send as an object with a records field
@@ -331,102 +1015,177 @@ func (p *Provider) AppendRecords(ctx context.Context, zone string, records []lib
 		"records": apiRecords,
 	}
 
-	resp, err := p.makeRequest(ctx, "POST", "/zones/"+zone+"/records", requestBody)
+	resp, err := p.makeRequest(ctx, "POST", zonePath(zone)+"/records", requestBody)
 	if err != nil {
 		return nil, fmt.Errorf("POST request error: %w", err)
 	}
 	defer resp.Body.Close()
-	
-	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API error during addition: %s", resp.Status)
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusMultiStatus && resp.StatusCode != http.StatusAccepted {
+		return nil, fmt.Errorf("error during addition: %w", newAPIError(resp))
 	}
-	
-	// Return the records converted to specific types
-	return p.convertToSpecificTypes(records), nil
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("response reading error: %w", err)
+	}
+
+	// Large writes may be processed asynchronously, see awaitOperation
+	if resp.StatusCode == http.StatusAccepted {
+		if bodyBytes, err = p.awaitOperation(ctx, resp, bodyBytes); err != nil {
+			return nil, fmt.Errorf("error during addition: %w", err)
+		}
+	}
+
+	// Some records may have been rejected, see RecordError
+	if results, ok := decodeRecordResults(bodyBytes); ok {
+		created, err := p.recordResults(zone, results, records)
+		p.observeRecords(zone, "append", len(created))
+		if err != nil {
+			return created, fmt.Errorf("error during addition: %w", err)
+		}
+		return created, nil
+	}
+	if resp.StatusCode == http.StatusMultiStatus {
+		return nil, fmt.Errorf("error during addition: multi-status response without record results")
+	}
+
+	p.observeRecords(zone, "append", len(records))
+
+	// Return the created records, with their IDs when the API sends them back
+	return p.createdRecords(zone, bodyBytes, records), nil
 }
 
 // SetRecords sets the DNS records in the zone, updating existing records or creating new ones.
-// Returns the updated records.
+// Only the (name, type) RRsets present in the input are affected: their
+// current records are fetched, and the ones not in the input are deleted
+// while the missing ones are added. Records of other RRsets are left untouched.
+// Returns the updated records. With VerifyWrites, the nameservers are then
+// checked to serve exactly the records of the RRsets.
 func (p *Provider) SetRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
 	if len(records) == 0 {
 		return []libdns.Record{}, nil
 	}
-	
-	// Convert records to API format according to the type
-	apiRecords := make([]map[string]interface{}, 0, len(records))
-	for _, record := range records {
-		rr := record.RR()
-		ttl := rr.TTL
-		if ttl < defaultMinTTL {
-			ttl = defaultMinTTL
-		}
-		apiRecord := map[string]interface{}{
-			"name": rr.Name,
-			"type": rr.Type,
-			"data": rr.Data, // The API expects "data" for all types
-			"ttl":  int(ttl.Seconds()),
-		}
 
-		apiRecords = append(apiRecords, apiRecord)
+	records = relativeRecords(zone, records)
+	if err := validateRecords(records); err != nil {
+		return nil, err
+	}
+	desired, err := normalizeRecords(records, p.ttlLimits(ctx))
+	if err != nil {
+		return nil, err
 	}
 
-	// Send as an object with a records field
-	requestBody := map[string]interface{}{
-		"records": apiRecords,
+	existing, err := p.fetchRecords(ctx, zone)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching current records: %w", err)
 	}
 
-	resp, err := p.makeRequest(ctx, "PUT", "/zones/"+zone+"/records", requestBody)
+	conflicting, err := checkCNAMEConflicts(records, existing, p.ResolveCNAMEConflicts)
 	if err != nil {
-		return nil, fmt.Errorf("PUT request error: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
-	
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API error during update: %s", resp.Status)
+
+	toDelete, toAdd := diffRRsets(existing, desired)
+	toDelete = append(toDelete, conflicting...)
+	if err := p.applyRRsetChanges(ctx, zone, toDelete, toAdd); err != nil {
+		return nil, fmt.Errorf("error during update: %w", err)
 	}
-	
+	p.observeRecords(zone, "set", len(toDelete)+len(toAdd))
+
 	// Return the records converted to specific types
-	return p.convertToSpecificTypes(records), nil
+	result := p.convertToSpecificTypes(records)
+	if p.VerifyWrites {
+		return result, p.verifyWrite(ctx, zone, result, true)
+	}
+	return result, nil
 }
 
 // DeleteRecords deletes the specified DNS records from the zone.
-// Returns the records that have been deleted.
+// Returns the records that have been deleted. Inputs larger than BatchSize
+// are sent in several requests, like for AppendRecords. In the ownership
+// mode, see OwnerID, deleting records of RRsets not owned by the provider is
+// refused. With DynamicUpdate, the records are deleted with a DNS UPDATE if
+// the API is unreachable.
 func (p *Provider) DeleteRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
 	if len(records) == 0 {
 		return []libdns.Record{}, nil
 	}
-	
-	// Convert records to API format according to the type
-	apiRecords := make([]map[string]interface{}, 0, len(records))
-	for _, record := range records {
-		rr := record.RR()
-		apiRecord := map[string]interface{}{
-			"name": rr.Name,
-			"type": rr.Type,
-			"data": rr.Data, // The API expects "data" for all types
-			"ttl":  int(rr.TTL.Seconds()),
+
+	records = relativeRecords(zone, records)
+	if _, err := normalizeRecords(records, ttlLimits{}); err != nil {
+		return nil, err
+	}
+	owned, err := p.loadOwnership(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	if err := owned.check(records); err != nil {
+		return nil, err
+	}
+	defer p.recordCache.invalidate(zone)
+	deleted, err := p.writeBatches(records, func(batch []libdns.Record) ([]libdns.Record, error) {
+		return p.deleteBatch(ctx, zone, batch)
+	})
+	deleted, viaUpdate, err := p.updateFallback(ctx, zone, records, deleted, err, true, ttlLimits{})
+	if releases := owned.releases(deleted, nil); len(releases) > 0 {
+		var releaseErr error
+		if viaUpdate {
+			// The API is unreachable, the markers go with a DNS UPDATE too
+			_, releaseErr = p.dynamicUpdate(ctx, zone, releases, true, ttlLimits{})
+		} else {
+			_, releaseErr = p.sendRecords(ctx, "DELETE", zone, releases, http.StatusOK, http.StatusNoContent)
+		}
+		if releaseErr != nil {
+			err = errors.Join(err, fmt.Errorf("error deleting the ownership markers: %w", releaseErr))
 		}
-		
-		apiRecords = append(apiRecords, apiRecord)
 	}
-	
+	if deleted == nil && err == nil {
+		return []libdns.Record{}, nil
+	}
+	return deleted, err
+}
+
+// deleteBatch deletes records with a single DELETE request. Records the API
+// refuses to delete are left out of the result.
+func (p *Provider) deleteBatch(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	// Convert records to API format according to the type
+	apiRecords, err := toAPIRecords(records, ttlLimits{})
+	if err != nil {
+		return nil, err
+	}
+
 	// Envoyer les enregistrements à supprimer dans le body
 	requestBody := map[string]interface{}{
 		"records": apiRecords,
 	}
-	
-	resp, err := p.makeRequest(ctx, "DELETE", "/zones/"+zone+"/records", requestBody)
+
+	resp, err := p.makeRequest(ctx, "DELETE", zonePath(zone)+"/records", requestBody)
 	if err != nil {
 		return nil, fmt.Errorf("DELETE request error: %w", err)
 	}
 	defer resp.Body.Close()
-	
-	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusNoContent {
-		// Return the records converted to specific types
-		return p.convertToSpecificTypes(records), nil
+
+	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusMultiStatus || resp.StatusCode == http.StatusAccepted {
+		bodyBytes, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("response reading error: %w", err)
+		}
+		if resp.StatusCode == http.StatusAccepted {
+			if bodyBytes, err = p.awaitOperation(ctx, resp, bodyBytes); err != nil {
+				return nil, fmt.Errorf("error during deletion: %w", err)
+			}
+		}
+
+		// Return the deleted records converted to specific types
+		deleted, err := p.batchResults(zone, resp, bodyBytes, records)
+		p.observeRecords(zone, "delete", len(deleted))
+		if err != nil {
+			return deleted, fmt.Errorf("error during deletion: %w", err)
+		}
+		return deleted, nil
 	}
-	
-	return []libdns.Record{}, nil
+
+	return nil, fmt.Errorf("error during deletion: %w", newAPIError(resp))
 }
 
 // Interface guards to ensure the Provider implements all libdns interfaces
@@ -435,4 +1194,5 @@ var (
 	_ libdns.RecordAppender = (*Provider)(nil)
 	_ libdns.RecordSetter   = (*Provider)(nil)
 	_ libdns.RecordDeleter  = (*Provider)(nil)
+	_ libdns.ZoneLister     = (*Provider)(nil)
 )
@@ -0,0 +1,147 @@
+package libdnsimmosquare_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+
+	libdnsimmosquare "github.com/immosquare/libdns-immosquare"
+	"github.com/immosquare/libdns-immosquare/immosquaretest"
+)
+
+func TestDeleteRecords(t *testing.T) {
+	srv := immosquaretest.NewServer("token")
+	defer srv.Close()
+	srv.AddZone("example.com",
+		immosquaretest.Record{Name: "www", Type: "A", Value: "192.0.2.1", TTL: 300},
+		immosquaretest.Record{Name: "www", Type: "A", Value: "192.0.2.2", TTL: 300})
+
+	deleted, err := srv.Provider().DeleteRecords(context.Background(), "example.com", []libdns.Record{
+		libdns.RR{Name: "www", Type: "A", Data: "192.0.2.1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 1 {
+		t.Errorf("deleted %d records, want 1", len(deleted))
+	}
+	if records := srv.Records("example.com"); len(records) != 1 || records[0].Value != "192.0.2.2" {
+		t.Errorf("records left = %v, want 192.0.2.2 only", records)
+	}
+}
+
+func TestDeleteRecordsErrors(t *testing.T) {
+	srv := immosquaretest.NewServer("token")
+	defer srv.Close()
+	srv.AddZone("example.com")
+	record := libdns.RR{Name: "www", Type: "A", Data: "192.0.2.1"}
+
+	for _, test := range []struct {
+		name     string
+		provider *libdnsimmosquare.Provider
+		zone     string
+		want     error
+	}{
+		{"bad token", libdnsimmosquare.NewProvider(srv.URL, libdnsimmosquare.WithAPIToken("wrong")), "example.com", libdnsimmosquare.ErrUnauthorized},
+		{"unknown zone", srv.Provider(), "example.org", libdnsimmosquare.ErrZoneNotFound},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			deleted, err := test.provider.DeleteRecords(context.Background(), test.zone, []libdns.Record{record})
+			if !errors.Is(err, test.want) {
+				t.Fatalf("err = %v, want %v", err, test.want)
+			}
+			var apiErr *libdnsimmosquare.APIError
+			if !errors.As(err, &apiErr) {
+				t.Errorf("err = %T, want an *APIError", err)
+			}
+			if len(deleted) != 0 {
+				t.Errorf("deleted = %v, want none", deleted)
+			}
+		})
+	}
+}
+
+func TestDeleteRecordsServerError(t *testing.T) {
+	srv := immosquaretest.NewServer("token")
+	defer srv.Close()
+	srv.AddZone("example.com")
+	front := newFront(t, srv, func(w http.ResponseWriter, r *http.Request) bool {
+		w.WriteHeader(http.StatusInternalServerError)
+		return true
+	})
+
+	provider := libdnsimmosquare.NewProvider(front.URL, libdnsimmosquare.WithAPIToken("token"), libdnsimmosquare.WithMaxRetries(-1))
+	_, err := provider.DeleteRecords(context.Background(), "example.com", []libdns.Record{
+		libdns.RR{Name: "www", Type: "A", Data: "192.0.2.1"},
+	})
+	if !libdnsimmosquare.IsRetryable(err) {
+		t.Fatalf("err = %v, want a retryable error", err)
+	}
+}
+
+func TestGetRecordsAfterWrite(t *testing.T) {
+	srv := immosquaretest.NewServer("token")
+	defer srv.Close()
+	srv.AddZone("example.com")
+	// GetRecords responses are delayed once the zone is read, so that one
+	// started before a write returns the records from before it
+	front := newFront(t, srv, func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method != http.MethodGet {
+			return false
+		}
+		recorder := httptest.NewRecorder()
+		srv.Config.Handler.ServeHTTP(recorder, r)
+		time.Sleep(200 * time.Millisecond)
+		for key, values := range recorder.Header() {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(recorder.Code)
+		w.Write(recorder.Body.Bytes())
+		return true
+	})
+
+	for _, test := range []struct {
+		name string
+		opts []libdnsimmosquare.Option
+	}{
+		{"uncached", nil},
+		{"cached", []libdnsimmosquare.Option{libdnsimmosquare.WithCacheTTL(time.Minute)}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			provider := libdnsimmosquare.NewProvider(front.URL, append([]libdnsimmosquare.Option{libdnsimmosquare.WithAPIToken("token")}, test.opts...)...)
+			if _, err := provider.GetRecords(ctx, "example.com"); err != nil {
+				t.Fatal(err)
+			}
+			name := "_acme-challenge." + test.name
+			started := make(chan struct{})
+			go func() {
+				close(started)
+				provider.GetRecords(ctx, "example.com")
+			}()
+			<-started
+			time.Sleep(20 * time.Millisecond)
+
+			if _, err := provider.AppendRecords(ctx, "example.com", []libdns.Record{
+				libdns.TXT{Name: name, Text: "token", TTL: time.Minute},
+			}); err != nil {
+				t.Fatal(err)
+			}
+			records, err := provider.GetRecords(ctx, "example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, record := range records {
+				if record.RR().Name == name {
+					return
+				}
+			}
+			t.Errorf("GetRecords after AppendRecords = %v, missing %s", records, name)
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket limiting the request rate to the API. It
+// also paces requests according to the X-RateLimit-* headers returned by the
+// API, so the remaining quota is spread over the rest of the window instead
+// of being burnt at once and answered with 429s.
+type rateLimiter struct {
+	mu sync.Mutex
+
+	// rate is the number of tokens added per second, zero for no limit
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	// next is the earliest time the next request may be sent, as derived
+	// from the API rate limit headers
+	next time.Time
+	// interval is the pacing between requests until windowEnd
+	interval  time.Duration
+	windowEnd time.Time
+}
+
+// newRateLimiter returns a limiter allowing rate requests per second with the
+// given burst. A zero rate only applies header-based pacing.
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+// wait blocks until a request may be sent or ctx is done
+func (l *rateLimiter) wait(ctx context.Context) error {
+	for {
+		delay := l.reserve(time.Now())
+		if delay <= 0 {
+			return nil
+		}
+		if err := sleepContext(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// reserve takes a token and returns zero if a request may be sent at now,
+// otherwise it returns how long to wait before trying again.
+func (l *rateLimiter) reserve(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Before(l.next) {
+		return l.next.Sub(now)
+	}
+
+	if l.rate > 0 {
+		if !l.last.IsZero() {
+			l.tokens += now.Sub(l.last).Seconds() * l.rate
+			if l.tokens > l.burst {
+				l.tokens = l.burst
+			}
+		}
+		l.last = now
+		if l.tokens < 1 {
+			return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		}
+		l.tokens--
+	}
+
+	if now.Before(l.windowEnd) {
+		l.next = now.Add(l.interval)
+	}
+	return 0
+}
+
+// observe adapts the pacing to the X-RateLimit-Remaining and
+// X-RateLimit-Reset headers of resp, if present.
+func (l *rateLimiter) observe(resp *http.Response, now time.Time) {
+	remaining, err := strconv.Atoi(strings.TrimSpace(resp.Header.Get("X-RateLimit-Remaining")))
+	if err != nil {
+		return
+	}
+	reset, ok := parseRateLimitReset(resp.Header.Get("X-RateLimit-Reset"), now)
+	if !ok {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	windowEnd := now.Add(reset)
+	if remaining <= 0 {
+		// Quota exhausted: hold every request until the window resets
+		l.next = windowEnd
+		l.windowEnd = time.Time{}
+		return
+	}
+	l.interval = reset / time.Duration(remaining)
+	l.windowEnd = windowEnd
+}
+
+// parseRateLimitReset parses X-RateLimit-Reset, which APIs send either as a
+// number of seconds until the reset or as a Unix timestamp.
+func parseRateLimitReset(value string, now time.Time) (time.Duration, bool) {
+	seconds, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	// Anything past 2001-09-09 can't be a delay, treat it as a timestamp
+	if seconds > 1_000_000_000 {
+		reset := time.Unix(seconds, 0).Sub(now)
+		if reset < 0 {
+			reset = 0
+		}
+		return reset, true
+	}
+	return time.Duration(seconds) * time.Second, true
+}
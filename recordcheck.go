@@ -0,0 +1,250 @@
+package libdnsimmosquare
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+const (
+	// maxRecordTTL is the highest TTL allowed by RFC 2181 §8
+	maxRecordTTL = (1<<31 - 1) * time.Second
+
+	// maxNameLen and maxLabelLen are the length limits of RFC 1035 §2.3.4,
+	// leaving room for the root label in names
+	maxNameLen  = 253
+	maxLabelLen = 63
+)
+
+// InvalidRecordError is returned, joined with the others, for each record
+// failing the checks made before a write is sent, instead of letting the API
+// reject the whole request. It matches ErrInvalidRecord with errors.Is.
+type InvalidRecordError struct {
+	// Record is the invalid input record
+	Record libdns.Record
+	// Reason describes what is wrong with the record
+	Reason string
+}
+
+// Error implements the error interface.
+func (e *InvalidRecordError) Error() string {
+	rr := e.Record.RR()
+	return fmt.Sprintf("invalid record %s %s %q: %s", rr.Name, rr.Type, rr.Data, e.Reason)
+}
+
+// Is reports whether target is ErrInvalidRecord.
+func (e *InvalidRecordError) Is(target error) bool {
+	return target == ErrInvalidRecord
+}
+
+// validateRecords checks the records to be written, with names already made
+// relative with relativeRecords: the syntax of their names, absolute names
+// being outside of the zone, TTLs within bounds, IP addresses of A and AAAA records and host
+// names of CNAME, MX and NS targets. It returns an *InvalidRecordError per
+// invalid record, joined.
+func validateRecords(records []libdns.Record) error {
+	var errs []error
+	for _, record := range records {
+		if reason := checkRR(record.RR()); reason != "" {
+			errs = append(errs, &InvalidRecordError{Record: record, Reason: reason})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkRR returns why rr can't be written, an empty string if it can
+func checkRR(rr libdns.RR) string {
+	name := normalizeName(rr.Name)
+	if reason := checkName(name, true); reason != "" {
+		return "name " + reason
+	}
+	if name != apexName && strings.HasSuffix(name, ".") {
+		return "name is outside of the zone"
+	}
+	if rr.TTL < 0 {
+		return "negative TTL"
+	}
+	if rr.TTL > maxRecordTTL {
+		return fmt.Sprintf("TTL above %d seconds", int64(maxRecordTTL/time.Second))
+	}
+
+	switch strings.ToUpper(rr.Type) {
+	case "A", "AAAA":
+		ip, err := netip.ParseAddr(rr.Data)
+		if err != nil {
+			return "invalid IP address"
+		}
+		if strings.EqualFold(rr.Type, "A") != ip.Is4() {
+			return "IP address of the wrong family for the record type"
+		}
+	case "CNAME", "NS":
+		if reason := checkName(rr.Data, false); reason != "" {
+			return "target " + reason
+		}
+	case "MX":
+		fields := strings.Fields(rr.Data)
+		if len(fields) == 0 || len(fields) > 2 {
+			return `data must be "preference target"`
+		}
+		if len(fields) == 2 {
+			if _, err := strconv.ParseUint(fields[0], 10, 16); err != nil {
+				return "invalid preference " + strconv.Quote(fields[0])
+			}
+		}
+		// "." is the null MX of RFC 7505
+		if target := fields[len(fields)-1]; target != "." {
+			if reason := checkName(target, false); reason != "" {
+				return "target " + reason
+			}
+		}
+	}
+	return ""
+}
+
+// checkName returns why name isn't a valid relative or absolute domain name,
+// an empty string if it is. Owner names may be empty or "@" for the apex and
+// start with a "*" wildcard label.
+func checkName(name string, owner bool) string {
+	if name == "@" || (owner && name == "") {
+		return ""
+	}
+	if name == "" {
+		return "is empty"
+	}
+	trimmed := strings.TrimSuffix(name, ".")
+	if len(trimmed) > maxNameLen {
+		return fmt.Sprintf("is longer than %d characters", maxNameLen)
+	}
+	for i, label := range strings.Split(trimmed, ".") {
+		if label == "" {
+			return "has an empty label"
+		}
+		if len(label) > maxLabelLen {
+			return fmt.Sprintf("has a label longer than %d characters", maxLabelLen)
+		}
+		if label == "*" && owner && i == 0 {
+			continue
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				if c > 0x7f {
+					return fmt.Sprintf("has the non-ASCII character %q (use the punycode form)", c)
+				}
+				return fmt.Sprintf("has the invalid character %q", c)
+			}
+		}
+	}
+	return ""
+}
+
+// cnameCompatibleTypes may coexist with a CNAME at the same name (RFC 4035
+// §2.5)
+var cnameCompatibleTypes = map[string]bool{"RRSIG": true, "NSEC": true, "NSEC3": true}
+
+// checkCNAMEConflicts checks that writing records wouldn't leave a CNAME at
+// the zone apex or alongside other records at the same name (RFC 1034
+// §3.6.2), among records and with the existing records of zone not replaced
+// by them; existing is nil when records are only added, or replace the
+// whole zone.
+//
+// With resolve set, existing records conflicting with records are returned
+// to be deleted instead: the other records at the name of a new CNAME, or
+// the CNAME at the name of a new record. Conflicts among records are always
+// reported, as an *InvalidRecordError per record, joined.
+func checkCNAMEConflicts(records []libdns.Record, existing []libdns.Record, resolve bool) ([]libdns.Record, error) {
+	// Indexes of records by name, and their types other than the
+	// CNAME-compatible ones
+	byName := make(map[string][]int)
+	types := make(map[string][]string)
+	cnames := make(map[string]map[string]bool)
+	replaced := make(map[rrsetKey]bool, len(records))
+	for i, record := range records {
+		rr := record.RR()
+		key := keyOf(rr)
+		replaced[key] = true
+		byName[key.name] = append(byName[key.name], i)
+		if cnameCompatibleTypes[key.rtype] {
+			continue
+		}
+		if !containsString(types[key.name], key.rtype) {
+			types[key.name] = append(types[key.name], key.rtype)
+		}
+		if key.rtype == "CNAME" {
+			if cnames[key.name] == nil {
+				cnames[key.name] = make(map[string]bool)
+			}
+			cnames[key.name][strings.ToLower(strings.TrimSuffix(rr.Data, "."))] = true
+		}
+	}
+
+	reasons := make(map[int]string)
+	for i, record := range records {
+		key := keyOf(record.RR())
+		if key.rtype != "CNAME" {
+			continue
+		}
+		switch {
+		case key.name == apexName:
+			reasons[i] = "CNAME at the zone apex"
+		case len(cnames[key.name]) > 1:
+			reasons[i] = "more than one CNAME for the name"
+		case len(types[key.name]) > 1:
+			other := types[key.name][0]
+			if other == "CNAME" {
+				other = types[key.name][1]
+			}
+			reasons[i] = fmt.Sprintf("CNAME alongside %s records of the same name", other)
+		}
+	}
+
+	var conflicting []libdns.Record
+	for _, current := range existing {
+		key := keyOf(current.RR())
+		if replaced[key] || cnameCompatibleTypes[key.rtype] {
+			continue
+		}
+		for _, i := range byName[key.name] {
+			rtype := keyOf(records[i].RR()).rtype
+			if cnameCompatibleTypes[rtype] || (rtype != "CNAME" && key.rtype != "CNAME") {
+				continue
+			}
+			if resolve {
+				conflicting = append(conflicting, current)
+				break
+			}
+			if _, ok := reasons[i]; !ok {
+				if key.rtype == "CNAME" {
+					reasons[i] = "record alongside the existing CNAME of the name"
+				} else {
+					reasons[i] = fmt.Sprintf("CNAME alongside the existing %s records of the name", key.rtype)
+				}
+			}
+		}
+	}
+
+	if len(reasons) > 0 {
+		errs := make([]error, 0, len(reasons))
+		for i, record := range records {
+			if reason, ok := reasons[i]; ok {
+				errs = append(errs, &InvalidRecordError{Record: record, Reason: reason})
+			}
+		}
+		return nil, errors.Join(errs...)
+	}
+	return conflicting, nil
+}
+
+// containsString reports whether values contains value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package libdnsimmosquare_test
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+
+	libdnsimmosquare "github.com/immosquare/libdns-immosquare"
+	"github.com/immosquare/libdns-immosquare/immosquaretest"
+)
+
+func TestCNAMEConflicts(t *testing.T) {
+	address := libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.1"), TTL: time.Hour}
+	cname := libdns.CNAME{Name: "www", Target: "lb.example.net.", TTL: time.Hour}
+
+	for _, test := range []struct {
+		name    string
+		write   func(p *libdnsimmosquare.Provider) error
+		initial []immosquaretest.Record
+	}{
+		{"CNAME at the apex", func(p *libdnsimmosquare.Provider) error {
+			_, err := p.AppendRecords(context.Background(), "example.com", []libdns.Record{
+				libdns.CNAME{Name: "@", Target: "lb.example.net.", TTL: time.Hour},
+			})
+			return err
+		}, nil},
+		{"several CNAMEs", func(p *libdnsimmosquare.Provider) error {
+			_, err := p.AppendRecords(context.Background(), "example.com", []libdns.Record{
+				cname, libdns.CNAME{Name: "www", Target: "other.example.net.", TTL: time.Hour},
+			})
+			return err
+		}, nil},
+		{"CNAME with other records", func(p *libdnsimmosquare.Provider) error {
+			_, err := p.AppendRecords(context.Background(), "example.com", []libdns.Record{cname, address})
+			return err
+		}, nil},
+		{"CNAME over existing records", func(p *libdnsimmosquare.Provider) error {
+			_, err := p.SetRecords(context.Background(), "example.com", []libdns.Record{cname})
+			return err
+		}, []immosquaretest.Record{{Name: "www", Type: "A", Value: "192.0.2.1", TTL: 3600}}},
+		{"record over an existing CNAME", func(p *libdnsimmosquare.Provider) error {
+			_, err := p.SetRecords(context.Background(), "example.com", []libdns.Record{address})
+			return err
+		}, []immosquaretest.Record{{Name: "www", Type: "CNAME", Value: "lb.example.net.", TTL: 3600}}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			srv := immosquaretest.NewServer("token")
+			defer srv.Close()
+			srv.AddZone("example.com", test.initial...)
+
+			// Nothing is written
+			err := test.write(srv.Provider())
+			if !errors.Is(err, libdnsimmosquare.ErrInvalidRecord) {
+				t.Errorf("err = %v, want ErrInvalidRecord", err)
+			}
+			if got := len(srv.Records("example.com")); got != len(test.initial) {
+				t.Errorf("%d records in the zone, want %d", got, len(test.initial))
+			}
+		})
+	}
+}
+
+func TestResolveCNAMEConflicts(t *testing.T) {
+	srv := immosquaretest.NewServer("token")
+	defer srv.Close()
+	srv.AddZone("example.com",
+		immosquaretest.Record{Name: "www", Type: "A", Value: "192.0.2.1", TTL: 3600},
+		immosquaretest.Record{Name: "www", Type: "AAAA", Value: "2001:db8::1", TTL: 3600},
+		immosquaretest.Record{Name: "api", Type: "A", Value: "192.0.2.2", TTL: 3600})
+
+	provider := srv.Provider(libdnsimmosquare.WithResolveCNAMEConflicts())
+	if _, err := provider.SetRecords(context.Background(), "example.com", []libdns.Record{
+		libdns.CNAME{Name: "www", Target: "lb.example.net.", TTL: time.Hour},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	assertZone(t, srv, "example.com",
+		"api A 192.0.2.2",
+		"www CNAME lb.example.net.")
+}
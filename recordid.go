@@ -0,0 +1,177 @@
+package libdnsimmosquare
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// RecordMetadata is stored in the ProviderData field of the records returned
+// by GetRecords and AppendRecords when the API assigns IDs to records.
+// Records passed back to DeleteRecords or SetRecords with their
+// ProviderData intact are then matched by ID instead of by value.
+//
+// Note that libdns.RR has no ProviderData field, so records of types this
+// package can't parse never carry metadata.
+type RecordMetadata struct {
+	// ID is the server-assigned record ID
+	ID string
+
+	// CreatedAt is the creation time of the record, zero when the API
+	// doesn't return it
+	CreatedAt time.Time
+}
+
+// apiID is a record ID which the API may encode as a JSON string or number
+type apiID string
+
+// UnmarshalJSON accepts both strings and numbers
+func (id *apiID) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		*id = ""
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*id = apiID(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	*id = apiID(n.String())
+	return nil
+}
+
+// apiTime is a timestamp which the API may encode as an RFC 3339 string or
+// as Unix seconds. Values in any other format are ignored rather than
+// failing the whole response.
+type apiTime time.Time
+
+// UnmarshalJSON accepts RFC 3339 strings and Unix timestamps
+func (t *apiTime) UnmarshalJSON(data []byte) error {
+	*t = apiTime{}
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		if parsed, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			*t = apiTime(parsed)
+		}
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err == nil {
+		if seconds, err := n.Int64(); err == nil && seconds > 0 {
+			*t = apiTime(time.Unix(seconds, 0))
+		}
+	}
+	return nil
+}
+
+// withMetadata attaches the server-assigned ID and creation time of
+// apiRecord to record, if any
+func withMetadata(record libdns.Record, apiRecord apiRecord) libdns.Record {
+	if apiRecord.ID == "" && time.Time(apiRecord.CreatedAt).IsZero() {
+		return record
+	}
+	metadata := RecordMetadata{ID: string(apiRecord.ID), CreatedAt: time.Time(apiRecord.CreatedAt)}
+	switch r := record.(type) {
+	case libdns.Address:
+		r.ProviderData = metadata
+		return r
+	case libdns.TXT:
+		r.ProviderData = metadata
+		return r
+	case libdns.CNAME:
+		r.ProviderData = metadata
+		return r
+	case libdns.MX:
+		r.ProviderData = metadata
+		return r
+	case libdns.NS:
+		r.ProviderData = metadata
+		return r
+	case libdns.SRV:
+		r.ProviderData = metadata
+		return r
+	case libdns.CAA:
+		r.ProviderData = metadata
+		return r
+	case libdns.ServiceBinding:
+		r.ProviderData = metadata
+		return r
+	default:
+		return record
+	}
+}
+
+// recordID returns the server-assigned ID of record, or an empty string
+func recordID(record libdns.Record) string {
+	return recordMetadata(record).ID
+}
+
+// recordMetadata returns the metadata stored in the ProviderData of record,
+// or an empty RecordMetadata
+func recordMetadata(record libdns.Record) RecordMetadata {
+	var providerData any
+	switch r := record.(type) {
+	case libdns.Address:
+		providerData = r.ProviderData
+	case libdns.TXT:
+		providerData = r.ProviderData
+	case libdns.CNAME:
+		providerData = r.ProviderData
+	case libdns.MX:
+		providerData = r.ProviderData
+	case libdns.NS:
+		providerData = r.ProviderData
+	case libdns.SRV:
+		providerData = r.ProviderData
+	case libdns.CAA:
+		providerData = r.ProviderData
+	case libdns.ServiceBinding:
+		providerData = r.ProviderData
+	}
+	switch data := providerData.(type) {
+	case RecordMetadata:
+		return data
+	case *RecordMetadata:
+		if data != nil {
+			return *data
+		}
+	}
+	return RecordMetadata{}
+}
+
+// createdRecords returns the records created by a successful POST. When the
+// API echoes the created records (one per input record, typically with their
+// IDs), those are returned; otherwise the input records are returned
+// converted to specific types.
+func (p *Provider) createdRecords(zone string, body []byte, records []libdns.Record) []libdns.Record {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return p.convertToSpecificTypes(records)
+	}
+
+	var apiResponse apiRecordsResponse
+	if err := json.Unmarshal(body, &apiResponse); err != nil {
+		if err := json.Unmarshal(body, &apiResponse.Records); err != nil {
+			return p.convertToSpecificTypes(records)
+		}
+	}
+	if len(apiResponse.Records) != len(records) {
+		return p.convertToSpecificTypes(records)
+	}
+
+	created := make([]libdns.Record, 0, len(apiResponse.Records))
+	for _, apiRecord := range apiResponse.Records {
+		record, err := p.convertAPIRecordToLibDNS(zone, apiRecord)
+		if err != nil {
+			return p.convertToSpecificTypes(records)
+		}
+		created = append(created, withMetadata(record, apiRecord))
+	}
+	return created
+}
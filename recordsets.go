@@ -0,0 +1,70 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// RecordSet groups the records of a zone sharing a name and a type (an
+// RRset), as returned by GetRecordSets
+type RecordSet struct {
+	// Name is the name of the records, relative to the zone
+	Name string
+	// Type is the record type, in upper case
+	Type string
+	// TTL is the lowest TTL of the records: resolvers use a single TTL per
+	// RRset (RFC 2181 §5.2)
+	TTL time.Duration
+	// Values are the data of the records, in the order of Records
+	Values []string
+	// Records are the records of the set, in zone order
+	Records []libdns.Record
+}
+
+// GetRecordSets returns the records of zone grouped into RRsets, sorted by
+// name then type, which makes diffing and round-robin management easier than
+// flat record slices.
+func (p *Provider) GetRecordSets(ctx context.Context, zone string) ([]RecordSet, error) {
+	records, err := p.GetRecords(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	return GroupRecordSets(records), nil
+}
+
+// GroupRecordSets groups records into RRsets, sorted by name then type.
+// Names are compared case-insensitively and without trailing dot, like
+// SetRecords does.
+func GroupRecordSets(records []libdns.Record) []RecordSet {
+	index := make(map[rrsetKey]int)
+	var sets []RecordSet
+	for _, record := range records {
+		rr := record.RR()
+		key := keyOf(rr)
+		i, ok := index[key]
+		if !ok {
+			i = len(sets)
+			index[key] = i
+			sets = append(sets, RecordSet{Name: rr.Name, Type: key.rtype, TTL: rr.TTL})
+		}
+		set := &sets[i]
+		if rr.TTL < set.TTL {
+			set.TTL = rr.TTL
+		}
+		set.Values = append(set.Values, rr.Data)
+		set.Records = append(set.Records, record)
+	}
+
+	sort.SliceStable(sets, func(i, j int) bool {
+		a := keyOf(libdns.RR{Name: sets[i].Name, Type: sets[i].Type})
+		b := keyOf(libdns.RR{Name: sets[j].Name, Type: sets[j].Type})
+		if a.name != b.name {
+			return a.name < b.name
+		}
+		return a.rtype < b.rtype
+	})
+	return sets
+}
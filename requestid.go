@@ -0,0 +1,45 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// requestIDHeader carries the ID of every request, so failures can be
+// correlated with the server logs
+const requestIDHeader = "X-Request-Id"
+
+// requestIDKey is the context key set by ContextWithRequestID
+type requestIDKey struct{}
+
+// ContextWithRequestID returns a copy of ctx whose API requests are sent
+// with id as their X-Request-Id header, instead of a generated one, e.g. to
+// propagate the ID of the operation they are part of.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// newRequestID returns the request ID set on ctx by ContextWithRequestID,
+// or a new random one
+func newRequestID(ctx context.Context) string {
+	if id, _ := ctx.Value(requestIDKey{}).(string); id != "" {
+		return id
+	}
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// responseRequestID returns the request ID of resp: the one returned by the
+// server, if any, otherwise the one it was requested with
+func responseRequestID(resp *http.Response) string {
+	if id := resp.Header.Get(requestIDHeader); id != "" {
+		return id
+	}
+	if resp.Request != nil {
+		return resp.Request.Header.Get(requestIDHeader)
+	}
+	return ""
+}
@@ -0,0 +1,163 @@
+package libdnsimmosquare
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// RecordError is returned, joined with the others, for each record the API
+// rejected when it reports per-record results for a write (typically with
+// a 207 Multi-Status response). Use errors.As to inspect it.
+type RecordError struct {
+	// Record is the rejected input record
+	Record libdns.Record
+	// StatusCode is the status of the record result, if any
+	StatusCode int
+	// Code is the machine-readable error code of the record result, if any
+	Code string
+	// Message is the human-readable error message of the record result, if any
+	Message string
+}
+
+// Error implements the error interface.
+func (e *RecordError) Error() string {
+	rr := e.Record.RR()
+	var b strings.Builder
+	fmt.Fprintf(&b, "record %s %s %q rejected", rr.Name, rr.Type, rr.Data)
+	if e.StatusCode != 0 {
+		fmt.Fprintf(&b, " with status %d", e.StatusCode)
+	}
+	if e.Code != "" {
+		b.WriteString(" [" + e.Code + "]")
+	}
+	if e.Message != "" {
+		b.WriteString(": " + e.Message)
+	}
+	return b.String()
+}
+
+// Is reports whether e matches target, one of the sentinel errors such as
+// ErrConflict.
+func (e *RecordError) Is(target error) bool {
+	sentinel := statusError(e.StatusCode, e.Code)
+	if sentinel == ErrZoneNotFound && e.Code == "" {
+		// A record result without code is about the record
+		sentinel = ErrRecordNotFound
+	}
+	return sentinel != nil && sentinel == target
+}
+
+// IsRetryable reports whether the record was rejected with a transient
+// failure: a 429 or 5xx status.
+func (e *RecordError) IsRetryable() bool {
+	return retryableStatus(e.StatusCode)
+}
+
+// Temporary is the same as IsRetryable.
+func (e *RecordError) Temporary() bool {
+	return e.IsRetryable()
+}
+
+// apiRecordResult is the outcome of a single record of a write, as found in
+// the "results" array of a response:
+//
+//	{"results": [{"index": 0, "status": 201, "record": {...}},
+//	             {"index": 1, "status": 422, "error": {"code": "...", "message": "..."}}]}
+//
+// Index defaults to the position in the array. A result is a failure when
+// success is false, status is not 2xx, or error is set.
+type apiRecordResult struct {
+	Index   *int            `json:"index"`
+	Status  int             `json:"status"`
+	Success *bool           `json:"success"`
+	Record  *apiRecord      `json:"record"`
+	Error   json.RawMessage `json:"error"`
+	Code    string          `json:"code"`
+	Message string          `json:"message"`
+}
+
+// failure returns the error of a failed result for record, nil on success
+func (r apiRecordResult) failure(record libdns.Record) *RecordError {
+	hasError := len(r.Error) > 0 && !bytes.Equal(r.Error, []byte("null"))
+	failed := hasError ||
+		(r.Success != nil && !*r.Success) ||
+		(r.Status != 0 && (r.Status < 200 || r.Status > 299))
+	if !failed {
+		return nil
+	}
+	code, message := decodeErrorField(r.Error, r.Code, r.Message)
+	return &RecordError{Record: record, StatusCode: r.Status, Code: code, Message: message}
+}
+
+// decodeRecordResults decodes the per-record results of a write response.
+// ok is false when body has no "results" array.
+func decodeRecordResults(body []byte) (results []apiRecordResult, ok bool) {
+	var response struct {
+		Results []apiRecordResult `json:"results"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil || response.Results == nil {
+		return nil, false
+	}
+	return response.Results, true
+}
+
+// recordResults matches per-record results to the records of the request.
+// It returns the succeeded records, in input order, with their IDs when the
+// results include them, and a *RecordError per failed record, joined.
+// Records without a result are reported as failed.
+func (p *Provider) recordResults(zone string, results []apiRecordResult, records []libdns.Record) ([]libdns.Record, error) {
+	succeeded := make([]libdns.Record, len(records))
+	errs := make([]error, len(records))
+	seen := make([]bool, len(records))
+	for i, result := range results {
+		index := i
+		if result.Index != nil {
+			index = *result.Index
+		}
+		if index < 0 || index >= len(records) || seen[index] {
+			return nil, fmt.Errorf("invalid record result index %d", index)
+		}
+		seen[index] = true
+
+		if failure := result.failure(records[index]); failure != nil {
+			errs[index] = failure
+			continue
+		}
+		succeeded[index] = p.convertToSpecificTypes(records[index : index+1])[0]
+		if result.Record != nil {
+			if record, err := p.convertAPIRecordToLibDNS(zone, *result.Record); err == nil {
+				succeeded[index] = withMetadata(record, *result.Record)
+			}
+		}
+	}
+
+	written := make([]libdns.Record, 0, len(records))
+	for i := range records {
+		switch {
+		case !seen[i]:
+			errs[i] = &RecordError{Record: records[i], Message: "no result returned"}
+		case succeeded[i] != nil:
+			written = append(written, succeeded[i])
+		}
+	}
+	return written, errors.Join(errs...)
+}
+
+// batchResults returns the outcome of a successful write request: the
+// per-record results when body has some, otherwise all of records, or an
+// error for a 207 response without results.
+func (p *Provider) batchResults(zone string, resp *http.Response, body []byte, records []libdns.Record) ([]libdns.Record, error) {
+	if results, ok := decodeRecordResults(body); ok {
+		return p.recordResults(zone, results, records)
+	}
+	if resp.StatusCode == http.StatusMultiStatus {
+		return nil, fmt.Errorf("multi-status response without record results")
+	}
+	return p.convertToSpecificTypes(records), nil
+}
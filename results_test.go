@@ -0,0 +1,91 @@
+package libdnsimmosquare_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+
+	libdnsimmosquare "github.com/immosquare/libdns-immosquare"
+	"github.com/immosquare/libdns-immosquare/immosquaretest"
+)
+
+// newMultiStatusFront returns a provider talking to srv through a front
+// answering the first POST itself: it adds the first record to srv and
+// rejects the second one with a 207 Multi-Status response
+func newMultiStatusFront(t *testing.T, srv *immosquaretest.Server) *libdnsimmosquare.Provider {
+	t.Helper()
+	var posts atomic.Int32
+	front := newFront(t, srv, func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method != http.MethodPost || posts.Add(1) > 1 {
+			return false
+		}
+		var body struct {
+			Records []immosquaretest.Record `json:"records"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || len(body.Records) != 2 {
+			t.Errorf("unexpected request: %v", err)
+			return false
+		}
+		written := immosquaretest.Record{ID: "1", Name: body.Records[0].Name, Type: body.Records[0].Type, Value: "192.0.2.1", TTL: 3600}
+		srv.AddZone("example.com", written)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMultiStatus)
+		json.NewEncoder(w).Encode(map[string]interface{}{"results": []interface{}{
+			map[string]interface{}{"index": 0, "status": http.StatusCreated, "record": written},
+			map[string]interface{}{"index": 1, "status": http.StatusUnprocessableEntity, "error": map[string]string{
+				"code":    "invalid_value",
+				"message": "address not allowed",
+			}},
+		}})
+		return true
+	})
+	return libdnsimmosquare.NewProvider(front.URL, libdnsimmosquare.WithAPIToken("token"))
+}
+
+func TestMultiStatus(t *testing.T) {
+	records := []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.1"), TTL: time.Hour},
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.2"), TTL: time.Hour},
+	}
+
+	t.Run("AppendRecords", func(t *testing.T) {
+		srv := immosquaretest.NewServer("token")
+		defer srv.Close()
+		srv.AddZone("example.com")
+
+		added, err := newMultiStatusFront(t, srv).AppendRecords(context.Background(), "example.com", records)
+		if len(added) != 1 || added[0].RR().Data != "192.0.2.1" {
+			t.Errorf("added = %v, want the first record", added)
+		}
+		var recordErr *libdnsimmosquare.RecordError
+		if !errors.As(err, &recordErr) {
+			t.Fatalf("err = %v, want a *RecordError", err)
+		}
+		if rr := recordErr.Record.RR(); rr.Data != "192.0.2.2" || recordErr.StatusCode != http.StatusUnprocessableEntity ||
+			recordErr.Code != "invalid_value" || recordErr.Message != "address not allowed" {
+			t.Errorf("record error = %+v for %v", recordErr, rr)
+		}
+		assertZone(t, srv, "example.com", "www A 192.0.2.1")
+	})
+
+	// The record written is rolled back
+	t.Run("SetRecords", func(t *testing.T) {
+		srv := immosquaretest.NewServer("token")
+		defer srv.Close()
+		srv.AddZone("example.com")
+
+		_, err := newMultiStatusFront(t, srv).SetRecords(context.Background(), "example.com", records)
+		var recordErr *libdnsimmosquare.RecordError
+		if !errors.As(err, &recordErr) {
+			t.Fatalf("err = %v, want a *RecordError", err)
+		}
+		assertZone(t, srv, "example.com")
+	})
+}
@@ -0,0 +1,176 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultMaxRetries is used when Provider.MaxRetries is zero.
+	defaultMaxRetries = 3
+
+	// retryBaseDelay is the delay before the first retry, doubled on each
+	// subsequent attempt.
+	retryBaseDelay = 500 * time.Millisecond
+
+	// retryMaxDelay caps both the computed backoff and any Retry-After value
+	// sent by the API, so a misbehaving server can't stall a caller forever.
+	retryMaxDelay = 30 * time.Second
+)
+
+// maxRetries returns the number of retries to perform for a request.
+func (p *Provider) maxRetries() int {
+	if p.MaxRetries < 0 {
+		return 0
+	}
+	if p.MaxRetries == 0 {
+		return defaultMaxRetries
+	}
+	return p.MaxRetries
+}
+
+// shouldRetry reports whether a request with method that produced resp and
+// err is worth retrying. Cancellation of the caller's context is never
+// retried, but an attempt that hit its own timeout is. Non-idempotent
+// requests, which the API may have applied even though the response was
+// lost or is a 5xx, are only retried when they provably weren't processed:
+// no connection could be made, or the response is a 429.
+func shouldRetry(ctx context.Context, method string, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if !idempotentMethod(method) {
+		if err != nil {
+			return requestNotSent(err)
+		}
+		return resp.StatusCode == http.StatusTooManyRequests
+	}
+	if err != nil {
+		return retryableTransportError(err)
+	}
+	return retryableStatus(resp.StatusCode)
+}
+
+// idempotentMethod reports whether sending a request with method several
+// times has the same effect as sending it once (RFC 9110, section 9.2.2)
+func idempotentMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// requestNotSent reports whether an error from the HTTP client happened
+// before the request could be written: resolving or connecting to the API
+// host or its proxy failed.
+func requestNotSent(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && (opErr.Op == "dial" || opErr.Op == "proxyconnect")
+}
+
+// retryableStatus reports whether a response status is a transient failure
+func retryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// retryableTransportError reports whether an error from the HTTP client is
+// a transient failure. Certificate verification failures are permanent, as
+// are cancellations.
+func retryableTransportError(err error) bool {
+	var certErr *tls.CertificateVerificationError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	switch {
+	case errors.Is(err, context.Canceled),
+		errors.As(err, &certErr),
+		errors.As(err, &authorityErr),
+		errors.As(err, &hostnameErr),
+		errors.As(err, &invalidErr):
+		return false
+	}
+	return true
+}
+
+// IsRetryable reports whether err, as returned by the Provider methods, is
+// a transient failure (network error, 429 or 5xx response) that may succeed
+// if tried again later, as opposed to a permanent failure such as a 4xx
+// response caused by the configuration or the input.
+func IsRetryable(err error) bool {
+	var retryable interface{ IsRetryable() bool }
+	return errors.As(err, &retryable) && retryable.IsRetryable()
+}
+
+// retryDelay returns how long to wait before the next attempt. A Retry-After
+// header on the response takes precedence over the exponential backoff.
+func (p *Provider) retryDelay(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if wait, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			if wait > retryMaxDelay {
+				wait = retryMaxDelay
+			}
+			return wait
+		}
+	}
+
+	backoff := retryBaseDelay << uint(attempt)
+	if backoff <= 0 || backoff > retryMaxDelay {
+		backoff = retryMaxDelay
+	}
+	// Jitter between half and the whole backoff to avoid synchronized
+	// retries from concurrent callers
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// parseRetryAfter parses a Retry-After header value, which is either a number
+// of seconds or an HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		wait := date.Sub(now)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
+
+// retryReason describes why a request is being retried, for logging
+func retryReason(resp *http.Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return resp.Status
+}
+
+// sleepContext waits for d or until ctx is done, whichever comes first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,124 @@
+package libdnsimmosquare_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+
+	libdnsimmosquare "github.com/immosquare/libdns-immosquare"
+	"github.com/immosquare/libdns-immosquare/immosquaretest"
+)
+
+// newFront starts a server proxying to srv, except for the requests
+// intercept answers itself by returning true
+func newFront(t *testing.T, srv *immosquaretest.Server, intercept func(w http.ResponseWriter, r *http.Request) bool) *httptest.Server {
+	t.Helper()
+	target, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	front := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !intercept(w, r) {
+			proxy.ServeHTTP(w, r)
+		}
+	}))
+	t.Cleanup(front.Close)
+	return front
+}
+
+func TestRetries(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		method   string
+		status   int
+		attempts int32
+		records  int
+		wantErr  bool
+	}{
+		// The API may have applied a POST answered with a 5xx
+		{"POST 503", http.MethodPost, http.StatusServiceUnavailable, 1, 0, true},
+		{"POST 429", http.MethodPost, http.StatusTooManyRequests, 2, 1, false},
+		{"GET 503", http.MethodGet, http.StatusServiceUnavailable, 2, 0, false},
+		{"DELETE 502", http.MethodDelete, http.StatusBadGateway, 2, 0, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			srv := immosquaretest.NewServer("token")
+			defer srv.Close()
+			srv.AddZone("example.com")
+			// The first request with the method fails with status
+			var attempts atomic.Int32
+			front := newFront(t, srv, func(w http.ResponseWriter, r *http.Request) bool {
+				if r.Method != test.method {
+					return false
+				}
+				if attempts.Add(1) > 1 {
+					return false
+				}
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(test.status)
+				return true
+			})
+
+			ctx := context.Background()
+			provider := libdnsimmosquare.NewProvider(front.URL, libdnsimmosquare.WithAPIToken("token"), libdnsimmosquare.WithMaxRetries(2))
+			var err error
+			switch test.method {
+			case http.MethodPost:
+				_, err = provider.AppendRecords(ctx, "example.com", []libdns.Record{
+					libdns.TXT{Name: "test", Text: "value", TTL: time.Minute},
+				})
+			case http.MethodGet:
+				_, err = provider.GetRecords(ctx, "example.com")
+			case http.MethodDelete:
+				_, err = provider.DeleteRecords(ctx, "example.com", []libdns.Record{
+					libdns.TXT{Name: "test", Text: "value"},
+				})
+			}
+			if (err != nil) != test.wantErr {
+				t.Errorf("err = %v, want error: %t", err, test.wantErr)
+			}
+			if got := attempts.Load(); got != test.attempts {
+				t.Errorf("%d attempts, want %d", got, test.attempts)
+			}
+			if got := len(srv.Records("example.com")); got != test.records {
+				t.Errorf("%d records in the zone, want %d", got, test.records)
+			}
+		})
+	}
+}
+
+func TestRetryConnectionFailure(t *testing.T) {
+	// A closed port: the POST provably never reached the API, so it is
+	// retried and fails over
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := "http://" + listener.Addr().String()
+	listener.Close()
+
+	srv := immosquaretest.NewServer("token")
+	defer srv.Close()
+	srv.AddZone("example.com")
+	provider := libdnsimmosquare.NewProvider(closed,
+		libdnsimmosquare.WithAPIToken("token"),
+		libdnsimmosquare.WithFallbackEndpoints(srv.URL),
+	)
+	if _, err := provider.AppendRecords(context.Background(), "example.com", []libdns.Record{
+		libdns.TXT{Name: "test", Text: "value", TTL: time.Minute},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(srv.Records("example.com")); got != 1 {
+		t.Errorf("%d records in the zone, want 1", got)
+	}
+}
@@ -0,0 +1,116 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// ReverseSync is the result of SyncReverse.
+type ReverseSync struct {
+	// Records are the PTR records written, by reverse zone
+	Records map[string][]libdns.Record
+
+	// Unhosted are the addresses whose reverse zone is not hosted on the
+	// account, left without PTR records
+	Unhosted []netip.Addr
+}
+
+// SyncReverse writes the PTR records matching the A and AAAA records of
+// zone in the in-addr.arpa and ip6.arpa zones hosted on the same account,
+// so forward and reverse DNS stay in sync: each address points back to the
+// names of zone it's the address of. records are the A and AAAA records to
+// reflect, all of those of zone if empty; other records, and wildcard
+// names, are ignored.
+//
+// The reverse zone of an address is the most specific hosted zone it falls
+// in, e.g. "2.0.192.in-addr.arpa" for 192.0.2.1. The PTR RRsets of the
+// addresses are replaced with SetRecords, one reverse zone after the other,
+// and the function stops at the first failure, returning the records
+// already written.
+func (p *Provider) SyncReverse(ctx context.Context, zone string, records []libdns.Record) (ReverseSync, error) {
+	if len(records) == 0 {
+		var err error
+		if records, err = p.GetRecords(ctx, zone); err != nil {
+			return ReverseSync{}, fmt.Errorf("error fetching current records: %w", err)
+		}
+	}
+	zones, err := p.ListZones(ctx)
+	if err != nil {
+		return ReverseSync{}, fmt.Errorf("error listing the zones: %w", err)
+	}
+	var reverseZones []string
+	for _, z := range zones {
+		name := normalizeZone(z.Name)
+		if strings.HasSuffix(name, ".in-addr.arpa") || strings.HasSuffix(name, ".ip6.arpa") {
+			reverseZones = append(reverseZones, name)
+		}
+	}
+
+	origin := dns.Fqdn(normalizeZone(zone))
+	result := ReverseSync{Records: make(map[string][]libdns.Record)}
+	ptrs := make(map[string][]libdns.Record)
+	seen := make(map[string]bool)
+	for _, record := range relativeRecords(zone, records) {
+		rr := record.RR()
+		rtype := strings.ToUpper(rr.Type)
+		if (rtype != "A" && rtype != "AAAA") || strings.HasPrefix(normalizeName(rr.Name), "*") {
+			continue
+		}
+		ip, err := netip.ParseAddr(rr.Data)
+		if err != nil {
+			return ReverseSync{}, fmt.Errorf("invalid %s record %q: %w", rtype, rr.Name, err)
+		}
+		reverseName, err := dns.ReverseAddr(ip.Unmap().String())
+		if err != nil {
+			return ReverseSync{}, err
+		}
+		target := libdns.AbsoluteName(normalizeName(rr.Name), origin)
+		if seen[reverseName+" "+target] {
+			continue
+		}
+		seen[reverseName+" "+target] = true
+
+		reverseZone := hostingZone(reverseZones, reverseName)
+		if reverseZone == "" {
+			if !seen[reverseName] {
+				seen[reverseName] = true
+				result.Unhosted = append(result.Unhosted, ip.Unmap())
+			}
+			continue
+		}
+		ptrs[reverseZone] = append(ptrs[reverseZone], libdns.RR{Name: reverseName, Type: "PTR", Data: target, TTL: rr.TTL})
+	}
+
+	names := make([]string, 0, len(ptrs))
+	for name := range ptrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		written, err := p.SetRecords(ctx, name, ptrs[name])
+		if err != nil {
+			return result, fmt.Errorf("error writing the PTR records of zone %s: %w", name, err)
+		}
+		result.Records[name] = written
+	}
+	return result, nil
+}
+
+// hostingZone returns the most specific of zones that name, absolute,
+// belongs to, an empty string if none
+func hostingZone(zones []string, name string) string {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	var best string
+	for _, zone := range zones {
+		if (name == zone || strings.HasSuffix(name, "."+zone)) && len(zone) > len(best) {
+			best = zone
+		}
+	}
+	return best
+}
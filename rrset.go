@@ -0,0 +1,459 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// rrsetKey identifies an RRset by (name, type)
+type rrsetKey struct {
+	name  string
+	rtype string
+}
+
+// keyOf returns the RRset key of rr. Names are compared case-insensitively
+// and without trailing dot, with the apex as "@", see normalizeName.
+func keyOf(rr libdns.RR) rrsetKey {
+	return rrsetKey{
+		name:  strings.ToLower(strings.TrimSuffix(normalizeName(rr.Name), ".")),
+		rtype: strings.ToUpper(rr.Type),
+	}
+}
+
+// recordKey identifies a single record within its RRset
+type recordKey struct {
+	rrsetKey
+	data string
+	ttl  time.Duration
+}
+
+// recordKeyOf returns the record key of rr
+func recordKeyOf(rr libdns.RR) recordKey {
+	return recordKey{rrsetKey: keyOf(rr), data: rr.Data, ttl: rr.TTL}
+}
+
+// diffRRsets computes the changes needed so that, for every RRset present in
+// desired, the zone contains exactly the desired records. Records of RRsets
+// absent from desired are never touched. A record whose TTL changed is
+// deleted and added again.
+func diffRRsets(existing []libdns.Record, desired []libdns.RR) (toDelete, toAdd []libdns.Record) {
+	wanted := make(map[rrsetKey]bool, len(desired))
+	for _, rr := range desired {
+		wanted[keyOf(rr)] = true
+	}
+
+	current := make(map[recordKey]bool)
+	for _, record := range existing {
+		rr := record.RR()
+		if wanted[keyOf(rr)] {
+			current[recordKeyOf(rr)] = true
+		}
+	}
+
+	kept := make(map[recordKey]bool, len(desired))
+	for _, rr := range desired {
+		key := recordKeyOf(rr)
+		if kept[key] {
+			continue
+		}
+		kept[key] = true
+		if !current[key] {
+			toAdd = append(toAdd, rr)
+		}
+	}
+	for _, record := range existing {
+		rr := record.RR()
+		key := recordKeyOf(rr)
+		if current[key] && !kept[key] {
+			// Keep the original record so its ID, if any, is sent
+			toDelete = append(toDelete, record)
+		}
+	}
+	return toDelete, toAdd
+}
+
+// DeleteRRSet deletes every record of zone with the given name and type,
+// whatever its value, e.g. for ACME cleanup or key rotation workflows that
+// don't know the exact stored value. The name may be relative or absolute
+// and is compared case-insensitively. It returns the deleted records, none
+// if the RRset doesn't exist.
+func (p *Provider) DeleteRRSet(ctx context.Context, zone, name, rtype string) ([]libdns.Record, error) {
+	name = relativeName(name, zone)
+	records, err := p.fetchFilteredRecords(ctx, zone, RecordFilter{Name: name, Type: rtype})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching current records: %w", err)
+	}
+
+	key := keyOf(libdns.RR{Name: name, Type: rtype})
+	var matching []libdns.Record
+	for _, record := range records {
+		if keyOf(record.RR()) == key {
+			matching = append(matching, record)
+		}
+	}
+	if len(matching) == 0 {
+		return []libdns.Record{}, nil
+	}
+	return p.DeleteRecords(ctx, zone, matching)
+}
+
+// UpsertRecord makes record the only record of its RRset in zone: it is
+// created if there is no record with the same name and type, and otherwise
+// replaces them, which saves callers from fetching and comparing records
+// themselves. Its TTL is clamped like AppendRecords does. Nothing is written
+// when the RRset already holds exactly record, which is then returned as
+// stored, with its ID.
+func (p *Provider) UpsertRecord(ctx context.Context, zone string, record libdns.Record) (libdns.Record, error) {
+	record = relativeRecord(zone, record)
+	if err := validateRecords([]libdns.Record{record}); err != nil {
+		return nil, err
+	}
+	wanted, err := normalizeRecords([]libdns.Record{record}, p.ttlLimits(ctx))
+	if err != nil {
+		return nil, err
+	}
+	// Records of other types are needed for the CNAME conflicts check
+	existing, err := p.fetchFilteredRecords(ctx, zone, RecordFilter{Name: wanted[0].Name})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching current records: %w", err)
+	}
+	conflicting, err := checkCNAMEConflicts([]libdns.Record{record}, existing, p.ResolveCNAMEConflicts)
+	if err != nil {
+		return nil, err
+	}
+
+	want := recordKeyOf(wanted[0])
+	var current libdns.Record
+	var stale []libdns.Record
+	for _, candidate := range existing {
+		rr := candidate.RR()
+		if keyOf(rr) != want.rrsetKey {
+			continue
+		}
+		if current == nil && recordKeyOf(rr) == want {
+			current = candidate
+		} else {
+			stale = append(stale, candidate)
+		}
+	}
+	stale = append(stale, conflicting...)
+
+	var toAdd []libdns.Record
+	if current == nil {
+		toAdd = []libdns.Record{parseRR(wanted[0])}
+	}
+	if len(stale) > 0 || len(toAdd) > 0 {
+		if err := p.applyRRsetChanges(ctx, zone, stale, toAdd); err != nil {
+			return nil, fmt.Errorf("error during upsert: %w", err)
+		}
+		p.observeRecords(zone, "set", len(stale)+len(toAdd))
+	}
+	if current != nil {
+		return current, nil
+	}
+	return toAdd[0], nil
+}
+
+// ReplaceRRSet swaps the values of the RRset of zone with the given name and
+// type for values, e.g. to rotate all the A records of "www", with at most
+// one DELETE and one POST request: values already present are left
+// untouched, with their TTL, and new ones get the lowest TTL of the RRset,
+// or the minimum TTL if it's new. Like SetRecords, the removed values are
+// restored if adding the new ones fails. An empty values deletes the RRset.
+// It returns the records of the RRset after the swap.
+func (p *Provider) ReplaceRRSet(ctx context.Context, zone, name, rtype string, values []string) ([]libdns.Record, error) {
+	name = relativeName(name, zone)
+	// Records of other types are needed for the CNAME conflicts check
+	existing, err := p.fetchFilteredRecords(ctx, zone, RecordFilter{Name: name})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching current records: %w", err)
+	}
+
+	current, ttl := rrsetMembers(existing, name, rtype)
+
+	desired := make([]libdns.Record, 0, len(values))
+	for _, value := range values {
+		desired = append(desired, libdns.RR{Name: name, Type: rtype, Data: value, TTL: ttl})
+	}
+	if err := validateRecords(desired); err != nil {
+		return nil, err
+	}
+	conflicting, err := checkCNAMEConflicts(desired, existing, p.ResolveCNAMEConflicts)
+	if err != nil {
+		return nil, err
+	}
+	wanted, err := normalizeRecords(desired, p.ttlLimits(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	// Match on values only, so kept records aren't rewritten for their TTL
+	wantedData := make(map[string]bool, len(wanted))
+	for _, rr := range wanted {
+		wantedData[rr.Data] = true
+	}
+	kept := make(map[string]libdns.Record, len(current))
+	var toDelete []libdns.Record
+	for _, record := range current {
+		data := record.RR().Data
+		if _, ok := kept[data]; ok || !wantedData[data] {
+			toDelete = append(toDelete, record)
+			continue
+		}
+		kept[data] = record
+	}
+	toDelete = append(toDelete, conflicting...)
+	result := make([]libdns.Record, 0, len(wanted))
+	var toAdd []libdns.Record
+	seen := make(map[string]bool, len(wanted))
+	for _, rr := range wanted {
+		if seen[rr.Data] {
+			continue
+		}
+		seen[rr.Data] = true
+		if record, ok := kept[rr.Data]; ok {
+			result = append(result, record)
+			continue
+		}
+		record := parseRR(rr)
+		toAdd = append(toAdd, record)
+		result = append(result, record)
+	}
+
+	if len(toDelete) > 0 || len(toAdd) > 0 {
+		if err := p.applyRRsetChanges(ctx, zone, toDelete, toAdd); err != nil {
+			return nil, fmt.Errorf("error during replacement: %w", err)
+		}
+		p.observeRecords(zone, "set", len(toDelete)+len(toAdd))
+	}
+	return result, nil
+}
+
+// AddToRRSet adds value to the RRset of zone with the given name and type,
+// e.g. a server joining the A records of a round-robin name, without
+// touching the other members: unlike ReplaceRRSet, only the new record is
+// sent, so concurrent additions and removals of other values don't clobber
+// each other. The record gets the lowest TTL of the RRset, or the minimum
+// TTL if it's new. Nothing is written when the RRset already holds value.
+// It returns the records of the RRset after the addition.
+func (p *Provider) AddToRRSet(ctx context.Context, zone, name, rtype, value string) ([]libdns.Record, error) {
+	name = relativeName(name, zone)
+	// Records of other types are needed for the CNAME conflicts check
+	existing, err := p.fetchFilteredRecords(ctx, zone, RecordFilter{Name: name})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching current records: %w", err)
+	}
+	current, ttl := rrsetMembers(existing, name, rtype)
+
+	record := libdns.RR{Name: name, Type: rtype, Data: value, TTL: ttl}
+	if err := validateRecords([]libdns.Record{record}); err != nil {
+		return nil, err
+	}
+	conflicting, err := checkCNAMEConflicts([]libdns.Record{record}, existing, p.ResolveCNAMEConflicts)
+	if err != nil {
+		return nil, err
+	}
+	wanted, err := normalizeRecords([]libdns.Record{record}, p.ttlLimits(ctx))
+	if err != nil {
+		return nil, err
+	}
+	// Compare the data as rendered by libdns, e.g. for IPv6 addresses
+	added := parseRR(wanted[0])
+	for _, member := range current {
+		if sameData(rtype, member.RR().Data, added.RR().Data) {
+			return current, nil
+		}
+	}
+
+	if err := p.applyRRsetChanges(ctx, zone, conflicting, []libdns.Record{added}); err != nil {
+		return nil, fmt.Errorf("error adding to the RRset: %w", err)
+	}
+	p.observeRecords(zone, "append", len(conflicting)+1)
+	return append(current, added), nil
+}
+
+// RemoveFromRRSet removes value from the RRset of zone with the given name
+// and type, e.g. a server leaving the A records of a round-robin name,
+// without touching the other members: only the matching record is deleted.
+// Nothing is written when the RRset doesn't hold value; removing the last
+// value deletes the RRset. It returns the records of the RRset after the
+// removal.
+func (p *Provider) RemoveFromRRSet(ctx context.Context, zone, name, rtype, value string) ([]libdns.Record, error) {
+	name = relativeName(name, zone)
+	wanted, err := normalizeRecords([]libdns.Record{libdns.RR{Name: name, Type: rtype, Data: value}}, ttlLimits{})
+	if err != nil {
+		return nil, err
+	}
+	existing, err := p.fetchFilteredRecords(ctx, zone, RecordFilter{Name: name, Type: rtype})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching current records: %w", err)
+	}
+	current, _ := rrsetMembers(existing, name, rtype)
+
+	// Compare the data as rendered by libdns, e.g. for IPv6 addresses
+	data := parseRR(wanted[0]).RR().Data
+	remaining := make([]libdns.Record, 0, len(current))
+	var removed []libdns.Record
+	for _, member := range current {
+		if sameData(rtype, member.RR().Data, data) {
+			removed = append(removed, member)
+		} else {
+			remaining = append(remaining, member)
+		}
+	}
+	if len(removed) > 0 {
+		if _, err := p.DeleteRecords(ctx, zone, removed); err != nil {
+			return nil, fmt.Errorf("error removing from the RRset: %w", err)
+		}
+	}
+	return remaining, nil
+}
+
+// rrsetMembers returns the records of records in the RRset with the given
+// name and type, and their lowest TTL
+func rrsetMembers(records []libdns.Record, name, rtype string) ([]libdns.Record, time.Duration) {
+	key := keyOf(libdns.RR{Name: name, Type: rtype})
+	members := []libdns.Record{}
+	var ttl time.Duration
+	for _, record := range records {
+		rr := record.RR()
+		if keyOf(rr) != key {
+			continue
+		}
+		if len(members) == 0 || rr.TTL < ttl {
+			ttl = rr.TTL
+		}
+		members = append(members, record)
+	}
+	return members, ttl
+}
+
+// rrsetValues are the values of an RRset, as passed to ReplaceRRSet
+type rrsetValues struct {
+	name, rtype string
+	values      []string
+}
+
+// replaceRRSets replaces rrsets with ReplaceRRSet, one after the other,
+// and returns the records of all of them. It stops at the first failure,
+// returning the records of the RRsets already replaced.
+func (p *Provider) replaceRRSets(ctx context.Context, zone string, rrsets []rrsetValues) ([]libdns.Record, error) {
+	var records []libdns.Record
+	for _, rrset := range rrsets {
+		replaced, err := p.ReplaceRRSet(ctx, zone, rrset.name, rrset.rtype, rrset.values)
+		if err != nil {
+			return records, fmt.Errorf("error replacing the %s %s records: %w", rrset.name, rrset.rtype, err)
+		}
+		records = append(records, replaced...)
+	}
+	return records, nil
+}
+
+// applyRRsetChanges deletes then adds records. If a request fails, the
+// records already deleted are restored and the ones already added are
+// removed on a best-effort basis so the zone is left as it was; a failed
+// rollback is reported in the returned error. In the ownership mode, the
+// changes are refused if they touch RRsets not owned by the provider, and
+// the ownership markers are added and removed along with the records.
+func (p *Provider) applyRRsetChanges(ctx context.Context, zone string, toDelete, toAdd []libdns.Record) error {
+	defer p.recordCache.invalidate(zone)
+	owned, err := p.loadOwnership(ctx, zone)
+	if err != nil {
+		return err
+	}
+	if err := owned.check(toDelete, toAdd); err != nil {
+		return err
+	}
+	releases, claims := owned.releases(toDelete, toAdd), owned.claims(toAdd)
+	toDelete = append(toDelete[:len(toDelete):len(toDelete)], releases...)
+	toAdd = append(toAdd[:len(toAdd):len(toAdd)], claims...)
+	if len(toDelete) > 0 {
+		if deleted, err := p.sendRecords(ctx, "DELETE", zone, toDelete, http.StatusOK, http.StatusNoContent); err != nil {
+			return p.rollbackRRsetChanges(ctx, zone, err, deleted, nil)
+		}
+	}
+	if len(toAdd) > 0 {
+		if added, err := p.sendRecords(ctx, "POST", zone, toAdd, http.StatusCreated, http.StatusOK); err != nil {
+			return p.rollbackRRsetChanges(ctx, zone, err, toDelete, added)
+		}
+	}
+	return nil
+}
+
+// rollbackRRsetChanges removes the added records and restores the deleted
+// ones after err, even if ctx is canceled, and returns err along with any
+// rollback failure.
+func (p *Provider) rollbackRRsetChanges(ctx context.Context, zone string, err error, deleted, added []libdns.Record) error {
+	ctx = context.WithoutCancel(ctx)
+	var rollbackErrs []error
+	if len(added) > 0 {
+		if _, rollbackErr := p.sendRecords(ctx, "DELETE", zone, added, http.StatusOK, http.StatusNoContent); rollbackErr != nil {
+			rollbackErrs = append(rollbackErrs, rollbackErr)
+		}
+	}
+	if len(deleted) > 0 {
+		if _, rollbackErr := p.sendRecords(ctx, "POST", zone, deleted, http.StatusCreated, http.StatusOK); rollbackErr != nil {
+			rollbackErrs = append(rollbackErrs, rollbackErr)
+		}
+	}
+	if len(rollbackErrs) > 0 {
+		return errors.Join(err, fmt.Errorf("rollback failed, zone may be partially updated: %w", errors.Join(rollbackErrs...)))
+	}
+	return err
+}
+
+// sendRecords sends records to the records endpoint of zone with method, in
+// batches of at most BatchSize records sent up to Parallelism at a time. It
+// returns the records written, and an *APIError for each batch whose
+// response status is not one of okStatuses (or 207 Multi-Status, or 202
+// Accepted whose operation is awaited) or a *RecordError for each record
+// rejected. TTLs are sent as-is.
+func (p *Provider) sendRecords(ctx context.Context, method, zone string, records []libdns.Record, okStatuses ...int) ([]libdns.Record, error) {
+	if _, err := normalizeRecords(records, ttlLimits{}); err != nil {
+		return nil, err
+	}
+	return p.writeBatches(records, func(batch []libdns.Record) ([]libdns.Record, error) {
+		return p.sendBatch(ctx, method, zone, batch, okStatuses...)
+	})
+}
+
+// sendBatch sends records with a single request and returns the records
+// written, all of them unless the API reports per-record results
+func (p *Provider) sendBatch(ctx context.Context, method, zone string, records []libdns.Record, okStatuses ...int) ([]libdns.Record, error) {
+	apiRecords, err := toAPIRecords(records, ttlLimits{})
+	if err != nil {
+		return nil, err
+	}
+	requestBody := map[string]interface{}{
+		"records": apiRecords,
+	}
+
+	resp, err := p.makeRequest(ctx, method, zonePath(zone)+"/records", requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("%s request error: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	for _, status := range append([]int{http.StatusMultiStatus, http.StatusAccepted}, okStatuses...) {
+		if resp.StatusCode == status {
+			bodyBytes, err := io.ReadAll(resp.Body)
+			if err != nil {
+				return nil, fmt.Errorf("response reading error: %w", err)
+			}
+			if resp.StatusCode == http.StatusAccepted {
+				if bodyBytes, err = p.awaitOperation(ctx, resp, bodyBytes); err != nil {
+					return nil, err
+				}
+			}
+			return p.batchResults(zone, resp, bodyBytes, records)
+		}
+	}
+	return nil, newAPIError(resp)
+}
@@ -0,0 +1,77 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Sources of the SOA serial of zones, see SerialSource
+const (
+	// SerialSourceAPI reads the serial with GetZone
+	SerialSourceAPI = "api"
+
+	// SerialSourceDNS reads the serial from the SOA record served by the
+	// nameservers of the zone, Nameservers if set, without using the API
+	// at all. Changes are then only seen once they reach the nameservers.
+	SerialSourceDNS = "dns"
+)
+
+// validateSerialSource checks that source is a known serial source, or empty
+func validateSerialSource(source string) error {
+	switch source {
+	case "", SerialSourceAPI, SerialSourceDNS:
+		return nil
+	}
+	return fmt.Errorf("invalid serial source %q: %q or %q expected", source, SerialSourceAPI, SerialSourceDNS)
+}
+
+// zoneSerial returns the SOA serial of zone read from SerialSource. With
+// SerialSourceDNS, the first nameserver answering is used.
+func (p *Provider) zoneSerial(ctx context.Context, zone string) (uint32, error) {
+	if err := validateSerialSource(p.SerialSource); err != nil {
+		return 0, err
+	}
+	if p.SerialSource == SerialSourceAPI {
+		info, err := p.GetZone(ctx, zone)
+		if err != nil {
+			return 0, err
+		}
+		if info.Serial == 0 {
+			return 0, fmt.Errorf("no SOA serial returned for zone %s", zone)
+		}
+		return info.Serial, nil
+	}
+
+	origin := dns.Fqdn(normalizeZone(zone))
+	nameservers, err := p.zoneNameservers(ctx, origin)
+	if err != nil {
+		return 0, err
+	}
+	var errs []error
+	for _, ns := range nameservers {
+		served, err := queryRRset(ctx, ns, origin, dns.TypeSOA, false, origin)
+		if err == nil && len(served) == 0 {
+			err = fmt.Errorf("no SOA record served")
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", ns, err))
+			continue
+		}
+		// SOA data: mname rname serial refresh retry expire minimum
+		fields := strings.Fields(served[0].Data)
+		if len(fields) != 7 {
+			return 0, fmt.Errorf("%s: invalid SOA record %q", ns, served[0].Data)
+		}
+		serial, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("%s: invalid SOA serial %q", ns, fields[2])
+		}
+		return uint32(serial), nil
+	}
+	return 0, errors.Join(errs...)
+}
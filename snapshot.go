@@ -0,0 +1,48 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// Snapshot is the full record set of a zone at a point in time, as captured
+// by SnapshotZone. It can be marshaled to JSON to be kept, e.g. before a
+// risky change.
+type Snapshot struct {
+	// Zone is the zone the records were read from
+	Zone string `json:"zone"`
+	// Time is when the snapshot was taken
+	Time time.Time `json:"time"`
+	// Records are the records of the zone, with their TTLs as served
+	Records []libdns.RR `json:"records"`
+}
+
+// SnapshotZone captures the current records of zone, bypassing the
+// GetRecords cache.
+func (p *Provider) SnapshotZone(ctx context.Context, zone string) (*Snapshot, error) {
+	records, err := p.fetchRecords(ctx, zone)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching current records: %w", err)
+	}
+	snapshot := &Snapshot{Zone: zone, Time: time.Now(), Records: make([]libdns.RR, 0, len(records))}
+	for _, record := range records {
+		snapshot.Records = append(snapshot.Records, record.RR())
+	}
+	return snapshot, nil
+}
+
+// RestoreSnapshot brings zone back to the records of snapshot, e.g. after
+// a bad SetRecords run, and returns the applied plan. It works like Sync,
+// so only the records that differ are written and the changes are rolled
+// back if applying them fails. TTLs are restored as captured, without
+// clamping.
+func (p *Provider) RestoreSnapshot(ctx context.Context, zone string, snapshot *Snapshot) (*Plan, error) {
+	desired := make([]libdns.Record, 0, len(snapshot.Records))
+	for _, rr := range snapshot.Records {
+		desired = append(desired, rr)
+	}
+	return p.Sync(ContextWithRawTTL(ctx), zone, desired)
+}
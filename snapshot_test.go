@@ -0,0 +1,48 @@
+package libdnsimmosquare_test
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+
+	libdnsimmosquare "github.com/immosquare/libdns-immosquare"
+	"github.com/immosquare/libdns-immosquare/immosquaretest"
+)
+
+func TestRestoreSnapshotOwnership(t *testing.T) {
+	srv := immosquaretest.NewServer("token")
+	defer srv.Close()
+	srv.AddZone("example.com")
+	ctx := context.Background()
+	provider := srv.Provider(libdnsimmosquare.WithOwnership("me", ""))
+
+	if _, err := provider.AppendRecords(ctx, "example.com", []libdns.Record{
+		libdns.Address{Name: "a", IP: netip.MustParseAddr("192.0.2.1"), TTL: time.Hour},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := provider.SnapshotZone(ctx, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := provider.SetRecords(ctx, "example.com", []libdns.Record{
+		libdns.Address{Name: "a", IP: netip.MustParseAddr("192.0.2.2"), TTL: time.Hour},
+		libdns.Address{Name: "b", IP: netip.MustParseAddr("192.0.2.3"), TTL: time.Hour},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	plan, err := provider.RestoreSnapshot(ctx, "example.com", snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "~ a 3600 A 192.0.2.2 -> a 3600 A 192.0.2.1\n- b 3600 A 192.0.2.3\n"; plan.String() != want {
+		t.Errorf("plan = %q, want %q", plan, want)
+	}
+	assertZone(t, srv, "example.com",
+		"_owner.a TXT heritage=libdns-immosquare,owner=me,type=A",
+		"a A 192.0.2.1")
+}
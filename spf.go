@@ -0,0 +1,169 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// spfVersion is the version tag starting SPF records (RFC 7208 §4.5)
+const spfVersion = "v=spf1"
+
+// maxSPFLookups is the number of terms causing DNS lookups an SPF record
+// may have (RFC 7208 §4.6.4)
+const maxSPFLookups = 10
+
+// MergeSPF adds mechanisms, such as "include:_spf.example.net",
+// "ip4:192.0.2.0/24" or "ip6:2001:db8::/32", to the SPF record of the zone
+// apex, creating it with "~all" if there's none. Since a second SPF record
+// makes SPF checks fail with a permanent error, the existing record is
+// replaced by the merged one, keeping its TTL, its other terms and their
+// order: new mechanisms go before the "all" mechanism, and mechanisms
+// already present are skipped. Nothing is written when the apex has several
+// SPF records or when the merged record would need more than 10 DNS
+// lookups, in which case the error matches ErrSPFLookupLimit. It returns
+// the SPF record after the merge.
+func (p *Provider) MergeSPF(ctx context.Context, zone string, mechanisms ...string) (libdns.Record, error) {
+	for _, mechanism := range mechanisms {
+		if err := checkSPFMechanism(mechanism); err != nil {
+			return nil, err
+		}
+	}
+
+	records, err := p.fetchFilteredRecords(ctx, zone, RecordFilter{Name: apexName, Type: "TXT"})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching current records: %w", err)
+	}
+	var current []libdns.Record
+	for _, record := range records {
+		if isSPF(record.RR().Data) {
+			current = append(current, record)
+		}
+	}
+	if len(current) > 1 {
+		return nil, fmt.Errorf("zone %s has %d SPF records at the apex, merge them by hand first", zone, len(current))
+	}
+
+	terms := []string{"~all"}
+	if len(current) == 1 {
+		terms = strings.Fields(current[0].RR().Data)[1:]
+	}
+	merged := mergeSPFTerms(terms, mechanisms)
+	if lookups := spfLookups(merged); lookups > maxSPFLookups {
+		return nil, fmt.Errorf("%w: the merged record needs %d lookups, at most %d are allowed", ErrSPFLookupLimit, lookups, maxSPFLookups)
+	}
+	txt := libdns.TXT{Name: apexName, Text: strings.Join(append([]string{spfVersion}, merged...), " ")}
+
+	if len(current) == 0 {
+		added, err := p.AppendRecords(ctx, zone, []libdns.Record{txt})
+		if err != nil {
+			return nil, err
+		}
+		return added[0], nil
+	}
+	rr := current[0].RR()
+	if rr.Data == txt.Text {
+		return current[0], nil
+	}
+	txt.TTL = rr.TTL
+	if err := p.applyRRsetChanges(ctx, zone, current, []libdns.Record{txt}); err != nil {
+		return nil, fmt.Errorf("error during SPF record replacement: %w", err)
+	}
+	p.observeRecords(zone, "set", 2)
+	return txt, nil
+}
+
+// isSPF reports whether the TXT value text is an SPF record
+func isSPF(text string) bool {
+	version, _, _ := strings.Cut(text, " ")
+	return strings.EqualFold(version, spfVersion)
+}
+
+// spfTerm splits an SPF term into its qualifier, "+" when implicit, its
+// lowercase mechanism or modifier name and its argument
+func spfTerm(term string) (qualifier, name, arg string) {
+	qualifier = "+"
+	if term != "" && strings.ContainsRune("+-~?", rune(term[0])) {
+		qualifier, term = term[:1], term[1:]
+	}
+	end := strings.IndexAny(term, ":=/")
+	if end < 0 {
+		return qualifier, strings.ToLower(term), ""
+	}
+	return qualifier, strings.ToLower(term[:end]), term[end:]
+}
+
+// checkSPFMechanism returns an error if mechanism can't be merged by
+// MergeSPF: only the include, ip4, ip6, a, mx and exists mechanisms can
+func checkSPFMechanism(mechanism string) error {
+	_, name, arg := spfTerm(mechanism)
+	value := strings.TrimPrefix(arg, ":")
+	var valid bool
+	switch name {
+	case "include", "exists":
+		valid = strings.HasPrefix(arg, ":") && checkName(value, false) == ""
+	case "ip4", "ip6":
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			var addr netip.Addr
+			addr, err = netip.ParseAddr(value)
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		valid = strings.HasPrefix(arg, ":") && err == nil && prefix.Addr().Is4() == (name == "ip4")
+	case "a", "mx":
+		valid = !strings.HasPrefix(arg, "=")
+	}
+	if !valid {
+		return fmt.Errorf("invalid SPF mechanism %q", mechanism)
+	}
+	return nil
+}
+
+// mergeSPFTerms returns terms with the mechanisms not already present
+// inserted before the "all" mechanism, or appended if there's none
+func mergeSPFTerms(terms, mechanisms []string) []string {
+	merged := append([]string{}, terms...)
+	insertAt := len(merged)
+	for i, term := range merged {
+		if _, name, _ := spfTerm(term); name == "all" {
+			insertAt = i
+			break
+		}
+	}
+	for _, mechanism := range mechanisms {
+		if containsSPFTerm(merged, mechanism) {
+			continue
+		}
+		merged = append(merged[:insertAt], append([]string{mechanism}, merged[insertAt:]...)...)
+		insertAt++
+	}
+	return merged
+}
+
+// containsSPFTerm reports whether terms has term, compared
+// case-insensitively and with the "+" qualifier implicit
+func containsSPFTerm(terms []string, term string) bool {
+	qualifier, name, arg := spfTerm(term)
+	for _, candidate := range terms {
+		q, n, a := spfTerm(candidate)
+		if q == qualifier && n == name && strings.EqualFold(a, arg) {
+			return true
+		}
+	}
+	return false
+}
+
+// spfLookups returns the number of terms causing DNS lookups
+func spfLookups(terms []string) int {
+	var lookups int
+	for _, term := range terms {
+		switch _, name, _ := spfTerm(term); name {
+		case "include", "a", "mx", "ptr", "exists", "redirect":
+			lookups++
+		}
+	}
+	return lookups
+}
@@ -0,0 +1,91 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// sshfpAlgorithms maps SSH public key types to SSHFP algorithm numbers
+// (RFC 4255, RFC 6594, RFC 7479, RFC 8709)
+var sshfpAlgorithms = map[string]uint8{
+	"ssh-rsa":             1,
+	"ssh-dss":             2,
+	"ecdsa-sha2-nistp256": 3,
+	"ecdsa-sha2-nistp384": 3,
+	"ecdsa-sha2-nistp521": 3,
+	"ssh-ed25519":         4,
+	"ssh-ed448":           6,
+}
+
+// sshfpSHA256 is the SSHFP fingerprint type of SHA-256 fingerprints
+const sshfpSHA256 = 2
+
+// SSHFPRecords returns the SSHFP records of the host name for publicKeys,
+// each in the authorized_keys format of the .pub files of OpenSSH, e.g.
+// the content of /etc/ssh/ssh_host_ed25519_key.pub. Fingerprints are
+// SHA-256, as SHA-1 ones are deprecated.
+func SSHFPRecords(name string, publicKeys ...string) ([]libdns.RR, error) {
+	records := make([]libdns.RR, 0, len(publicKeys))
+	for _, publicKey := range publicKeys {
+		algorithm, blob, err := parseSSHPublicKey(publicKey)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(blob)
+		records = append(records, libdns.RR{
+			Name: name,
+			Type: "SSHFP",
+			Data: fmt.Sprintf("%d %d %x", algorithm, sshfpSHA256, sum),
+		})
+	}
+	return records, nil
+}
+
+// PublishSSHFP publishes the SSHFP records of the host name in zone for
+// publicKeys, see SSHFPRecords. The SSHFP RRset of the host is replaced
+// with ReplaceRRSet, so the fingerprints of removed or rotated host keys
+// go away. It returns the SSHFP records of the host.
+func (p *Provider) PublishSSHFP(ctx context.Context, zone, name string, publicKeys ...string) ([]libdns.Record, error) {
+	if len(publicKeys) == 0 {
+		return nil, fmt.Errorf("at least one SSH public key is required")
+	}
+	records, err := SSHFPRecords(name, publicKeys...)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]string, 0, len(records))
+	for _, rr := range records {
+		values = append(values, rr.Data)
+	}
+	return p.ReplaceRRSet(ctx, zone, name, "SSHFP", values)
+}
+
+// parseSSHPublicKey returns the SSHFP algorithm and the wire format of the
+// public key in the authorized_keys format "type base64 [comment]"
+func parseSSHPublicKey(publicKey string) (uint8, []byte, error) {
+	fields := strings.Fields(publicKey)
+	if len(fields) < 2 {
+		return 0, nil, fmt.Errorf(`invalid SSH public key %q: expected "type base64 [comment]"`, publicKey)
+	}
+	keyType := fields[0]
+	algorithm, ok := sshfpAlgorithms[keyType]
+	if !ok {
+		return 0, nil, fmt.Errorf("unsupported SSH public key type %q", keyType)
+	}
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid %s public key: %w", keyType, err)
+	}
+	// The wire format starts with the key type as a length-prefixed string
+	if len(blob) < 4+len(keyType) || binary.BigEndian.Uint32(blob) != uint32(len(keyType)) ||
+		string(blob[4:4+len(keyType)]) != keyType {
+		return 0, nil, fmt.Errorf("invalid %s public key: key data doesn't match the type", keyType)
+	}
+	return algorithm, blob, nil
+}
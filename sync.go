@@ -0,0 +1,196 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// Plan is the set of changes converging a zone to a desired state, as
+// computed by Provider.Plan.
+type Plan struct {
+	// Zone is the zone the plan applies to
+	Zone string
+	// Creates are records to add
+	Creates []libdns.Record
+	// Updates are records whose value or TTL changes
+	Updates []Update
+	// Deletes are records to remove
+	Deletes []libdns.Record
+}
+
+// Update is a record replaced by another one of the same RRset
+type Update struct {
+	Old libdns.Record
+	New libdns.Record
+}
+
+// Empty reports whether the plan has no changes
+func (plan *Plan) Empty() bool {
+	return len(plan.Creates) == 0 && len(plan.Updates) == 0 && len(plan.Deletes) == 0
+}
+
+// String renders the plan one change per line, prefixed with "+" for
+// creates, "~" for updates and "-" for deletes.
+func (plan *Plan) String() string {
+	var b strings.Builder
+	for _, record := range plan.Creates {
+		fmt.Fprintf(&b, "+ %s\n", formatRR(record.RR()))
+	}
+	for _, update := range plan.Updates {
+		fmt.Fprintf(&b, "~ %s -> %s\n", formatRR(update.Old.RR()), formatRR(update.New.RR()))
+	}
+	for _, record := range plan.Deletes {
+		fmt.Fprintf(&b, "- %s\n", formatRR(record.RR()))
+	}
+	return b.String()
+}
+
+// formatRR renders rr on a single line in zone file order
+func formatRR(rr libdns.RR) string {
+	return fmt.Sprintf("%s %d %s %s", rr.Name, int(rr.TTL.Seconds()), rr.Type, rr.Data)
+}
+
+// Sync converges zone to the desired records: it computes a plan with Plan,
+// applies it with Apply and returns it. SOA records, and apex NS records
+// when desired has none, are left untouched.
+func (p *Provider) Sync(ctx context.Context, zone string, desired []libdns.Record) (*Plan, error) {
+	plan, err := p.Plan(ctx, zone, desired)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Apply(ctx, plan); err != nil {
+		return plan, err
+	}
+	return plan, nil
+}
+
+// Plan fetches the current records of zone and computes the changes needed
+// so the zone contains exactly the desired records, without applying them.
+// TTLs of desired records are clamped like AppendRecords does, so clamping
+// doesn't show up as a perpetual change. In the ownership mode, see
+// OwnerID, ownership markers are left out on both sides: Apply writes and
+// deletes them along with the RRsets they own.
+func (p *Provider) Plan(ctx context.Context, zone string, desired []libdns.Record) (*Plan, error) {
+	markers := p.ownershipOf(ctx, nil)
+	desired = markers.withoutMarkers(relativeRecords(zone, desired))
+	if err := validateRecords(desired); err != nil {
+		return nil, err
+	}
+	if _, err := checkCNAMEConflicts(desired, nil, false); err != nil {
+		return nil, err
+	}
+	wanted, err := normalizeRecords(desired, p.ttlLimits(ctx))
+	if err != nil {
+		return nil, err
+	}
+	existing, err := p.fetchRecords(ctx, zone)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching current records: %w", err)
+	}
+	return computePlan(zone, markers.withoutMarkers(existing), wanted), nil
+}
+
+// Apply applies plan: deleted and updated records are removed, then created
+// and updated ones are added. If adding fails, the removed records are
+// restored on a best-effort basis.
+func (p *Provider) Apply(ctx context.Context, plan *Plan) error {
+	if plan.Empty() {
+		return nil
+	}
+	toDelete := append([]libdns.Record{}, plan.Deletes...)
+	toAdd := append([]libdns.Record{}, plan.Creates...)
+	for _, update := range plan.Updates {
+		toDelete = append(toDelete, update.Old)
+		toAdd = append(toAdd, update.New)
+	}
+	if err := p.applyRRsetChanges(ctx, plan.Zone, toDelete, toAdd); err != nil {
+		return fmt.Errorf("error applying plan: %w", err)
+	}
+	p.observeRecords(plan.Zone, "set", len(toDelete)+len(toAdd))
+	return nil
+}
+
+// computePlan diffs existing records against the wanted ones, RRset by
+// RRset. Within an RRset, records with the same value are kept (or updated
+// when only their TTL differs), then leftover old and new values are paired
+// into updates, and the rest become creates or deletes.
+func computePlan(zone string, existing []libdns.Record, wanted []libdns.RR) *Plan {
+	plan := &Plan{Zone: zone}
+
+	wantedSets := make(map[rrsetKey][]libdns.RR)
+	var order []rrsetKey
+	for _, rr := range wanted {
+		key := keyOf(rr)
+		if _, ok := wantedSets[key]; !ok {
+			order = append(order, key)
+		}
+		wantedSets[key] = append(wantedSets[key], rr)
+	}
+	existingSets := make(map[rrsetKey][]libdns.Record)
+	for _, record := range existing {
+		key := keyOf(record.RR())
+		if key.rtype == "SOA" {
+			continue
+		}
+		if key.rtype == "NS" && key.name == "@" && wantedSets[key] == nil {
+			continue
+		}
+		if _, ok := existingSets[key]; !ok && wantedSets[key] == nil {
+			order = append(order, key)
+		}
+		existingSets[key] = append(existingSets[key], record)
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		if order[i].name != order[j].name {
+			return order[i].name < order[j].name
+		}
+		return order[i].rtype < order[j].rtype
+	})
+
+	for _, key := range order {
+		var oldLeft []libdns.Record
+		newLeft := append([]libdns.RR{}, wantedSets[key]...)
+		for _, record := range existingSets[key] {
+			rr := record.RR()
+			match := -1
+			for i, candidate := range newLeft {
+				// Targets differing only by case or a trailing dot match
+				if sameData(rr.Type, candidate.Data, rr.Data) {
+					match = i
+					break
+				}
+			}
+			if match < 0 {
+				oldLeft = append(oldLeft, record)
+				continue
+			}
+			if newLeft[match].TTL != rr.TTL {
+				plan.Updates = append(plan.Updates, Update{Old: record, New: parseRR(newLeft[match])})
+			}
+			newLeft = append(newLeft[:match], newLeft[match+1:]...)
+		}
+
+		for len(oldLeft) > 0 && len(newLeft) > 0 {
+			plan.Updates = append(plan.Updates, Update{Old: oldLeft[0], New: parseRR(newLeft[0])})
+			oldLeft, newLeft = oldLeft[1:], newLeft[1:]
+		}
+		for _, rr := range newLeft {
+			plan.Creates = append(plan.Creates, parseRR(rr))
+		}
+		plan.Deletes = append(plan.Deletes, oldLeft...)
+	}
+	return plan
+}
+
+// parseRR returns the type-specific record for rr, or rr itself when its
+// type isn't supported
+func parseRR(rr libdns.RR) libdns.Record {
+	if parsed, err := rr.Parse(); err == nil {
+		return parsed
+	}
+	return rr
+}
@@ -0,0 +1,137 @@
+package libdnsimmosquare_test
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+
+	libdnsimmosquare "github.com/immosquare/libdns-immosquare"
+	"github.com/immosquare/libdns-immosquare/immosquaretest"
+)
+
+func TestSync(t *testing.T) {
+	srv := immosquaretest.NewServer("token")
+	defer srv.Close()
+	srv.AddZone("example.com",
+		immosquaretest.Record{Name: "@", Type: "SOA", Value: "ns1.immosquare.test. hostmaster.example.com. 1 7200 3600 1209600 300", TTL: 3600},
+		immosquaretest.Record{Name: "@", Type: "NS", Value: "ns1.immosquare.test.", TTL: 3600},
+		immosquaretest.Record{Name: "www", Type: "A", Value: "192.0.2.1", TTL: 300},
+		immosquaretest.Record{Name: "www", Type: "A", Value: "192.0.2.2", TTL: 300},
+		immosquaretest.Record{Name: "old", Type: "TXT", Value: "obsolete", TTL: 300})
+	ctx := context.Background()
+	provider := srv.Provider()
+	desired := []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.1"), TTL: 600 * time.Second},
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.3"), TTL: 600 * time.Second},
+		libdns.CNAME{Name: "api", Target: "www.example.com.", TTL: 600 * time.Second},
+	}
+
+	// SOA and apex NS records are left alone
+	plan, err := provider.Sync(ctx, "example.com", desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `+ api 600 CNAME www.example.com.
+~ www 300 A 192.0.2.1 -> www 600 A 192.0.2.1
+~ www 300 A 192.0.2.2 -> www 600 A 192.0.2.3
+- old 300 TXT obsolete
+`
+	if plan.String() != want {
+		t.Errorf("plan:\n%swant:\n%s", plan, want)
+	}
+	assertZone(t, srv, "example.com",
+		"@ SOA ns1.immosquare.test. hostmaster.example.com. 1 7200 3600 1209600 300",
+		"@ NS ns1.immosquare.test.",
+		"api CNAME www.example.com.",
+		"www A 192.0.2.1",
+		"www A 192.0.2.3")
+
+	if plan, err := provider.Plan(ctx, "example.com", desired); err != nil {
+		t.Fatal(err)
+	} else if !plan.Empty() {
+		t.Errorf("plan after Sync = %q, want no changes", plan)
+	}
+}
+
+func TestPlanTargetSpelling(t *testing.T) {
+	srv := immosquaretest.NewServer("token")
+	defer srv.Close()
+	srv.AddZone("example.com",
+		immosquaretest.Record{Name: "www", Type: "CNAME", Value: "Web.Example.NET.", TTL: 300},
+		immosquaretest.Record{Name: "@", Type: "MX", Value: "10 MAIL.example.com.", TTL: 300})
+
+	// Targets differing only by case or a trailing dot are the same
+	plan, err := srv.Provider().Plan(context.Background(), "example.com", []libdns.Record{
+		libdns.CNAME{Name: "www", Target: "web.example.net", TTL: 300 * time.Second},
+		libdns.MX{Name: "@", Preference: 10, Target: "mail.example.com", TTL: 300 * time.Second},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.Empty() {
+		t.Errorf("plan = %q, want no changes", plan)
+	}
+}
+
+func TestSyncOwnership(t *testing.T) {
+	srv := immosquaretest.NewServer("token")
+	defer srv.Close()
+	srv.AddZone("example.com")
+	ctx := context.Background()
+	provider := srv.Provider(libdnsimmosquare.WithOwnership("me", ""))
+
+	if _, err := provider.Sync(ctx, "example.com", []libdns.Record{
+		libdns.Address{Name: "a", IP: netip.MustParseAddr("192.0.2.1"), TTL: time.Hour},
+		libdns.Address{Name: "b", IP: netip.MustParseAddr("192.0.2.2"), TTL: time.Hour},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	assertZone(t, srv, "example.com",
+		"_owner.a TXT heritage=libdns-immosquare,owner=me,type=A",
+		"_owner.b TXT heritage=libdns-immosquare,owner=me,type=A",
+		"a A 192.0.2.1",
+		"b A 192.0.2.2")
+
+	// The markers are neither deleted nor planned again
+	plan, err := provider.Sync(ctx, "example.com", []libdns.Record{
+		libdns.Address{Name: "a", IP: netip.MustParseAddr("192.0.2.3"), TTL: time.Hour},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "~ a 3600 A 192.0.2.1 -> a 3600 A 192.0.2.3\n- b 3600 A 192.0.2.2\n"; plan.String() != want {
+		t.Errorf("plan = %q, want %q", plan, want)
+	}
+	assertZone(t, srv, "example.com",
+		"_owner.a TXT heritage=libdns-immosquare,owner=me,type=A",
+		"a A 192.0.2.3")
+
+	// RRsets of other owners are refused
+	srv.AddZone("example.com",
+		immosquaretest.Record{Name: "c", Type: "A", Value: "192.0.2.4", TTL: 3600},
+		immosquaretest.Record{Name: "_owner.c", Type: "TXT", Value: "heritage=libdns-immosquare,owner=other,type=A", TTL: 3600})
+	if _, err := provider.Sync(ctx, "example.com", nil); !errors.Is(err, libdnsimmosquare.ErrNotOwned) {
+		t.Errorf("err = %v, want ErrNotOwned", err)
+	}
+}
+
+// assertZone checks that zone holds exactly want, records rendered as
+// "name type value" in any order
+func assertZone(t *testing.T, srv *immosquaretest.Server, zone string, want ...string) {
+	t.Helper()
+	var got []string
+	for _, record := range srv.Records(zone) {
+		got = append(got, record.Name+" "+record.Type+" "+record.Value)
+	}
+	sort.Strings(got)
+	sort.Strings(want)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("records of %s:\n%s\nwant:\n%s", zone, strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
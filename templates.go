@@ -0,0 +1,121 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// Template is a named set of parameterized records, e.g. "website" or
+// "saas-app", applied to zones with ApplyTemplate so hundreds of customer
+// domains get the same records. Names and data may reference variables as
+// ${name}, substituted when the template is rendered; ${zone} is the zone
+// the template is applied to, without trailing dot.
+type Template struct {
+	// Records are the records of the template
+	Records []TemplateRecord `json:"records"`
+
+	// Defaults are the values of the variables not given when rendering
+	Defaults map[string]string `json:"defaults,omitempty"`
+}
+
+// TemplateRecord is a record of a Template, with variables in its name and
+// data.
+type TemplateRecord struct {
+	Name string        `json:"name"`
+	Type string        `json:"type"`
+	Data string        `json:"data"`
+	TTL  time.Duration `json:"ttl,omitempty"`
+}
+
+// Render returns the records of the template for zone, with the variables
+// substituted from vars, then from Defaults. Referencing a variable
+// defined in neither is an error, so typos never end up in a zone.
+func (t Template) Render(zone string, vars map[string]string) ([]libdns.Record, error) {
+	values := map[string]string{"zone": normalizeZone(zone)}
+	for name, value := range t.Defaults {
+		values[name] = value
+	}
+	for name, value := range vars {
+		values[name] = value
+	}
+
+	records := make([]libdns.Record, 0, len(t.Records))
+	var missing []string
+	for _, record := range t.Records {
+		name, undefined := expandTemplate(record.Name, values)
+		missing = append(missing, undefined...)
+		data, undefined := expandTemplate(record.Data, values)
+		missing = append(missing, undefined...)
+		records = append(records, parseRR(libdns.RR{
+			Name: name,
+			Type: strings.ToUpper(record.Type),
+			Data: data,
+			TTL:  record.TTL,
+		}))
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("undefined template variables: %s", strings.Join(compactStrings(missing), ", "))
+	}
+	return records, nil
+}
+
+// ApplyTemplate renders the template registered as name in Templates for
+// zone, with the variables vars, and writes its records with SetRecords:
+// the RRsets of the template replace the current ones of the same name and
+// type, and other records are left untouched. It returns the records
+// written.
+func (p *Provider) ApplyTemplate(ctx context.Context, zone, name string, vars map[string]string) ([]libdns.Record, error) {
+	template, ok := p.Templates[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown template %q", name)
+	}
+	records, err := template.Render(zone, vars)
+	if err != nil {
+		return nil, fmt.Errorf("template %q: %w", name, err)
+	}
+	return p.SetRecords(ctx, zone, records)
+}
+
+// expandTemplate substitutes the ${name} references of s with values, and
+// returns the names of the undefined ones
+func expandTemplate(s string, values map[string]string) (string, []string) {
+	var b strings.Builder
+	var undefined []string
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(s[start:], '}')
+		if end < 0 {
+			break
+		}
+		b.WriteString(s[:start])
+		name := s[start+2 : start+end]
+		if value, ok := values[name]; ok {
+			b.WriteString(value)
+		} else {
+			undefined = append(undefined, name)
+		}
+		s = s[start+end+1:]
+	}
+	b.WriteString(s)
+	return b.String(), undefined
+}
+
+// compactStrings removes consecutive duplicates from the sorted strings
+func compactStrings(sorted []string) []string {
+	compacted := sorted[:0]
+	for i, s := range sorted {
+		if i == 0 || s != sorted[i-1] {
+			compacted = append(compacted, s)
+		}
+	}
+	return compacted
+}
@@ -0,0 +1,180 @@
+package libdnsimmosquare
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// defaultTerraformResourceType is the resource type of ExportTerraform
+const defaultTerraformResourceType = "immosquare_dns_record"
+
+// TerraformOptions configures ExportTerraform
+type TerraformOptions struct {
+	// ResourceType is the type of the resources written,
+	// "immosquare_dns_record" by default.
+	ResourceType string
+
+	// Imports adds an import block (Terraform 1.5+) after each resource,
+	// so the first terraform apply adopts the existing RRsets instead of
+	// creating them again.
+	Imports bool
+
+	// ImportID returns the ID of the import block of an RRset, with name
+	// relative to zone ("@" for the apex); by default "zone/name/type".
+	ImportID func(zone, name, rtype string) string
+
+	// IncludeApexNS exports the NS records of the zone apex, which are
+	// skipped by default as the API manages them. SOA records are always
+	// skipped.
+	IncludeApexNS bool
+}
+
+// ExportTerraform writes the records of zone to w as Terraform resource
+// blocks, one per RRset with its zone, name, type, ttl and records
+// attributes, so existing records can be brought under Terraform without
+// writing the configuration by hand. Resource names are derived from the
+// type and name of the RRsets, e.g. "a_www" or "mx_apex".
+func (p *Provider) ExportTerraform(ctx context.Context, zone string, w io.Writer, opts TerraformOptions) error {
+	records, err := p.GetRecords(ctx, zone)
+	if err != nil {
+		return err
+	}
+	return writeTerraform(w, zone, records, opts)
+}
+
+// terraformRRset is an RRset rendered as a resource
+type terraformRRset struct {
+	key    rrsetKey
+	ttl    time.Duration
+	values []string
+}
+
+// writeTerraform renders records as Terraform resources for zone, sorted
+// like zone files
+func writeTerraform(w io.Writer, zone string, records []libdns.Record, opts TerraformOptions) error {
+	resourceType := opts.ResourceType
+	if resourceType == "" {
+		resourceType = defaultTerraformResourceType
+	}
+	importID := opts.ImportID
+	if importID == nil {
+		importID = func(zone, name, rtype string) string {
+			return zone + "/" + name + "/" + rtype
+		}
+	}
+
+	sets := make(map[rrsetKey]*terraformRRset)
+	for _, record := range records {
+		rr := record.RR()
+		key := keyOf(rr)
+		if key.rtype == "SOA" || (key.rtype == "NS" && key.name == apexName && !opts.IncludeApexNS) {
+			continue
+		}
+		if sets[key] == nil {
+			sets[key] = &terraformRRset{key: key, ttl: rr.TTL}
+		}
+		sets[key].values = append(sets[key].values, rr.Data)
+	}
+	ordered := make([]*terraformRRset, 0, len(sets))
+	for _, set := range sets {
+		ordered = append(ordered, set)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		if ordered[i].key.name != ordered[j].key.name {
+			return zoneFileNameLess(ordered[i].key.name, ordered[j].key.name)
+		}
+		return ordered[i].key.rtype < ordered[j].key.rtype
+	})
+
+	zone = normalizeZone(zone)
+	used := make(map[string]bool)
+	bw := bufio.NewWriter(w)
+	for i, set := range ordered {
+		name := terraformName(set.key)
+		for n := 2; used[name]; n++ {
+			name = terraformName(set.key) + "_" + strconv.Itoa(n)
+		}
+		used[name] = true
+
+		values := make([]string, len(set.values))
+		for i, value := range set.values {
+			values[i] = hclString(value)
+		}
+		if i > 0 {
+			bw.WriteString("\n")
+		}
+		fmt.Fprintf(bw, "resource %s %s {\n", hclString(resourceType), hclString(name))
+		fmt.Fprintf(bw, "  zone    = %s\n", hclString(zone))
+		fmt.Fprintf(bw, "  name    = %s\n", hclString(set.key.name))
+		fmt.Fprintf(bw, "  type    = %s\n", hclString(set.key.rtype))
+		fmt.Fprintf(bw, "  ttl     = %d\n", int(set.ttl.Seconds()))
+		fmt.Fprintf(bw, "  records = [%s]\n", strings.Join(values, ", "))
+		fmt.Fprintf(bw, "}\n")
+		if opts.Imports {
+			fmt.Fprintf(bw, "\nimport {\n")
+			fmt.Fprintf(bw, "  to = %s.%s\n", resourceType, name)
+			fmt.Fprintf(bw, "  id = %s\n", hclString(importID(zone, set.key.name, set.key.rtype)))
+			fmt.Fprintf(bw, "}\n")
+		}
+	}
+	return bw.Flush()
+}
+
+// terraformName returns the resource name of the RRset key: its type and
+// name, lowercased, with "apex" for the apex, "wildcard" for "*" and
+// underscores for the characters not allowed in identifiers
+func terraformName(key rrsetKey) string {
+	name := key.name
+	if name == apexName {
+		name = "apex"
+	}
+	name = strings.ReplaceAll(name, "*", "wildcard")
+	var b strings.Builder
+	b.WriteString(strings.ToLower(key.rtype) + "_")
+	for _, c := range strings.ToLower(name) {
+		if c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' || c == '-' {
+			b.WriteRune(c)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// hclString quotes s as an HCL string literal, escaping the template
+// sequences ${ and %{ so it's read literally
+func hclString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c == '\r':
+			b.WriteString(`\r`)
+		case c == '\t':
+			b.WriteString(`\t`)
+		case (c == '$' || c == '%') && i+1 < len(s) && s[i+1] == '{':
+			b.WriteByte(c)
+			b.WriteByte(c)
+		case c < 0x20:
+			fmt.Fprintf(&b, `\u%04x`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
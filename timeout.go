@@ -0,0 +1,46 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	// defaultReadTimeout is generous as large zones can take a while to list
+	defaultReadTimeout = 60 * time.Second
+
+	// defaultWriteTimeout keeps ACME challenge writes failing fast
+	defaultWriteTimeout = 30 * time.Second
+)
+
+// requestTimeout returns the timeout of a single attempt of a request
+func (p *Provider) requestTimeout(method string) time.Duration {
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		if p.ReadTimeout > 0 {
+			return p.ReadTimeout
+		}
+		return defaultReadTimeout
+	default:
+		if p.WriteTimeout > 0 {
+			return p.WriteTimeout
+		}
+		return defaultWriteTimeout
+	}
+}
+
+// cancelOnClose releases the context of a request once its response body
+// is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close closes the body and cancels the request context
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
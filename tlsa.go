@@ -0,0 +1,125 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// TLSA certificate usages (RFC 6698 §2.1.1, RFC 7218)
+const (
+	TLSAUsagePKIXTA uint8 = 0
+	TLSAUsagePKIXEE uint8 = 1
+	TLSAUsageDANETA uint8 = 2
+	TLSAUsageDANEEE uint8 = 3
+)
+
+// TLSA selectors (RFC 6698 §2.1.2): the whole certificate or its public key
+const (
+	TLSASelectorCert uint8 = 0
+	TLSASelectorSPKI uint8 = 1
+)
+
+// TLSA matching types (RFC 6698 §2.1.3)
+const (
+	TLSAMatchingFull   uint8 = 0
+	TLSAMatchingSHA256 uint8 = 1
+	TLSAMatchingSHA512 uint8 = 2
+)
+
+// TLSAParams are the usage, selector and matching type of TLSA records.
+// DANE-EE with the SHA-256 of the public key ({3, 1, 1}) is the common
+// choice for mail and web servers, and survives certificate renewals that
+// keep the key.
+type TLSAParams struct {
+	Usage        uint8
+	Selector     uint8
+	MatchingType uint8
+}
+
+// TLSARecord returns the TLSA record of the service on port and proto
+// ("tcp", "udp" or "sctp") of name, named "_<port>._<proto>.<name>", for
+// certOrKey, an *x509.Certificate or a public key as returned by
+// x509.ParsePKIXPublicKey. A public key can only be used with the SPKI
+// selector.
+func TLSARecord(name string, port uint16, proto string, params TLSAParams, certOrKey any) (libdns.RR, error) {
+	proto = strings.ToLower(proto)
+	if proto != "tcp" && proto != "udp" && proto != "sctp" {
+		return libdns.RR{}, fmt.Errorf("invalid TLSA protocol %q: must be tcp, udp or sctp", proto)
+	}
+	if params.Usage > TLSAUsageDANEEE {
+		return libdns.RR{}, fmt.Errorf("invalid TLSA certificate usage %d", params.Usage)
+	}
+
+	var data []byte
+	switch params.Selector {
+	case TLSASelectorCert:
+		cert, ok := certOrKey.(*x509.Certificate)
+		if !ok {
+			return libdns.RR{}, fmt.Errorf("the TLSA certificate selector requires an *x509.Certificate, got %T", certOrKey)
+		}
+		data = cert.Raw
+	case TLSASelectorSPKI:
+		if cert, ok := certOrKey.(*x509.Certificate); ok {
+			data = cert.RawSubjectPublicKeyInfo
+			break
+		}
+		var err error
+		data, err = x509.MarshalPKIXPublicKey(certOrKey)
+		if err != nil {
+			return libdns.RR{}, fmt.Errorf("invalid TLSA public key: %w", err)
+		}
+	default:
+		return libdns.RR{}, fmt.Errorf("invalid TLSA selector %d", params.Selector)
+	}
+
+	switch params.MatchingType {
+	case TLSAMatchingFull:
+	case TLSAMatchingSHA256:
+		sum := sha256.Sum256(data)
+		data = sum[:]
+	case TLSAMatchingSHA512:
+		sum := sha512.Sum512(data)
+		data = sum[:]
+	default:
+		return libdns.RR{}, fmt.Errorf("invalid TLSA matching type %d", params.MatchingType)
+	}
+
+	owner := fmt.Sprintf("_%d._%s", port, proto)
+	if name = normalizeName(name); name != apexName {
+		owner += "." + name
+	}
+	return libdns.RR{
+		Name: owner,
+		Type: "TLSA",
+		Data: fmt.Sprintf("%d %d %d %x", params.Usage, params.Selector, params.MatchingType, data),
+	}, nil
+}
+
+// PublishTLSA publishes the TLSA records of the service on port and proto
+// of name in zone, one per certificate or public key in certsOrKeys, see
+// TLSARecord. The TLSA RRset of the service is replaced with ReplaceRRSet;
+// during a rollover, pass both the current and the next certificate or key
+// so that clients accept either until the switch. It returns the TLSA
+// records of the service.
+func (p *Provider) PublishTLSA(ctx context.Context, zone, name string, port uint16, proto string, params TLSAParams, certsOrKeys ...any) ([]libdns.Record, error) {
+	if len(certsOrKeys) == 0 {
+		return nil, fmt.Errorf("at least one certificate or public key is required")
+	}
+	var owner string
+	values := make([]string, 0, len(certsOrKeys))
+	for _, certOrKey := range certsOrKeys {
+		rr, err := TLSARecord(relativeName(name, zone), port, proto, params, certOrKey)
+		if err != nil {
+			return nil, err
+		}
+		owner = rr.Name
+		values = append(values, rr.Data)
+	}
+	return p.ReplaceRRSet(ctx, zone, owner, "TLSA", values)
+}
@@ -0,0 +1,68 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenFile is an AuthProvider sending a bearer token read from a file. The
+// file is checked before every request and read again when it changed, so
+// mounted secrets (e.g. Kubernetes secrets) can be rotated without
+// restarting. It is safe for concurrent use.
+type tokenFile struct {
+	path string
+
+	mu      sync.Mutex
+	token   string
+	modTime time.Time
+	size    int64
+}
+
+// Apply implements AuthProvider.
+func (f *tokenFile) Apply(req *http.Request) error {
+	token, err := f.get()
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// Refresh implements AuthRefresher, so that a rejected token is read again
+// even if the file changed without its modification time doing so.
+func (f *tokenFile) Refresh(_ context.Context, _ *http.Request) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.token = ""
+	return nil
+}
+
+// get returns the token, reading the file if it changed since the last read
+func (f *tokenFile) get() (string, error) {
+	// Stat follows symbolic links, such as the ones Kubernetes swaps when
+	// updating a mounted secret
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return "", fmt.Errorf("API token file error: %w", err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.token != "" && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.token, nil
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return "", fmt.Errorf("API token file error: %w", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("API token file %s is empty", f.path)
+	}
+	f.token, f.modTime, f.size = token, info.ModTime(), info.Size()
+	return token, nil
+}
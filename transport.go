@@ -0,0 +1,100 @@
+package libdnsimmosquare
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// hasTransportSettings reports whether TLS or proxy settings are configured
+func (p *Provider) hasTransportSettings() bool {
+	return p.tlsConfig != nil || p.CAFile != "" || p.TLSServerName != "" || p.ProxyURL != "" ||
+		p.ClientCertFile != "" || p.ClientKeyFile != "" || len(p.clientCertificates) > 0
+}
+
+// configureTransport returns a copy of client whose transport applies the
+// TLS and proxy settings. The transport must be an *http.Transport (or nil
+// for the default one), which is cloned so the caller's is left untouched.
+func (p *Provider) configureTransport(client *http.Client) (*http.Client, error) {
+	var transport *http.Transport
+	switch t := client.Transport.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = t.Clone()
+	default:
+		return nil, fmt.Errorf("TLS and proxy settings require an *http.Transport, got %T", t)
+	}
+
+	tlsConfig := transport.TLSClientConfig
+	if p.tlsConfig != nil {
+		tlsConfig = p.tlsConfig.Clone()
+	} else if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	if p.CAFile != "" {
+		pool, err := loadCertPool(p.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if p.TLSServerName != "" {
+		tlsConfig.ServerName = p.TLSServerName
+	}
+	certificates, err := p.loadClientCertificates()
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.Certificates = append(tlsConfig.Certificates, certificates...)
+	transport.TLSClientConfig = tlsConfig
+
+	if p.ProxyURL != "" {
+		proxyURL, err := url.Parse(p.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	configured := *client
+	configured.Transport = transport
+	return &configured, nil
+}
+
+// loadCertPool returns the system root CAs plus the PEM certificates of file
+func loadCertPool(file string) (*x509.CertPool, error) {
+	pemCerts, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("CA file reading error: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pemCerts) {
+		return nil, fmt.Errorf("no PEM certificate found in CA file %s", file)
+	}
+	return pool, nil
+}
+
+// loadClientCertificates returns the client certificates for mutual TLS:
+// the ones set with WithClientCertificate, then the ClientCertFile and
+// ClientKeyFile pair.
+func (p *Provider) loadClientCertificates() ([]tls.Certificate, error) {
+	certificates := append([]tls.Certificate{}, p.clientCertificates...)
+	if p.ClientCertFile == "" && p.ClientKeyFile == "" {
+		return certificates, nil
+	}
+	if p.ClientCertFile == "" || p.ClientKeyFile == "" {
+		return nil, fmt.Errorf("both ClientCertFile and ClientKeyFile are required for mutual TLS")
+	}
+	certificate, err := tls.LoadX509KeyPair(p.ClientCertFile, p.ClientKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("client certificate loading error: %w", err)
+	}
+	return append(certificates, certificate), nil
+}
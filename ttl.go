@@ -0,0 +1,21 @@
+package libdnsimmosquare
+
+import "context"
+
+// rawTTLKey is the context key set by ContextWithRawTTL
+type rawTTLKey struct{}
+
+// ContextWithRawTTL returns a copy of ctx for which AppendRecords,
+// SetRecords and Sync forward TTLs to the API as given, like RawTTL does for
+// every call, e.g. to send TTL 0 for the zone default:
+//
+//	provider.AppendRecords(libdnsimmosquare.ContextWithRawTTL(ctx), zone, records)
+func ContextWithRawTTL(ctx context.Context) context.Context {
+	return context.WithValue(ctx, rawTTLKey{}, true)
+}
+
+// rawTTL reports whether ctx comes from ContextWithRawTTL
+func rawTTL(ctx context.Context) bool {
+	raw, _ := ctx.Value(rawTTLKey{}).(bool)
+	return raw
+}
@@ -0,0 +1,50 @@
+package libdnsimmosquare
+
+import (
+	"strings"
+)
+
+// encodeTXT renders the text of a TXT record as sent to the API. Values
+// that don't fit in a single character-string, or that contain quotes or
+// backslashes, are sent as quoted character-strings of at most 255 bytes
+// with RFC 1035 escapes, so long DKIM keys and SPF records are stored
+// intact; other values are sent as is.
+func encodeTXT(text string) string {
+	if len(text) <= maxTXTStringLen && !strings.ContainsAny(text, `"\`) {
+		return text
+	}
+	return quoteTXT(text)
+}
+
+// decodeTXT reassembles the text of a TXT record returned by the API: a
+// value made of quoted character-strings is unescaped and its strings are
+// concatenated, any other value is returned as is.
+func decodeTXT(value string) string {
+	rest := strings.TrimSpace(value)
+	if !strings.HasPrefix(rest, `"`) {
+		return value
+	}
+	var b strings.Builder
+	for rest != "" {
+		if rest[0] != '"' {
+			return value
+		}
+		end := 1
+		for end < len(rest) && rest[end] != '"' {
+			if rest[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(rest) {
+			return value
+		}
+		part, err := unescapeCharacterString(rest[1:end])
+		if err != nil {
+			return value
+		}
+		b.WriteString(part)
+		rest = strings.TrimLeft(rest[end+1:], " \t")
+	}
+	return b.String()
+}
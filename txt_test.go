@@ -0,0 +1,62 @@
+package libdnsimmosquare_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+
+	"github.com/immosquare/libdns-immosquare/immosquaretest"
+)
+
+func TestTXTCharacterStrings(t *testing.T) {
+	srv := immosquaretest.NewServer("token")
+	defer srv.Close()
+	srv.AddZone("example.com")
+	provider := srv.Provider()
+	ctx := context.Background()
+
+	dkim := "v=DKIM1; k=rsa; p=" + strings.Repeat("A", 300)
+	texts := map[string]string{
+		"short":  "v=spf1 -all",
+		"long":   dkim,
+		"quoted": `say "hi" \o/`,
+	}
+	var records []libdns.Record
+	for name, text := range texts {
+		records = append(records, libdns.TXT{Name: name, Text: text, TTL: time.Hour})
+	}
+	if _, err := provider.AppendRecords(ctx, "example.com", records); err != nil {
+		t.Fatal(err)
+	}
+
+	// Long values are split into strings of at most 255 bytes, and quotes
+	// and backslashes are escaped
+	want := map[string]string{
+		"short":  "v=spf1 -all",
+		"long":   `"` + dkim[:255] + `" "` + dkim[255:] + `"`,
+		"quoted": `"say \"hi\" \\o/"`,
+	}
+	for _, record := range srv.Records("example.com") {
+		if record.Value != want[record.Name] {
+			t.Errorf("value of %s sent as %q, want %q", record.Name, record.Value, want[record.Name])
+		}
+	}
+
+	// The values read back are the original texts
+	got, err := provider.GetRecords(ctx, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(texts) {
+		t.Fatalf("got %d records, want %d", len(got), len(texts))
+	}
+	for _, record := range got {
+		txt, ok := record.(libdns.TXT)
+		if !ok || txt.Text != texts[txt.Name] {
+			t.Errorf("got %#v, want text %q", record, texts[txt.Name])
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+)
+
+// Validate checks the configuration and that the API is reachable with the
+// configured credentials, by listing the zones and, for each zone of Zones,
+// requesting a single record. It is meant to be called at startup, so a
+// misconfiguration is reported right away rather than at the next
+// certificate renewal. Errors match the sentinel errors, e.g.
+// ErrUnauthorized for a rejected token.
+func (p *Provider) Validate(ctx context.Context) error {
+	for _, endpoint := range p.knownEndpoints() {
+		if err := validateEndpoint(endpoint); err != nil {
+			return err
+		}
+	}
+	if err := validateSerialSource(p.SerialSource); err != nil {
+		return err
+	}
+	if _, err := p.ListZones(ctx); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	zones := make([]string, 0, len(p.Zones))
+	for zone := range p.Zones {
+		zones = append(zones, zone)
+	}
+	sort.Strings(zones)
+	var errs []error
+	for _, zone := range zones {
+		if err := p.validateZone(ctx, zone); err != nil {
+			errs = append(errs, fmt.Errorf("validation of zone %s failed: %w", zone, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateEndpoint checks that endpoint is an absolute HTTP(S) URL
+func validateEndpoint(endpoint string) error {
+	if endpoint == "" {
+		return fmt.Errorf("endpoint is required for the immosquare provider")
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid endpoint %q: %w", endpoint, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid endpoint %q: an http:// or https:// URL is required", endpoint)
+	}
+	return nil
+}
+
+// validateZone requests the first record of zone, with the credentials
+// and endpoint of its ZoneConfig
+func (p *Provider) validateZone(ctx context.Context, zone string) error {
+	path := withQuery(zonePath(zone)+"/records", map[string]string{"page": "1", "per_page": "1"})
+	resp, err := p.makeRequest(ctx, "GET", path, nil)
+	if err != nil {
+		return fmt.Errorf("GET request error: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return newAPIError(resp)
+	}
+	return nil
+}
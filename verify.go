@@ -0,0 +1,129 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// VerificationError is returned by AppendRecords and SetRecords, along
+// with the records written, when VerifyWrites is set and the authoritative
+// nameservers don't serve the written records before VerifyTimeout: the API
+// accepted the write, but the nameservers never picked it up. Use errors.As
+// to inspect it:
+//
+//	var verifyErr *libdnsimmosquare.VerificationError
+//	if errors.As(err, &verifyErr) {
+//		for _, drift := range verifyErr.Drifts {
+//			// ...
+//		}
+//	}
+type VerificationError struct {
+	// Zone is the zone written
+	Zone string
+
+	// Drifts are the differences still found between the written RRsets
+	// and the answers of the nameservers, see RecordDrift
+	Drifts []RecordDrift
+
+	// Err joins the failures of the last queries, and the reason the
+	// verification stopped, e.g. context.DeadlineExceeded
+	Err error
+}
+
+// Error implements the error interface.
+func (e *VerificationError) Error() string {
+	drifts := make([]string, 0, len(e.Drifts))
+	for _, drift := range e.Drifts {
+		drifts = append(drifts, drift.String())
+	}
+	msg := fmt.Sprintf("records of zone %s written but not served by its nameservers", e.Zone)
+	if len(drifts) > 0 {
+		msg += ": " + strings.Join(drifts, "; ")
+	}
+	if e.Err != nil {
+		msg += fmt.Sprintf(" (%v)", e.Err)
+	}
+	return msg
+}
+
+// Unwrap returns Err.
+func (e *VerificationError) Unwrap() error {
+	return e.Err
+}
+
+// verifyWrite polls the authoritative nameservers of zone, like
+// WaitForPropagation, until they serve records, and returns a
+// *VerificationError if they still don't after VerifyTimeout. With exact,
+// the RRsets of records must be served with no other values, as written by
+// SetRecords; otherwise other values are ignored, as for AppendRecords.
+func (p *Provider) verifyWrite(ctx context.Context, zone string, records []libdns.Record, exact bool) error {
+	timeout := p.VerifyTimeout
+	if timeout <= 0 {
+		timeout = defaultPropagationTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	origin := dns.Fqdn(normalizeZone(zone))
+	nameservers, err := p.zoneNameservers(ctx, origin)
+	if err != nil {
+		return &VerificationError{Zone: zone, Err: err}
+	}
+	rrsets := make(map[rrsetKey][]string)
+	var keys []rrsetKey
+	for _, record := range records {
+		rr := record.RR()
+		key := keyOf(rr)
+		if _, ok := dns.StringToType[key.rtype]; !ok {
+			continue
+		}
+		if _, ok := rrsets[key]; !ok {
+			keys = append(keys, key)
+		}
+		rrsets[key] = append(rrsets[key], rr.Data)
+	}
+
+	// pending are the nameservers not serving each RRset yet
+	pending := make(map[rrsetKey][]string, len(keys))
+	for _, key := range keys {
+		pending[key] = nameservers
+	}
+	for attempt := 1; ; attempt++ {
+		var drifts []RecordDrift
+		var errs []error
+		for _, key := range keys {
+			remaining := pending[key][:0:0]
+			for _, ns := range pending[key] {
+				served, err := queryRRset(ctx, ns, libdns.AbsoluteName(key.name, origin), dns.StringToType[key.rtype], false, origin)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("error querying %s: %w", ns, err))
+					remaining = append(remaining, ns)
+					continue
+				}
+				drift, ok := compareRRset(key, rrsets[key], served)
+				if !exact {
+					drift.Stale = nil
+					ok = len(drift.Missing) > 0
+				}
+				if ok {
+					drift.Nameserver = ns
+					drifts = append(drifts, drift)
+					remaining = append(remaining, ns)
+				}
+			}
+			pending[key] = remaining
+		}
+		p.logDebug(ctx, "write verification", "zone", zone, "attempt", attempt, "drifts", len(drifts), "errors", len(errs))
+		if len(drifts) == 0 && len(errs) == 0 {
+			return nil
+		}
+		if err := sleepContext(ctx, defaultPropagationInterval); err != nil {
+			return &VerificationError{Zone: zone, Drifts: drifts, Err: errors.Join(append(errs, err)...)}
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+const (
+	// defaultWatchInterval is the delay between two polls of WatchRecords
+	// when WatchOptions.Interval is not set
+	defaultWatchInterval = 10 * time.Second
+
+	// maxWatchWait caps how long the API is asked to hold a poll open, so
+	// it stays well within the read timeout
+	maxWatchWait = 30 * time.Second
+)
+
+// WatchOptions configures WatchRecords
+type WatchOptions struct {
+	// Interval is the minimum delay between two polls (default 10s)
+	Interval time.Duration
+
+	// Since is the time from which changes are reported (default now)
+	Since time.Time
+}
+
+// WatchEvent is sent by WatchRecords for every change of the zone, or when
+// polling failed
+type WatchEvent struct {
+	Change
+
+	// Err is set when polling failed. Watching goes on after transient
+	// errors (see IsRetryable) and stops after the others.
+	Err error
+}
+
+// WatchRecords reports the changes made to the records of zone, e.g. out of
+// band, on the returned channel until ctx is done, so controllers can react
+// to them without their own polling loop. It long-polls the changes
+// endpoint of ListChanges, asking the API to hold each request open until
+// there are changes with the wait query parameter (in seconds); with APIs
+// that answer right away, it polls every Interval.
+//
+// The channel is closed when ctx is done or after a permanent error.
+func (p *Provider) WatchRecords(ctx context.Context, zone string, opts WatchOptions) <-chan WatchEvent {
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	since := opts.Since
+	if since.IsZero() {
+		since = time.Now()
+	}
+
+	events := make(chan WatchEvent)
+	go func() {
+		defer close(events)
+		send := func(event WatchEvent) bool {
+			select {
+			case events <- event:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		// since has a resolution of a second, so the changes of that second
+		// already sent are skipped when they come again
+		since = since.Truncate(time.Second)
+		seen := make(map[string]bool)
+		wait := strconv.Itoa(int(min(interval, maxWatchWait).Seconds()))
+		for {
+			start := time.Now()
+			path := withQuery(zonePath(zone)+"/changes", map[string]string{
+				"since": since.UTC().Format(time.RFC3339),
+				"wait":  wait,
+			})
+			changes, err := p.listChanges(ctx, zone, path)
+			if err != nil {
+				if ctx.Err() != nil || !send(WatchEvent{Err: err}) || !IsRetryable(err) {
+					return
+				}
+			}
+			for _, change := range changes {
+				key := changeKey(change)
+				if seen[key] || (!change.Time.IsZero() && change.Time.Before(since)) {
+					continue
+				}
+				if changeTime := change.Time.Truncate(time.Second); changeTime.After(since) {
+					since = changeTime
+					seen = make(map[string]bool)
+				}
+				seen[key] = true
+				if !send(WatchEvent{Change: change}) {
+					return
+				}
+			}
+			p.logDebug(ctx, "watched immosquare zone changes", "zone", zone, "changes", len(changes))
+			if sleepContext(ctx, interval-time.Since(start)) != nil {
+				return
+			}
+		}
+	}()
+	return events
+}
+
+// changeKey identifies change: by its ID, or by its content when the API
+// doesn't report IDs
+func changeKey(change Change) string {
+	if change.ID != "" {
+		return change.ID
+	}
+	key := change.Time.String() + " " + change.Action
+	if change.Record != nil {
+		key += " " + formatRR(change.Record.RR())
+	}
+	return key
+}
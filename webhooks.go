@@ -0,0 +1,131 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Webhook notifies an external system when the records of a zone change
+type Webhook struct {
+	// ID is the server-assigned ID of the webhook
+	ID string `json:"id,omitempty"`
+
+	// URL is called by the API on every change
+	URL string `json:"url"`
+
+	// Events are the kinds of changes notified, e.g. "record.created";
+	// empty for all of them
+	Events []string `json:"events,omitempty"`
+
+	// Secret signs the notifications, so the receiver can authenticate
+	// them. It is only sent when creating the webhook and is never
+	// returned by the API.
+	Secret string `json:"secret,omitempty"`
+
+	// CreatedAt is the creation time of the webhook, zero when the API
+	// doesn't return it
+	CreatedAt time.Time `json:"-"`
+}
+
+// apiWebhook is a webhook as returned by the API
+type apiWebhook struct {
+	ID        apiID    `json:"id"`
+	URL       string   `json:"url"`
+	Events    []string `json:"events"`
+	CreatedAt apiTime  `json:"created_at"`
+}
+
+// toWebhook converts a webhook returned by the API
+func (w apiWebhook) toWebhook() Webhook {
+	return Webhook{ID: string(w.ID), URL: w.URL, Events: w.Events, CreatedAt: time.Time(w.CreatedAt)}
+}
+
+// CreateWebhook registers webhook on zone, with POST /zones/{zone}/webhooks,
+// and returns it as created by the API.
+func (p *Provider) CreateWebhook(ctx context.Context, zone string, webhook Webhook) (Webhook, error) {
+	resp, err := p.makeRequest(ctx, "POST", zonePath(zone)+"/webhooks", webhook)
+	if err != nil {
+		return Webhook{}, fmt.Errorf("POST request error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return Webhook{}, newAPIError(resp)
+	}
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Webhook{}, fmt.Errorf("body reading error: %w", err)
+	}
+
+	// The webhook is returned as an object with a webhook field, or directly
+	var created apiWebhook
+	var apiResponse struct {
+		Webhook *apiWebhook `json:"webhook"`
+	}
+	if err := json.Unmarshal(bodyBytes, &apiResponse); err == nil && apiResponse.Webhook != nil {
+		created = *apiResponse.Webhook
+	} else if err := json.Unmarshal(bodyBytes, &created); err != nil {
+		return Webhook{}, fmt.Errorf("JSON decoding error: %w", err)
+	}
+	result := created.toWebhook()
+	if result.URL == "" {
+		result.URL = webhook.URL
+		result.Events = webhook.Events
+	}
+	return result, nil
+}
+
+// ListWebhooks returns the webhooks registered on zone.
+func (p *Provider) ListWebhooks(ctx context.Context, zone string) ([]Webhook, error) {
+	resp, err := p.makeRequest(ctx, "GET", zonePath(zone)+"/webhooks", nil)
+	if err != nil {
+		return nil, fmt.Errorf("GET request error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp)
+	}
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("body reading error: %w", err)
+	}
+
+	// Same shapes as GetRecords: an object with a webhooks field, or a direct array
+	var apiWebhooks []apiWebhook
+	var apiResponse struct {
+		Webhooks []apiWebhook `json:"webhooks"`
+	}
+	if err := json.Unmarshal(bodyBytes, &apiResponse); err == nil {
+		apiWebhooks = apiResponse.Webhooks
+	} else if err := json.Unmarshal(bodyBytes, &apiWebhooks); err != nil {
+		return nil, fmt.Errorf("JSON decoding error: %w", err)
+	}
+
+	webhooks := make([]Webhook, 0, len(apiWebhooks))
+	for _, webhook := range apiWebhooks {
+		webhooks = append(webhooks, webhook.toWebhook())
+	}
+	return webhooks, nil
+}
+
+// DeleteWebhook deletes the webhook with the given ID from zone.
+func (p *Provider) DeleteWebhook(ctx context.Context, zone, id string) error {
+	resp, err := p.makeRequest(ctx, "DELETE", zonePath(zone)+"/webhooks/"+url.PathEscape(id), nil)
+	if err != nil {
+		return fmt.Errorf("DELETE request error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return newAPIError(resp)
+	}
+	return nil
+}
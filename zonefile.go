@@ -0,0 +1,153 @@
+package libdnsimmosquare
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// defaultZoneFileTTL is the $TTL of exported zone files without records
+const defaultZoneFileTTL = 3600 * time.Second
+
+// maxTXTStringLen is the maximum length of a TXT character-string (RFC 1035 §3.3)
+const maxTXTStringLen = 255
+
+// ExportZoneFile writes the records of zone to w as an RFC 1035 master file,
+// with $ORIGIN and $TTL directives, for backups or migration to other
+// nameservers. Records are sorted by name and type.
+func (p *Provider) ExportZoneFile(ctx context.Context, zone string, w io.Writer) error {
+	records, err := p.GetRecords(ctx, zone)
+	if err != nil {
+		return err
+	}
+	return WriteZoneFile(w, zone, records)
+}
+
+// WriteZoneFile writes records, with names relative to zone, to w as an
+// RFC 1035 master file for zone, like ExportZoneFile does for the records of
+// a zone of this provider.
+func WriteZoneFile(w io.Writer, zone string, records []libdns.Record) error {
+	rrs := make([]libdns.RR, 0, len(records))
+	for _, record := range records {
+		rrs = append(rrs, record.RR())
+	}
+	sort.SliceStable(rrs, func(i, j int) bool {
+		if rrs[i].Name != rrs[j].Name {
+			return zoneFileNameLess(rrs[i].Name, rrs[j].Name)
+		}
+		return rrs[i].Type < rrs[j].Type
+	})
+
+	origin := strings.TrimSuffix(zone, ".") + "."
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "$ORIGIN %s\n", origin)
+	fmt.Fprintf(bw, "$TTL %d\n", int(mostCommonTTL(rrs).Seconds()))
+	for _, rr := range rrs {
+		name := rr.Name
+		if name == "" {
+			name = "@"
+		}
+		fmt.Fprintf(bw, "%s\t%d\tIN\t%s\t%s\n", name, int(rr.TTL.Seconds()), strings.ToUpper(rr.Type), zoneFileData(rr))
+	}
+	return bw.Flush()
+}
+
+// zoneFileNameLess sorts the apex first, then names alphabetically
+func zoneFileNameLess(a, b string) bool {
+	if a == "@" || b == "@" {
+		return a == "@" && b != "@"
+	}
+	return a < b
+}
+
+// mostCommonTTL returns the most frequent TTL of rrs, used as $TTL
+func mostCommonTTL(rrs []libdns.RR) time.Duration {
+	counts := make(map[time.Duration]int)
+	best, bestCount := defaultZoneFileTTL, 0
+	for _, rr := range rrs {
+		counts[rr.TTL]++
+		if c := counts[rr.TTL]; c > bestCount || c == bestCount && rr.TTL > best {
+			best, bestCount = rr.TTL, c
+		}
+	}
+	return best
+}
+
+// zoneFileData renders the RDATA of rr in presentation format. Host names
+// containing a dot are made absolute so they aren't read relative to $ORIGIN.
+func zoneFileData(rr libdns.RR) string {
+	rr.Type = strings.ToUpper(rr.Type)
+	parsed, err := rr.Parse()
+	if err != nil {
+		return rr.Data
+	}
+	switch r := parsed.(type) {
+	case libdns.TXT:
+		return quoteTXT(r.Text)
+	case libdns.CNAME:
+		return fqdnTarget(r.Target)
+	case libdns.NS:
+		return fqdnTarget(r.Target)
+	case libdns.MX:
+		return fmt.Sprintf("%d %s", r.Preference, fqdnTarget(r.Target))
+	case libdns.SRV:
+		return fmt.Sprintf("%d %d %d %s", r.Priority, r.Weight, r.Port, fqdnTarget(r.Target))
+	case libdns.CAA:
+		return fmt.Sprintf("%d %s %s", r.Flags, r.Tag, quoteCharacterString(r.Value))
+	default:
+		return rr.Data
+	}
+}
+
+// fqdnTarget adds the trailing dot to multi-label host names
+func fqdnTarget(target string) string {
+	if target == "" || target == "@" || strings.HasSuffix(target, ".") || !strings.Contains(target, ".") {
+		return target
+	}
+	return target + "."
+}
+
+// quoteTXT renders text as one or more quoted character-strings of at most
+// 255 bytes each, separated by spaces.
+func quoteTXT(text string) string {
+	if text == "" {
+		return `""`
+	}
+	var parts []string
+	for len(text) > 0 {
+		n := len(text)
+		if n > maxTXTStringLen {
+			n = maxTXTStringLen
+		}
+		parts = append(parts, quoteCharacterString(text[:n]))
+		text = text[n:]
+	}
+	return strings.Join(parts, " ")
+}
+
+// quoteCharacterString quotes s, escaping quotes and backslashes, and
+// non-printable bytes as \DDD (RFC 1035 §5.1)
+func quoteCharacterString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&b, "\\%03d", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,172 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// ImportOptions configures ImportZoneFile, ImportRecords and
+// ImportFromProvider
+type ImportOptions struct {
+	// Replace writes the records with SetRecords, replacing the RRsets
+	// present in the file, instead of appending them with AppendRecords.
+	Replace bool
+
+	// IncludeApexNS imports the NS records of the zone apex, which are
+	// skipped by default as they belong to the previous DNS host.
+	// SOA records are always skipped, and so are ownership markers in the
+	// ownership mode, see WithOwnership.
+	IncludeApexNS bool
+
+	// DryRun computes what would be written without writing anything.
+	DryRun bool
+}
+
+// ImportZoneFile parses the RFC 1035 master file read from r and writes its
+// records to zone, e.g. to migrate a zone from BIND or from another
+// provider's export. It returns the records written, or that would be with
+// DryRun.
+func (p *Provider) ImportZoneFile(ctx context.Context, zone string, r io.Reader, opts ImportOptions) ([]libdns.Record, error) {
+	records, err := ParseZoneFile(r, zone)
+	if err != nil {
+		return nil, err
+	}
+	return p.ImportRecords(ctx, zone, records, opts)
+}
+
+// ImportRecords writes records read from another source, e.g. a file
+// parsed with ParseZoneFile, to zone like ImportZoneFile does, skipping the
+// records opts leaves out. It returns the records written, or that would be
+// with DryRun.
+func (p *Provider) ImportRecords(ctx context.Context, zone string, records []libdns.Record, opts ImportOptions) ([]libdns.Record, error) {
+	filtered := make([]libdns.Record, 0, len(records))
+	for _, record := range p.ownershipOf(ctx, nil).withoutMarkers(records) {
+		rr := record.RR()
+		rr.Type = strings.ToUpper(rr.Type)
+		if rr.Type == "SOA" || (rr.Type == "NS" && normalizeName(rr.Name) == apexName && !opts.IncludeApexNS) {
+			continue
+		}
+		filtered = append(filtered, record)
+	}
+	if opts.DryRun {
+		return filtered, nil
+	}
+	if opts.Replace {
+		return p.SetRecords(ctx, zone, filtered)
+	}
+	return p.AppendRecords(ctx, zone, filtered)
+}
+
+// ParseZoneFile parses an RFC 1035 master file for zone, which is used as
+// the initial $ORIGIN. Record names are returned relative to zone ("@" for
+// the apex) and records are converted to their libdns types when supported.
+// $INCLUDE directives are not allowed.
+func ParseZoneFile(r io.Reader, zone string) ([]libdns.Record, error) {
+	origin := dns.Fqdn(zone)
+	parser := dns.NewZoneParser(r, origin, "")
+	parser.SetDefaultTTL(uint32(defaultZoneFileTTL.Seconds()))
+
+	var records []libdns.Record
+	for rr, ok := parser.Next(); ok; rr, ok = parser.Next() {
+		libdnsRR, err := fromDNSRR(rr, origin)
+		if err != nil {
+			return nil, err
+		}
+		if parsed, err := libdnsRR.Parse(); err == nil {
+			records = append(records, parsed)
+		} else {
+			records = append(records, libdnsRR)
+		}
+	}
+	if err := parser.Err(); err != nil {
+		return nil, fmt.Errorf("zone file parsing error: %w", err)
+	}
+	return records, nil
+}
+
+// fromDNSRR converts a miekg/dns record to a libdns.RR with its name
+// relative to origin
+func fromDNSRR(rr dns.RR, origin string) (libdns.RR, error) {
+	hdr := rr.Header()
+	result := libdns.RR{
+		Name: libdns.RelativeName(hdr.Name, origin),
+		Type: dns.TypeToString[hdr.Rrtype],
+		TTL:  time.Duration(hdr.Ttl) * time.Second,
+	}
+
+	switch r := rr.(type) {
+	case *dns.TXT:
+		// libdns expects a single unescaped string
+		parts := make([]string, 0, len(r.Txt))
+		for _, part := range r.Txt {
+			unescaped, err := unescapeCharacterString(part)
+			if err != nil {
+				return libdns.RR{}, fmt.Errorf("invalid TXT record %s: %w", hdr.Name, err)
+			}
+			parts = append(parts, unescaped)
+		}
+		result.Data = strings.Join(parts, "")
+	case *dns.CAA:
+		result.Data = libdns.CAA{Flags: r.Flag, Tag: r.Tag, Value: r.Value}.RR().Data
+	default:
+		result.Data = strings.TrimPrefix(rr.String(), hdr.String())
+	}
+	return result, nil
+}
+
+// toDNSRR converts rr, with its name relative to origin, to a miekg/dns
+// record; relative host names in its data are read relative to origin
+func toDNSRR(rr libdns.RR, origin string) (dns.RR, error) {
+	rr.Type = strings.ToUpper(rr.Type)
+	line := fmt.Sprintf("%s %d IN %s %s", libdns.AbsoluteName(normalizeName(rr.Name), origin), int(rr.TTL.Seconds()), rr.Type, zoneFileData(rr))
+	parser := dns.NewZoneParser(strings.NewReader(line), origin, "")
+	parsed, ok := parser.Next()
+	if !ok {
+		if err := parser.Err(); err != nil {
+			return nil, fmt.Errorf("invalid %s record %q: %w", rr.Type, rr.Name, err)
+		}
+		return nil, fmt.Errorf("invalid %s record %q: %q", rr.Type, rr.Name, rr.Data)
+	}
+	return parsed, nil
+}
+
+// unescapeCharacterString resolves the \X and \DDD escapes of a
+// character-string in presentation format
+func unescapeCharacterString(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+1 >= len(s) {
+			return "", fmt.Errorf("trailing backslash in %q", s)
+		}
+		if i+3 < len(s) && isDigit(s[i+1]) && isDigit(s[i+2]) && isDigit(s[i+3]) {
+			n, _ := strconv.Atoi(s[i+1 : i+4])
+			if n > 255 {
+				return "", fmt.Errorf("invalid escape \\%s in %q", s[i+1:i+4], s)
+			}
+			b.WriteByte(byte(n))
+			i += 3
+			continue
+		}
+		b.WriteByte(s[i+1])
+		i++
+	}
+	return b.String(), nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,80 @@
+package libdnsimmosquare
+
+import (
+	"net/url"
+	"strings"
+)
+
+// ZoneConfig overrides the credentials and endpoint used for a zone, see
+// Provider.Zones. Empty settings fall back to the provider ones.
+type ZoneConfig struct {
+	// APIToken is sent as a bearer token for the zone, instead of the
+	// provider credentials
+	APIToken string `json:"api_token,omitempty"`
+
+	// Endpoint is the base URL of the API serving the zone, instead of
+	// Endpoint and FallbackEndpoints
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+// apiTarget is where requests are sent and how they are authenticated
+type apiTarget struct {
+	endpoints []string
+	pool      *endpointPool
+	auth      AuthProvider
+}
+
+// apiTargets holds the provider target and the ones of the zones with a
+// ZoneConfig
+type apiTargets struct {
+	main  *apiTarget
+	zones map[string]*apiTarget
+}
+
+// newAPITargets builds the targets from Endpoint, FallbackEndpoints, auth
+// and Zones
+func (p *Provider) newAPITargets(auth AuthProvider) *apiTargets {
+	main := &apiTarget{endpoints: p.endpoints(), pool: &p.endpointPool, auth: auth}
+	targets := &apiTargets{main: main, zones: make(map[string]*apiTarget, len(p.Zones))}
+	for zone, config := range p.Zones {
+		target := *main
+		if config.Endpoint != "" {
+			target.endpoints = []string{config.Endpoint}
+			target.pool = &endpointPool{}
+		}
+		if config.APIToken != "" {
+			target.auth = bearerToken(config.APIToken)
+		}
+		targets.zones[normalizeZone(zone)] = &target
+	}
+	return targets
+}
+
+// forPath returns the target of a request to path: the one of the zone for
+// paths under /zones/<zone>/ if it has a ZoneConfig, the provider one
+// otherwise
+func (t *apiTargets) forPath(path string) *apiTarget {
+	if rest, ok := strings.CutPrefix(path, "/zones/"); ok {
+		segment, _, _ := strings.Cut(rest, "/")
+		segment, _, _ = strings.Cut(segment, "?")
+		zone, err := url.PathUnescape(segment)
+		if err != nil {
+			zone = segment
+		}
+		if target, ok := t.zones[normalizeZone(zone)]; ok {
+			return target
+		}
+	}
+	return t.main
+}
+
+// knownEndpoints returns the endpoints of the provider and of Zones
+func (p *Provider) knownEndpoints() []string {
+	endpoints := p.endpoints()
+	for _, config := range p.Zones {
+		if config.Endpoint != "" {
+			endpoints = append(endpoints, config.Endpoint)
+		}
+	}
+	return endpoints
+}
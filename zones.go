@@ -0,0 +1,247 @@
+package libdnsimmosquare
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// apiZone is a zone as returned by the API
+type apiZone struct {
+	Name string `json:"name"`
+}
+
+// ZoneInfo is the metadata of a zone returned by GetZone
+type ZoneInfo struct {
+	libdns.Zone
+
+	// Serial is the SOA serial of the zone, incremented on every change
+	Serial uint32
+
+	// DefaultTTL is the TTL of the records of the zone created without one
+	DefaultTTL time.Duration
+
+	// Nameservers are the nameservers assigned to the zone, to which it
+	// must be delegated
+	Nameservers []string
+
+	// DNSSEC is the DNSSEC status reported by the API, e.g. "signed", or
+	// "enabled" and "disabled" when reported as a boolean. Empty when the
+	// API doesn't report it.
+	DNSSEC string
+}
+
+// apiZoneInfo is the metadata of a zone as returned by GET /zones/{zone}
+type apiZoneInfo struct {
+	Name        string       `json:"name"`
+	Serial      uint32       `json:"serial"`
+	TTL         int          `json:"ttl"`
+	Nameservers []string     `json:"nameservers"`
+	DNSSEC      dnssecStatus `json:"dnssec"`
+}
+
+// dnssecStatus decodes a DNSSEC status given as a string or a boolean
+type dnssecStatus string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *dnssecStatus) UnmarshalJSON(data []byte) error {
+	var enabled bool
+	if err := json.Unmarshal(data, &enabled); err == nil {
+		*s = "disabled"
+		if enabled {
+			*s = "enabled"
+		}
+		return nil
+	}
+	var status string
+	if err := json.Unmarshal(data, &status); err != nil {
+		return fmt.Errorf("invalid DNSSEC status %s", data)
+	}
+	*s = dnssecStatus(status)
+	return nil
+}
+
+// ZoneOptions configures a zone created with CreateZone
+type ZoneOptions struct {
+	// DefaultTTL is the TTL of the records of the zone created without
+	// one. Zero lets the API decide.
+	DefaultTTL time.Duration
+
+	// Template, if set, is the name of a template of Templates applied to
+	// the zone once created, with the variables TemplateVars, e.g. to set
+	// up the NS, MX, SPF and www records of a customer domain so it's
+	// never empty
+	Template     string
+	TemplateVars map[string]string
+}
+
+// ListZones returns the zones available to the configured API token.
+func (p *Provider) ListZones(ctx context.Context) ([]libdns.Zone, error) {
+	resp, err := p.makeRequest(ctx, "GET", "/zones", nil)
+	if err != nil {
+		return nil, fmt.Errorf("GET request error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp)
+	}
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("body reading error: %w", err)
+	}
+
+	// Same shapes as GetRecords: an object with a zones field, or a direct array
+	var apiZones []apiZone
+	var apiResponse struct {
+		Zones []apiZone `json:"zones"`
+	}
+	if err := json.Unmarshal(bodyBytes, &apiResponse); err == nil {
+		apiZones = apiResponse.Zones
+	} else if err := json.Unmarshal(bodyBytes, &apiZones); err != nil {
+		return nil, fmt.Errorf("JSON decoding error: %w", err)
+	}
+
+	zones := make([]libdns.Zone, 0, len(apiZones))
+	for _, apiZone := range apiZones {
+		zones = append(zones, libdns.Zone{Name: apiZone.Name})
+	}
+	return zones, nil
+}
+
+// GetZone returns the metadata of zone: its SOA serial, default TTL,
+// assigned nameservers and DNSSEC status, e.g. to check its delegation or
+// detect changes.
+func (p *Provider) GetZone(ctx context.Context, zone string) (ZoneInfo, error) {
+	resp, err := p.makeRequest(ctx, "GET", zonePath(zone), nil)
+	if err != nil {
+		return ZoneInfo{}, fmt.Errorf("GET request error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return ZoneInfo{}, newAPIError(resp)
+	}
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return ZoneInfo{}, fmt.Errorf("body reading error: %w", err)
+	}
+
+	// The zone is returned as an object with a zone field, or directly
+	var info apiZoneInfo
+	var apiResponse struct {
+		Zone *apiZoneInfo `json:"zone"`
+	}
+	if err := json.Unmarshal(bodyBytes, &apiResponse); err == nil && apiResponse.Zone != nil {
+		info = *apiResponse.Zone
+	} else if err := json.Unmarshal(bodyBytes, &info); err != nil {
+		return ZoneInfo{}, fmt.Errorf("JSON decoding error: %w", err)
+	}
+
+	name := info.Name
+	if name == "" {
+		name = zone
+	}
+	return ZoneInfo{
+		Zone:        libdns.Zone{Name: name},
+		Serial:      info.Serial,
+		DefaultTTL:  time.Duration(info.TTL) * time.Second,
+		Nameservers: info.Nameservers,
+		DNSSEC:      string(info.DNSSEC),
+	}, nil
+}
+
+// CreateZone creates the zone name, so its records can be managed right
+// away. It returns the zone as created by the API.
+//
+// With a Template, the template is rendered before the zone is created,
+// and its records are written with SetRecords right after; if they can't
+// be, the zone is deleted and an error returned, so the zone never exists
+// without them.
+func (p *Provider) CreateZone(ctx context.Context, name string, opts ZoneOptions) (libdns.Zone, error) {
+	name = normalizeZone(name)
+	var bootstrap []libdns.Record
+	if opts.Template != "" {
+		template, ok := p.Templates[opts.Template]
+		if !ok {
+			return libdns.Zone{}, fmt.Errorf("unknown template %q", opts.Template)
+		}
+		var err error
+		if bootstrap, err = template.Render(name, opts.TemplateVars); err != nil {
+			return libdns.Zone{}, fmt.Errorf("template %q: %w", opts.Template, err)
+		}
+	}
+	requestBody := map[string]interface{}{
+		"name": name,
+	}
+	if opts.DefaultTTL > 0 {
+		requestBody["ttl"] = int(opts.DefaultTTL.Seconds())
+	}
+
+	resp, err := p.makeRequest(ctx, "POST", "/zones", requestBody)
+	if err != nil {
+		return libdns.Zone{}, fmt.Errorf("POST request error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return libdns.Zone{}, newAPIError(resp)
+	}
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return libdns.Zone{}, fmt.Errorf("body reading error: %w", err)
+	}
+
+	// The zone is returned as an object with a zone field, or directly;
+	// the name is kept if the response has none
+	zone := libdns.Zone{Name: name}
+	var created apiZone
+	var apiResponse struct {
+		Zone *apiZone `json:"zone"`
+	}
+	if err := json.Unmarshal(bodyBytes, &apiResponse); err == nil && apiResponse.Zone != nil {
+		created = *apiResponse.Zone
+	} else if err := json.Unmarshal(bodyBytes, &created); err != nil {
+		created = apiZone{}
+	}
+	if created.Name != "" {
+		zone.Name = created.Name
+	}
+
+	if len(bootstrap) > 0 {
+		if _, err := p.SetRecords(ctx, zone.Name, bootstrap); err != nil {
+			err = fmt.Errorf("error applying template %q: %w", opts.Template, err)
+			if deleteErr := p.DeleteZone(context.WithoutCancel(ctx), zone.Name); deleteErr != nil {
+				err = errors.Join(err, fmt.Errorf("error deleting the zone: %w", deleteErr))
+			}
+			return libdns.Zone{}, err
+		}
+	}
+	return zone, nil
+}
+
+// DeleteZone deletes the zone name along with all its records. Deleting a
+// zone that doesn't exist returns an error matching ErrZoneNotFound.
+func (p *Provider) DeleteZone(ctx context.Context, name string) error {
+	defer p.recordCache.invalidate(name)
+
+	resp, err := p.makeRequest(ctx, "DELETE", zonePath(name), nil)
+	if err != nil {
+		return fmt.Errorf("DELETE request error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return newAPIError(resp)
+	}
+	return nil
+}